@@ -0,0 +1,138 @@
+// Package analytics aggregates logged training data into time series. All
+// aggregation happens in SQL so that a long history is never loaded into
+// memory.
+package analytics
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// MaxBuckets caps how many periods a single query may span.
+const MaxBuckets = 520
+
+// Query selects the date range and bucket size of a series. From and To are
+// both inclusive.
+type Query struct {
+	From   time.Time
+	To     time.Time
+	Bucket string
+}
+
+func (q Query) Validate() error {
+	if q.Bucket != BucketWeek && q.Bucket != BucketMonth {
+		return errors.New("bucket must be week or month")
+	}
+
+	if q.To.Before(q.From) {
+		return errors.New("to must not be before from")
+	}
+
+	if q.buckets() > MaxBuckets {
+		return errors.New("date range is too large for the chosen bucket")
+	}
+
+	return nil
+}
+
+func (q Query) buckets() int {
+	if q.Bucket == BucketMonth {
+		return int(q.To.Sub(q.From).Hours()/(24*30)) + 1
+	}
+
+	return int(q.To.Sub(q.From).Hours()/(24*7)) + 1
+}
+
+// ExercisePoint aggregates one exercise over a single period. Volume is
+// sets × reps × weight; the one-rep-max estimates are the best of the period.
+type ExercisePoint struct {
+	PeriodStart time.Time `json:"period_start"`
+	Workouts    int       `json:"workouts"`
+	Sets        int       `json:"sets"`
+	Reps        int       `json:"reps"`
+	Volume      float64   `json:"volume"`
+	MaxWeight   *float64  `json:"max_weight"`
+	EpleyE1RM   *float64  `json:"e1rm_epley"`
+	BrzyckiE1RM *float64  `json:"e1rm_brzycki"`
+}
+
+type ExerciseTotals struct {
+	Workouts    int      `json:"workouts"`
+	Sets        int      `json:"sets"`
+	Reps        int      `json:"reps"`
+	Volume      float64  `json:"volume"`
+	MaxWeight   *float64 `json:"max_weight"`
+	EpleyE1RM   *float64 `json:"e1rm_epley"`
+	BrzyckiE1RM *float64 `json:"e1rm_brzycki"`
+}
+
+// SummaryPoint aggregates all of a user's training over a single period.
+type SummaryPoint struct {
+	PeriodStart     time.Time `json:"period_start"`
+	Workouts        int       `json:"workouts"`
+	DurationMinutes int       `json:"duration_minutes"`
+	CaloriesBurned  int       `json:"calories_burned"`
+	Sets            int       `json:"sets"`
+	Reps            int       `json:"reps"`
+	Volume          float64   `json:"volume"`
+}
+
+type SummaryTotals struct {
+	Workouts        int     `json:"workouts"`
+	DurationMinutes int     `json:"duration_minutes"`
+	CaloriesBurned  int     `json:"calories_burned"`
+	Sets            int     `json:"sets"`
+	Reps            int     `json:"reps"`
+	Volume          float64 `json:"volume"`
+}
+
+type Store interface {
+	ExerciseSeries(userID, exerciseID int, query Query) ([]ExercisePoint, error)
+	Summary(userID int, query Query) ([]SummaryPoint, error)
+}
+
+// TotalExercise folds a series into totals for the whole range.
+func TotalExercise(points []ExercisePoint) ExerciseTotals {
+	totals := ExerciseTotals{}
+
+	for _, point := range points {
+		totals.Workouts += point.Workouts
+		totals.Sets += point.Sets
+		totals.Reps += point.Reps
+		totals.Volume += point.Volume
+		totals.MaxWeight = maxOf(totals.MaxWeight, point.MaxWeight)
+		totals.EpleyE1RM = maxOf(totals.EpleyE1RM, point.EpleyE1RM)
+		totals.BrzyckiE1RM = maxOf(totals.BrzyckiE1RM, point.BrzyckiE1RM)
+	}
+
+	return totals
+}
+
+// TotalSummary folds a series into totals for the whole range.
+func TotalSummary(points []SummaryPoint) SummaryTotals {
+	totals := SummaryTotals{}
+
+	for _, point := range points {
+		totals.Workouts += point.Workouts
+		totals.DurationMinutes += point.DurationMinutes
+		totals.CaloriesBurned += point.CaloriesBurned
+		totals.Sets += point.Sets
+		totals.Reps += point.Reps
+		totals.Volume += point.Volume
+	}
+
+	return totals
+}
+
+func maxOf(a, b *float64) *float64 {
+	if a == nil || (b != nil && *b > *a) {
+		return b
+	}
+
+	return a
+}
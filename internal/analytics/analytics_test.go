@@ -0,0 +1,60 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestQueryValidate(t *testing.T) {
+	to := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		query   Query
+		wantErr bool
+	}{
+		{name: "weekly", query: Query{From: to.AddDate(0, 0, -84), To: to, Bucket: BucketWeek}},
+		{name: "monthly", query: Query{From: to.AddDate(-1, 0, 0), To: to, Bucket: BucketMonth}},
+		{name: "unknown bucket", query: Query{From: to.AddDate(0, 0, -7), To: to, Bucket: "day"}, wantErr: true},
+		{name: "reversed range", query: Query{From: to, To: to.AddDate(0, 0, -7), Bucket: BucketWeek}, wantErr: true},
+		{name: "too many weeks", query: Query{From: to.AddDate(-20, 0, 0), To: to, Bucket: BucketWeek}, wantErr: true},
+		{name: "twenty years of months", query: Query{From: to.AddDate(-20, 0, 0), To: to, Bucket: BucketMonth}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTotalExercise(t *testing.T) {
+	totals := TotalExercise([]ExercisePoint{
+		{Workouts: 2, Sets: 6, Reps: 30, Volume: 3000, MaxWeight: floatPtr(100), EpleyE1RM: floatPtr(116.67), BrzyckiE1RM: floatPtr(112.5)},
+		{},
+		{Workouts: 1, Sets: 3, Reps: 9, Volume: 990, MaxWeight: floatPtr(110), EpleyE1RM: floatPtr(121), BrzyckiE1RM: floatPtr(116.47)},
+	})
+
+	assert.Equal(t, 3, totals.Workouts)
+	assert.Equal(t, 9, totals.Sets)
+	assert.Equal(t, 39, totals.Reps)
+	assert.Equal(t, 3990.0, totals.Volume)
+	assert.Equal(t, 110.0, *totals.MaxWeight)
+	assert.Equal(t, 121.0, *totals.EpleyE1RM)
+	assert.Equal(t, 116.47, *totals.BrzyckiE1RM)
+
+	assert.Nil(t, TotalExercise(nil).MaxWeight)
+}
@@ -0,0 +1,153 @@
+package analytics
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// epleySQL and brzyckiSQL estimate a one-rep max from a set of reps at
+// weight. A single rep is its own max, and Brzycki is undefined from 37 reps.
+const (
+	epleySQL   = `ROUND(CASE WHEN e.reps = 1 THEN e.weight ELSE e.weight * (1 + e.reps / 30.0) END, 2)`
+	brzyckiSQL = `ROUND(CASE WHEN e.reps < 37 THEN e.weight * 36 / (37 - e.reps) END, 2)`
+)
+
+// periodsSQL lists the start of every bucket in the range so that empty
+// periods are reported as zeros instead of being skipped. It is formatted with
+// the bucket, from and to placeholders of the surrounding query.
+const periodsSQL = `
+	SELECT generate_series(
+		date_trunc(%[1]s, %[2]s::timestamptz AT TIME ZONE 'UTC'),
+		%[3]s::timestamptz AT TIME ZONE 'UTC',
+		('1 ' || %[1]s)::interval
+	) AS period_start
+`
+
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) ExerciseSeries(userID, exerciseID int, query Query) ([]ExercisePoint, error) {
+	points := []ExercisePoint{}
+
+	sqlQuery := `
+		WITH periods AS (` + fmt.Sprintf(periodsSQL, "$3", "$4", "$5") + `),
+		entries AS (
+			SELECT date_trunc($3, w.performed_at AT TIME ZONE 'UTC') AS period_start, w.id AS workout_id, we.sets, we.reps, we.weight
+			FROM workout_entries we
+			INNER JOIN workouts w ON w.id = we.workout_id
+			WHERE w.user_id = $1 AND w.deleted_at IS NULL AND we.exercise_id = $2 AND w.performed_at >= $4 AND w.performed_at <= $5
+		)
+		SELECT p.period_start,
+			COUNT(DISTINCT e.workout_id),
+			COALESCE(SUM(e.sets), 0),
+			COALESCE(SUM(e.sets * e.reps), 0),
+			COALESCE(SUM(e.sets * e.reps * e.weight), 0),
+			MAX(e.weight),
+			MAX(` + epleySQL + `) FILTER (WHERE e.reps > 0 AND e.weight > 0),
+			MAX(` + brzyckiSQL + `) FILTER (WHERE e.reps > 0 AND e.weight > 0)
+		FROM periods p
+		LEFT JOIN entries e ON e.period_start = p.period_start
+		GROUP BY p.period_start
+		ORDER BY p.period_start
+	`
+
+	rows, err := s.db.Query(sqlQuery, userID, exerciseID, query.Bucket, query.From, query.To)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		point := ExercisePoint{}
+		err = rows.Scan(
+			&point.PeriodStart,
+			&point.Workouts,
+			&point.Sets,
+			&point.Reps,
+			&point.Volume,
+			&point.MaxWeight,
+			&point.EpleyE1RM,
+			&point.BrzyckiE1RM,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
+
+func (s *PostgresStore) Summary(userID int, query Query) ([]SummaryPoint, error) {
+	points := []SummaryPoint{}
+
+	// Workout and entry totals are grouped separately so that a workout's
+	// duration and calories are not counted once per entry.
+	sqlQuery := `
+		WITH periods AS (` + fmt.Sprintf(periodsSQL, "$2", "$3", "$4") + `),
+		workout_totals AS (
+			SELECT date_trunc($2, performed_at AT TIME ZONE 'UTC') AS period_start,
+				COUNT(*) AS workouts, SUM(duration_minutes) AS duration_minutes, SUM(calories_burned) AS calories_burned
+			FROM workouts
+			WHERE user_id = $1 AND deleted_at IS NULL AND performed_at >= $3 AND performed_at <= $4
+			GROUP BY 1
+		),
+		entry_totals AS (
+			SELECT date_trunc($2, w.performed_at AT TIME ZONE 'UTC') AS period_start,
+				SUM(we.sets) AS sets, SUM(we.sets * we.reps) AS reps, SUM(we.sets * we.reps * we.weight) AS volume
+			FROM workout_entries we
+			INNER JOIN workouts w ON w.id = we.workout_id
+			WHERE w.user_id = $1 AND w.deleted_at IS NULL AND w.performed_at >= $3 AND w.performed_at <= $4
+			GROUP BY 1
+		)
+		SELECT p.period_start,
+			COALESCE(wt.workouts, 0),
+			COALESCE(wt.duration_minutes, 0),
+			COALESCE(wt.calories_burned, 0),
+			COALESCE(et.sets, 0),
+			COALESCE(et.reps, 0),
+			COALESCE(et.volume, 0)
+		FROM periods p
+		LEFT JOIN workout_totals wt ON wt.period_start = p.period_start
+		LEFT JOIN entry_totals et ON et.period_start = p.period_start
+		ORDER BY p.period_start
+	`
+
+	rows, err := s.db.Query(sqlQuery, userID, query.Bucket, query.From, query.To)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		point := SummaryPoint{}
+		err = rows.Scan(
+			&point.PeriodStart,
+			&point.Workouts,
+			&point.DurationMinutes,
+			&point.CaloriesBurned,
+			&point.Sets,
+			&point.Reps,
+			&point.Volume,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
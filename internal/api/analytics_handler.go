@@ -0,0 +1,142 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/analytics"
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/utils"
+)
+
+type AnalyticsHandler struct {
+	analyticsStore analytics.Store
+	exerciseStore  store.ExerciseStore
+	logger         *log.Logger
+}
+
+// NewAnalyticsHandler Constructor
+func NewAnalyticsHandler(analyticsStore analytics.Store, exerciseStore store.ExerciseStore, logger *log.Logger) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analyticsStore: analyticsStore,
+		exerciseStore:  exerciseStore,
+		logger:         logger,
+	}
+}
+
+// HandleGetExerciseAnalytics GET /analytics/exercises/{id}?from=&to=&bucket=
+func (ah *AnalyticsHandler) HandleGetExerciseAnalytics(w http.ResponseWriter, r *http.Request) {
+	exerciseID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid exercise ID"})
+		return
+	}
+
+	query, err := readAnalyticsQuery(r.URL.Query(), time.Now())
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	exercise, err := ah.exerciseStore.GetExerciseByID(exerciseID)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve exercise"})
+		return
+	}
+
+	if exercise == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Exercise not found"})
+		return
+	}
+
+	series, err := ah.analyticsStore.ExerciseSeries(middleware.GetUser(r).ID, exerciseID, query)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to compute analytics"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{
+		"exercise": exercise,
+		"from":     query.From,
+		"to":       query.To,
+		"bucket":   query.Bucket,
+		"series":   series,
+		"totals":   analytics.TotalExercise(series),
+	})
+}
+
+// HandleGetSummary GET /analytics/summary?from=&to=&bucket=
+func (ah *AnalyticsHandler) HandleGetSummary(w http.ResponseWriter, r *http.Request) {
+	query, err := readAnalyticsQuery(r.URL.Query(), time.Now())
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	series, err := ah.analyticsStore.Summary(middleware.GetUser(r).ID, query)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to compute analytics"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{
+		"from":   query.From,
+		"to":     query.To,
+		"bucket": query.Bucket,
+		"series": series,
+		"totals": analytics.TotalSummary(series),
+	})
+}
+
+// readAnalyticsQuery defaults to weekly buckets over the twelve weeks (or
+// twelve months for monthly buckets) ending now.
+func readAnalyticsQuery(qs url.Values, now time.Time) (analytics.Query, error) {
+	query := analytics.Query{
+		Bucket: utils.ReadString(qs, "bucket", analytics.BucketWeek),
+		To:     now.UTC(),
+	}
+
+	to, err := utils.ReadOptionalTime(qs, "to")
+
+	if err != nil {
+		return query, err
+	}
+
+	if to != nil {
+		query.To = *to
+
+		// A bare date in "to" covers the whole day.
+		if len(qs.Get("to")) == len(time.DateOnly) {
+			query.To = query.To.Add(24*time.Hour - time.Nanosecond)
+		}
+	}
+
+	from, err := utils.ReadOptionalTime(qs, "from")
+
+	if err != nil {
+		return query, err
+	}
+
+	switch {
+	case from != nil:
+		query.From = *from
+	case query.Bucket == analytics.BucketMonth:
+		query.From = query.To.AddDate(0, -12, 0)
+	default:
+		query.From = query.To.AddDate(0, 0, -7*12)
+	}
+
+	return query, query.Validate()
+}
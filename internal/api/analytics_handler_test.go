@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/analytics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAnalyticsQuery(t *testing.T) {
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	query, err := readAnalyticsQuery(url.Values{}, now)
+	require.NoError(t, err)
+	assert.Equal(t, analytics.BucketWeek, query.Bucket)
+	assert.Equal(t, now, query.To)
+	assert.Equal(t, now.AddDate(0, 0, -84), query.From)
+
+	query, err = readAnalyticsQuery(url.Values{"bucket": {"month"}}, now)
+	require.NoError(t, err)
+	assert.Equal(t, now.AddDate(-1, 0, 0), query.From)
+
+	query, err = readAnalyticsQuery(url.Values{"from": {"2026-01-01"}, "to": {"2026-01-31"}}, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), query.From)
+	assert.Equal(t, time.Date(2026, 1, 31, 23, 59, 59, 999999999, time.UTC), query.To)
+
+	_, err = readAnalyticsQuery(url.Values{"bucket": {"day"}}, now)
+	assert.Error(t, err)
+
+	_, err = readAnalyticsQuery(url.Values{"from": {"2026-02-01"}, "to": {"2026-01-01"}}, now)
+	assert.Error(t, err)
+
+	_, err = readAnalyticsQuery(url.Values{"from": {"yesterday"}}, now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/ical"
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/tokens"
+	"github.com/DavidGudovic/api_exercise/internal/utils"
+)
+
+const (
+	calendarProductID = "-//api_exercise//Workouts//EN"
+	calendarUIDDomain = "api_exercise"
+	// calendarHorizonDays is how far ahead planned sessions are published.
+	calendarHorizonDays = 365
+)
+
+type CalendarHandler struct {
+	workoutStore store.WorkoutStore
+	programStore store.ProgramStore
+	tokenStore   store.TokenStore
+	baseURL      string
+	logger       *log.Logger
+}
+
+// NewCalendarHandler Constructor
+func NewCalendarHandler(workoutStore store.WorkoutStore, programStore store.ProgramStore, tokenStore store.TokenStore, baseURL string, logger *log.Logger) *CalendarHandler {
+	return &CalendarHandler{
+		workoutStore: workoutStore,
+		programStore: programStore,
+		tokenStore:   tokenStore,
+		baseURL:      baseURL,
+		logger:       logger,
+	}
+}
+
+// HandleCreateFeedToken POST /users/me/calendar-token
+//
+// Issues the token for the calendar feed URL, revoking the previous one. Only
+// the token's hash is stored, so a lost URL can only be replaced.
+func (ch *CalendarHandler) HandleCreateFeedToken(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	err := ch.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeCalendar)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to revoke calendar token"})
+		return
+	}
+
+	token, err := ch.tokenStore.CreateNewToken(user.ID, tokens.ScopeCalendar, tokens.CalendarTTL)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create calendar token"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{
+		"token":  token.Plaintext,
+		"expiry": token.Expiry,
+		"url":    fmt.Sprintf("%s/users/me/calendar.ics?token=%s", ch.baseURL, url.QueryEscape(token.Plaintext)),
+	})
+}
+
+// HandleRevokeFeedToken DELETE /users/me/calendar-token
+func (ch *CalendarHandler) HandleRevokeFeedToken(w http.ResponseWriter, r *http.Request) {
+	err := ch.tokenStore.DeleteAllTokensForUser(middleware.GetUser(r).ID, tokens.ScopeCalendar)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to revoke calendar token"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusNoContent, nil)
+}
+
+// HandleGetCalendar GET /users/me/calendar.ics?token=
+//
+// Publishes every workout as a timed event and the planned sessions of the
+// next calendarHorizonDays that have not been done yet as all-day events.
+func (ch *CalendarHandler) HandleGetCalendar(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	sessions, err := ch.programStore.GetSchedule(user.ID, today, today.AddDate(0, 0, calendarHorizonDays))
+
+	if err != nil {
+		ch.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve schedule"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="workouts.ics"`)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	calendar := ical.NewCalendar(w, calendarProductID, "Workouts")
+
+	for _, session := range sessions {
+		if session.Completed {
+			continue
+		}
+
+		calendar.WriteEvent(sessionEvent(session))
+	}
+
+	err = ch.workoutStore.ExportWorkouts(user.ID, func(workout *store.Workout) error {
+		calendar.WriteEvent(workoutEvent(workout))
+		return nil
+	})
+
+	if err == nil {
+		err = calendar.Close()
+	}
+
+	// The status line has already been sent, so a failure can only be logged.
+	if err != nil {
+		ch.logger.Printf("ERROR: writing calendar: %v", err)
+	}
+}
+
+func workoutEvent(workout *store.Workout) ical.Event {
+	start := workout.PerformedAt
+
+	if workout.StartedAt != nil {
+		start = *workout.StartedAt
+	}
+
+	event := ical.Event{
+		UID:          fmt.Sprintf("workout-%d@%s", workout.ID, calendarUIDDomain),
+		Start:        start,
+		End:          workout.EndedAt,
+		Summary:      workout.Title,
+		Sequence:     workout.Version - 1,
+		LastModified: &workout.UpdatedAt,
+	}
+
+	if event.End == nil && workout.DurationMinutes > 0 {
+		end := start.Add(time.Duration(workout.DurationMinutes) * time.Minute)
+		event.End = &end
+	}
+
+	lines := []string{}
+
+	if workout.Description != "" {
+		lines = append(lines, workout.Description, "")
+	}
+
+	for _, entry := range workout.Entries {
+		lines = append(lines, describeEntry(entry))
+	}
+
+	event.Description = strings.TrimSpace(strings.Join(lines, "\n"))
+	return event
+}
+
+func sessionEvent(session *store.PlannedSession) ical.Event {
+	end := session.Date.AddDate(0, 0, 1)
+
+	return ical.Event{
+		UID:         fmt.Sprintf("session-%d-%d@%s", session.EnrollmentID, session.SessionID, calendarUIDDomain),
+		Start:       session.Date,
+		End:         &end,
+		AllDay:      true,
+		Summary:     fmt.Sprintf("%s: %s", session.ProgramName, session.TemplateName),
+		Description: fmt.Sprintf("Planned session, week %d day %d", session.Week, session.Day),
+	}
+}
+
+// describeEntry formats an entry as, for example, "Bench Press: 5 x 5 @ 100 kg"
+// or "Running: 1 x 1800 s, 5.2 km".
+func describeEntry(entry store.WorkoutEntry) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %d x ", entry.ExerciseName, entry.Sets)
+
+	if entry.Reps != nil {
+		b.WriteString(strconv.Itoa(*entry.Reps))
+	} else if entry.DurationSeconds != nil {
+		fmt.Fprintf(&b, "%d s", *entry.DurationSeconds)
+	}
+
+	if entry.Weight != nil {
+		fmt.Fprintf(&b, " @ %s kg", strconv.FormatFloat(*entry.Weight, 'f', -1, 64))
+	}
+
+	if entry.DistanceMeters != nil {
+		fmt.Fprintf(&b, ", %s km", strconv.FormatFloat(math.Round(*entry.DistanceMeters/10)/100, 'f', -1, 64))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/tokens"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupCalendarRouter(workoutStore store.WorkoutStore, programStore store.ProgramStore, userStore store.UserStore, tokenStore store.TokenStore) http.Handler {
+	handler := NewCalendarHandler(workoutStore, programStore, tokenStore, "https://example.com", log.New(io.Discard, "", 0))
+	userMiddleware := middleware.UserMiddleware{UserStore: userStore}
+
+	r := chi.NewRouter()
+	r.Post("/users/me/calendar-token", handler.HandleCreateFeedToken)
+	r.Delete("/users/me/calendar-token", handler.HandleRevokeFeedToken)
+
+	r.Group(func(r chi.Router) {
+		r.Use(userMiddleware.AuthenticateQueryToken(tokens.ScopeCalendar))
+		r.Use(userMiddleware.RequireActivatedUser)
+
+		r.Get("/users/me/calendar.ics", handler.HandleGetCalendar)
+	})
+
+	return r
+}
+
+func getCalendar(handler http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/users/me/calendar.ics?token="+url.QueryEscape(token), nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestCalendarFeed(t *testing.T) {
+	tokenStore := newFakeTokenStore()
+	userStore := newFakeUserStore(tokenStore)
+	workoutStore := newFakeWorkoutStore()
+	programStore := newFakeProgramStore(workoutStore)
+
+	user := &store.User{Username: "owner", Email: "owner@example.com", Activated: true}
+	require.NoError(t, userStore.CreateUser(user))
+
+	router := setupCalendarRouter(workoutStore, programStore, userStore, tokenStore)
+
+	performedAt := time.Date(2025, 3, 3, 18, 0, 0, 0, time.UTC)
+	weight := 102.5
+	_, err := workoutStore.CreateWorkout(&store.Workout{
+		Title:           "Push, heavy",
+		UserID:          user.ID,
+		PerformedAt:     performedAt,
+		DurationMinutes: 65,
+		Entries:         []store.WorkoutEntry{{ExerciseName: "Bench Press", Sets: 5, Reps: intPtr(5), Weight: &weight}},
+	})
+	require.NoError(t, err)
+
+	_, err = workoutStore.CreateWorkout(&store.Workout{Title: "not mine", UserID: intruder.ID, PerformedAt: performedAt})
+	require.NoError(t, err)
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	tomorrow = time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 0, 0, 0, 0, time.UTC)
+	programStore.planned[sessionKey{1, 1}] = &store.PlannedSession{
+		EnrollmentID: 1, SessionID: 1, ProgramName: "5/3/1", TemplateName: "Squat day", Week: 1, Day: 2, Date: tomorrow, UserID: user.ID,
+	}
+	programStore.planned[sessionKey{1, 2}] = &store.PlannedSession{
+		EnrollmentID: 1, SessionID: 2, ProgramName: "5/3/1", TemplateName: "Bench day", Date: tomorrow, Completed: true, UserID: user.ID,
+	}
+
+	rec := getCalendar(router, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = doRequest(t, router, user, http.MethodPost, "/users/me/calendar-token", nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var created struct {
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, "https://example.com/users/me/calendar.ics?token="+created.Token, created.URL)
+
+	// Auth tokens are not accepted in the feed URL.
+	authToken, err := tokenStore.CreateNewToken(user.ID, tokens.ScopeAuth, tokens.AuthTTL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, getCalendar(router, authToken.Plaintext).Code)
+
+	rec = getCalendar(router, created.Token)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	feed := rec.Body.String()
+	assert.Equal(t, 2, strings.Count(feed, "BEGIN:VEVENT"))
+	assert.Contains(t, feed, "UID:workout-1@api_exercise\r\n")
+	assert.Contains(t, feed, `SUMMARY:Push\, heavy`)
+	assert.Contains(t, feed, "DTSTART:20250303T180000Z\r\nDTEND:20250303T190500Z\r\n")
+	assert.Contains(t, feed, "DESCRIPTION:Bench Press: 5 x 5 @ 102.5 kg\r\n")
+	assert.Contains(t, feed, "SUMMARY:5/3/1: Squat day\r\n")
+	assert.Contains(t, feed, "DTSTART;VALUE=DATE:"+tomorrow.Format("20060102"))
+	assert.NotContains(t, feed, "Bench day")
+	assert.NotContains(t, feed, "not mine")
+
+	// Issuing a new token revokes the old URL.
+	rec = doRequest(t, router, user, http.MethodPost, "/users/me/calendar-token", nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, getCalendar(router, created.Token).Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+	rec = doRequest(t, router, user, http.MethodDelete, "/users/me/calendar-token", nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, getCalendar(router, created.Token).Code)
+	assert.Equal(t, 1, tokenStore.countForUser(user.ID, tokens.ScopeAuth))
+}
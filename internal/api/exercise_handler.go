@@ -0,0 +1,284 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/utils"
+)
+
+type ExerciseHandler struct {
+	exerciseStore store.ExerciseStore
+	logger        *log.Logger
+}
+
+// NewExerciseHandler Constructor
+func NewExerciseHandler(exerciseStore store.ExerciseStore, logger *log.Logger) *ExerciseHandler {
+	return &ExerciseHandler{
+		exerciseStore: exerciseStore,
+		logger:        logger,
+	}
+}
+
+// HandleSearchExercises GET /exercises?q=&category=&muscle=&limit=
+func (eh *ExerciseHandler) HandleSearchExercises(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	filter := store.ExerciseFilter{
+		Query:    strings.TrimSpace(utils.ReadString(qs, "q", "")),
+		Category: utils.ReadString(qs, "category", ""),
+		Muscle:   utils.ReadString(qs, "muscle", ""),
+	}
+
+	limit, err := utils.ReadInt(qs, "limit", 20)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if limit < 1 || limit > 100 {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "limit must be between 1 and 100"})
+		return
+	}
+
+	filter.Limit = limit
+
+	exercises, err := eh.exerciseStore.SearchExercises(filter)
+
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to search exercises"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"exercises": exercises})
+}
+
+// HandleGetExerciseByID GET /exercises/{id}
+func (eh *ExerciseHandler) HandleGetExerciseByID(w http.ResponseWriter, r *http.Request) {
+	exerciseID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid exercise ID"})
+		return
+	}
+
+	exercise, err := eh.exerciseStore.GetExerciseByID(exerciseID)
+
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve exercise"})
+		return
+	}
+
+	if exercise == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Exercise not found"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"exercise": exercise})
+}
+
+// HandleCreateExercise POST /exercises
+func (eh *ExerciseHandler) HandleCreateExercise(w http.ResponseWriter, r *http.Request) {
+	var exercise store.Exercise
+
+	err := json.NewDecoder(r.Body).Decode(&exercise)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	err = validateExercise(&exercise)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	userID := middleware.GetUser(r).ID
+	exercise.CreatedBy = &userID
+
+	err = eh.exerciseStore.CreateExercise(&exercise)
+
+	if errors.Is(err, store.ErrDuplicateExercise) {
+		_ = utils.WriteJson(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create exercise"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{"exercise": exercise})
+}
+
+// HandleUpdateExercise PUT /exercises/{id}
+//
+// Only the user who created an exercise can change it, and only while no
+// other user's workouts or templates reference it.
+func (eh *ExerciseHandler) HandleUpdateExercise(w http.ResponseWriter, r *http.Request) {
+	stored, ok := eh.loadOwnedExercise(w, r)
+
+	if !ok {
+		return
+	}
+
+	var exercise store.Exercise
+
+	err := json.NewDecoder(r.Body).Decode(&exercise)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	exercise.ID = stored.ID
+	exercise.CreatedBy = stored.CreatedBy
+
+	err = validateExercise(&exercise)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = eh.exerciseStore.UpdateExercise(&exercise)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Exercise not found"})
+		return
+	}
+
+	if errors.Is(err, store.ErrDuplicateExercise) || errors.Is(err, store.ErrExerciseInUse) {
+		_ = utils.WriteJson(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update exercise"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"exercise": exercise})
+}
+
+// HandleDeleteExercise DELETE /exercises/{id}
+func (eh *ExerciseHandler) HandleDeleteExercise(w http.ResponseWriter, r *http.Request) {
+	exercise, ok := eh.loadOwnedExercise(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := eh.exerciseStore.DeleteExercise(exercise.ID, *exercise.CreatedBy)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Exercise not found"})
+		return
+	}
+
+	if errors.Is(err, store.ErrExerciseInUse) {
+		_ = utils.WriteJson(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete exercise"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusNoContent, nil)
+}
+
+// loadOwnedExercise reads the {id} exercise and writes a 400, 404 or 403
+// response unless the authenticated user created it. Seeded catalog
+// exercises belong to no one and cannot be changed.
+func (eh *ExerciseHandler) loadOwnedExercise(w http.ResponseWriter, r *http.Request) (*store.Exercise, bool) {
+	exerciseID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid exercise ID"})
+		return nil, false
+	}
+
+	exercise, err := eh.exerciseStore.GetExerciseByID(exerciseID)
+
+	if err != nil {
+		eh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve exercise"})
+		return nil, false
+	}
+
+	if exercise == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Exercise not found"})
+		return nil, false
+	}
+
+	if exercise.CreatedBy == nil || *exercise.CreatedBy != middleware.GetUser(r).ID {
+		_ = utils.WriteJson(w, http.StatusForbidden, utils.Envelope{"error": "You do not have permission to change this exercise"})
+		return nil, false
+	}
+
+	return exercise, true
+}
+
+// validateExercise trims the input and lowercases muscle groups so that the
+// muscle filter can match them exactly.
+func validateExercise(exercise *store.Exercise) error {
+	exercise.Name = strings.TrimSpace(exercise.Name)
+	exercise.Category = strings.ToLower(strings.TrimSpace(exercise.Category))
+	exercise.Equipment = strings.TrimSpace(exercise.Equipment)
+
+	if exercise.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if exercise.Category == "" {
+		return errors.New("category is required")
+	}
+
+	if exercise.Aliases == nil {
+		exercise.Aliases = []string{}
+	}
+
+	if exercise.PrimaryMuscleGroups == nil {
+		exercise.PrimaryMuscleGroups = []string{}
+	}
+
+	if exercise.SecondaryMuscleGroups == nil {
+		exercise.SecondaryMuscleGroups = []string{}
+	}
+
+	for i, alias := range exercise.Aliases {
+		exercise.Aliases[i] = strings.TrimSpace(alias)
+
+		if exercise.Aliases[i] == "" {
+			return errors.New("aliases must not be empty")
+		}
+	}
+
+	for _, groups := range [][]string{exercise.PrimaryMuscleGroups, exercise.SecondaryMuscleGroups} {
+		for i, group := range groups {
+			groups[i] = strings.ToLower(strings.TrimSpace(group))
+
+			if groups[i] == "" {
+				return errors.New("muscle groups must not be empty")
+			}
+		}
+	}
+
+	return nil
+}
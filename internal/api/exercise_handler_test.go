@@ -0,0 +1,144 @@
+package api
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeExerciseStore struct {
+	exercises map[int]*store.Exercise
+	inUse     map[int]bool
+	nextID    int
+}
+
+func newFakeExerciseStore() *fakeExerciseStore {
+	return &fakeExerciseStore{exercises: map[int]*store.Exercise{}, inUse: map[int]bool{}, nextID: 1}
+}
+
+func (s *fakeExerciseStore) CreateExercise(exercise *store.Exercise) error {
+	exercise.ID = s.nextID
+	s.nextID++
+	stored := *exercise
+	s.exercises[exercise.ID] = &stored
+	return nil
+}
+
+func (s *fakeExerciseStore) GetExerciseByID(id int) (*store.Exercise, error) {
+	exercise, ok := s.exercises[id]
+
+	if !ok {
+		return nil, nil
+	}
+
+	found := *exercise
+	return &found, nil
+}
+
+func (s *fakeExerciseStore) owned(id int, userID *int) error {
+	existing, ok := s.exercises[id]
+
+	if !ok || existing.CreatedBy == nil || userID == nil || *existing.CreatedBy != *userID {
+		return sql.ErrNoRows
+	}
+
+	if s.inUse[id] {
+		return store.ErrExerciseInUse
+	}
+
+	return nil
+}
+
+func (s *fakeExerciseStore) UpdateExercise(exercise *store.Exercise) error {
+	if err := s.owned(exercise.ID, exercise.CreatedBy); err != nil {
+		return err
+	}
+
+	stored := *exercise
+	s.exercises[exercise.ID] = &stored
+	return nil
+}
+
+func (s *fakeExerciseStore) DeleteExercise(id, userID int) error {
+	if err := s.owned(id, &userID); err != nil {
+		return err
+	}
+
+	delete(s.exercises, id)
+	return nil
+}
+
+func (s *fakeExerciseStore) SearchExercises(filter store.ExerciseFilter) ([]*store.Exercise, error) {
+	exercises := []*store.Exercise{}
+
+	for id := 1; id < s.nextID; id++ {
+		if exercise, ok := s.exercises[id]; ok {
+			exercises = append(exercises, exercise)
+		}
+	}
+
+	return exercises, nil
+}
+
+func setupExerciseRouter(exerciseStore store.ExerciseStore) http.Handler {
+	handler := NewExerciseHandler(exerciseStore, log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Post("/exercises", handler.HandleCreateExercise)
+	r.Get("/exercises/{id}", handler.HandleGetExerciseByID)
+	r.Put("/exercises/{id}", handler.HandleUpdateExercise)
+	r.Delete("/exercises/{id}", handler.HandleDeleteExercise)
+
+	return r
+}
+
+func TestExerciseCatalogPermissions(t *testing.T) {
+	exerciseStore := newFakeExerciseStore()
+	router := setupExerciseRouter(exerciseStore)
+
+	// Seeded catalog entries have no creator.
+	require.NoError(t, exerciseStore.CreateExercise(&store.Exercise{Name: "Bench Press", Category: "strength"}))
+
+	update := store.Exercise{Name: "Renamed", Category: "strength"}
+
+	assert.Equal(t, http.StatusForbidden, doRequest(t, router, owner, http.MethodPut, "/exercises/1", update).Code)
+	assert.Equal(t, http.StatusForbidden, doRequest(t, router, owner, http.MethodDelete, "/exercises/1", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, router, owner, http.MethodDelete, "/exercises/99", nil).Code)
+
+	rec := doRequest(t, router, owner, http.MethodPost, "/exercises", store.Exercise{Name: "Zercher Squat", Category: "strength"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	created, err := exerciseStore.GetExerciseByID(2)
+	require.NoError(t, err)
+	require.NotNil(t, created.CreatedBy)
+	assert.Equal(t, owner.ID, *created.CreatedBy)
+
+	assert.Equal(t, http.StatusForbidden, doRequest(t, router, intruder, http.MethodPut, "/exercises/2", update).Code)
+	assert.Equal(t, http.StatusForbidden, doRequest(t, router, intruder, http.MethodDelete, "/exercises/2", nil).Code)
+
+	exerciseStore.inUse[2] = true
+	assert.Equal(t, http.StatusConflict, doRequest(t, router, owner, http.MethodPut, "/exercises/2", update).Code)
+	assert.Equal(t, http.StatusConflict, doRequest(t, router, owner, http.MethodDelete, "/exercises/2", nil).Code)
+
+	exerciseStore.inUse[2] = false
+	rec = doRequest(t, router, owner, http.MethodPut, "/exercises/2", update)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	updated, err := exerciseStore.GetExerciseByID(2)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", updated.Name)
+	assert.Equal(t, owner.ID, *updated.CreatedBy)
+
+	assert.Equal(t, http.StatusNoContent, doRequest(t, router, owner, http.MethodDelete, "/exercises/2", nil).Code)
+
+	seeded, err := exerciseStore.GetExerciseByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, "Bench Press", seeded.Name)
+}
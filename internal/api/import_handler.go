@@ -0,0 +1,726 @@
+package api
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/importer"
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/utils"
+)
+
+const (
+	maxImportBytes = 10 << 20
+	// importBatchSize is the number of workouts stored per transaction.
+	importBatchSize = 100
+)
+
+// csvColumns is the header written by the export and understood by the import.
+var csvColumns = []string{
+	"workout_id", "title", "description", "performed_at", "started_at", "ended_at", "duration_minutes", "calories_burned",
+	"exercise_id", "exercise_name", "sets", "reps", "duration_seconds", "weight", "notes", "order_index",
+	"distance_meters", "elevation_gain_meters", "avg_heart_rate", "max_heart_rate",
+}
+
+// csvColumnAliases maps other common header names onto csvColumns.
+var csvColumnAliases = map[string]string{
+	"workout":       "title",
+	"workout_name":  "title",
+	"date":          "performed_at",
+	"exercise":      "exercise_name",
+	"seconds":       "duration_seconds",
+	"duration":      "duration_minutes",
+	"calories":      "calories_burned",
+	"workout_notes": "description",
+}
+
+type ImportHandler struct {
+	workoutStore store.WorkoutStore
+	logger       *log.Logger
+}
+
+// NewImportHandler Constructor
+func NewImportHandler(workoutStore store.WorkoutStore, logger *log.Logger) *ImportHandler {
+	return &ImportHandler{
+		workoutStore: workoutStore,
+		logger:       logger,
+	}
+}
+
+// HandleExportWorkouts GET /workouts/export?format=csv
+//
+// Streams one row per entry, repeating the workout columns on every row.
+// Workouts without entries are exported as a single row with empty entry
+// columns.
+func (ih *ImportHandler) HandleExportWorkouts(w http.ResponseWriter, r *http.Request) {
+	format := utils.ReadString(r.URL.Query(), "format", "csv")
+
+	if format != "csv" {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "format must be csv"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="workouts.csv"`)
+
+	writer := csv.NewWriter(w)
+	_ = writer.Write(csvColumns)
+
+	err := ih.workoutStore.ExportWorkouts(middleware.GetUser(r).ID, func(workout *store.Workout) error {
+		if len(workout.Entries) == 0 {
+			return writer.Write(workoutCSVRecord(workout, nil))
+		}
+
+		for i := range workout.Entries {
+			err := writer.Write(workoutCSVRecord(workout, &workout.Entries[i]))
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		writer.Flush()
+		err = writer.Error()
+	}
+
+	// The status line has already been sent, so a failure can only be logged.
+	if err != nil {
+		ih.logger.Printf("ERROR: exporting workouts: %v", err)
+	}
+}
+
+// HandleImportWorkouts POST /workouts/import?source=csv|strong|hevy&dry_run=true
+//
+// Accepts a multipart upload with a "file" field holding either this API's
+// own CSV export or an export of the Strong or Hevy apps. Invalid rows are
+// skipped and reported; the remaining workouts are stored in batches of
+// importBatchSize. With dry_run the parsed workouts are returned without
+// being stored.
+func (ih *ImportHandler) HandleImportWorkouts(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	source := utils.ReadString(qs, "source", "csv")
+
+	if source != "csv" && source != importer.SourceStrong && source != importer.SourceHevy {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "source must be one of csv, strong, hevy"})
+		return
+	}
+
+	dryRun, err := utils.ReadBool(qs, "dry_run", false)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	file, ok := ih.readUpload(w, r)
+
+	if !ok {
+		return
+	}
+
+	defer func() { _ = file.Close() }()
+
+	userID := middleware.GetUser(r).ID
+
+	var result *importer.Result
+
+	if source == "csv" {
+		result, err = parseWorkoutCSV(file, userID)
+	} else {
+		result, err = importer.Parse(source, file, userID)
+	}
+
+	var maxBytesErr *http.MaxBytesError
+
+	if errors.As(err, &maxBytesErr) {
+		_ = utils.WriteJson(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "upload is too large"})
+		return
+	}
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	workouts, rowErrors := validateImport(result)
+
+	if dryRun {
+		previews := make([]*store.Workout, len(workouts))
+
+		for i, parsed := range workouts {
+			previews[i] = parsed.Workout
+		}
+
+		_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{
+			"dry_run":         true,
+			"workouts":        previews,
+			"ignored_columns": result.IgnoredColumns,
+			"errors":          rowErrors,
+		})
+		return
+	}
+
+	imported, entries := 0, 0
+
+	for batch := range slices.Chunk(workouts, importBatchSize) {
+		batchWorkouts := make([]*store.Workout, len(batch))
+
+		for i, parsed := range batch {
+			batchWorkouts[i] = parsed.Workout
+		}
+
+		err = ih.workoutStore.CreateWorkouts(batchWorkouts)
+
+		if err != nil {
+			ih.logger.Printf("ERROR: importing workouts: %v", err)
+
+			for _, parsed := range batch {
+				for _, row := range parsed.Rows {
+					rowErrors = append(rowErrors, importer.RowError{Row: row, Error: "failed to save workout"})
+				}
+			}
+
+			continue
+		}
+
+		for _, workout := range batchWorkouts {
+			imported++
+			entries += len(workout.Entries)
+		}
+	}
+
+	sortRowErrors(rowErrors)
+
+	status := http.StatusCreated
+
+	if imported == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	_ = utils.WriteJson(w, status, utils.Envelope{
+		"imported_workouts": imported,
+		"imported_entries":  entries,
+		"ignored_columns":   result.IgnoredColumns,
+		"errors":            rowErrors,
+	})
+}
+
+// HandleImportGPX POST /workouts/import/gpx?dry_run=true
+//
+// Accepts a multipart upload with a "file" field holding a GPX 1.1 file and
+// stores it as a cardio workout together with its track points.
+func (ih *ImportHandler) HandleImportGPX(w http.ResponseWriter, r *http.Request) {
+	ih.importRecording(w, r, importer.ParseGPX)
+}
+
+// HandleImportFIT POST /workouts/import/fit?dry_run=true
+//
+// Accepts a multipart upload with a "file" field holding a Garmin FIT
+// activity file and stores it as a cardio workout together with its track
+// points.
+func (ih *ImportHandler) HandleImportFIT(w http.ResponseWriter, r *http.Request) {
+	ih.importRecording(w, r, importer.ParseFIT)
+}
+
+func (ih *ImportHandler) importRecording(w http.ResponseWriter, r *http.Request, parse func(io.Reader, int) (*store.Workout, error)) {
+	dryRun, err := utils.ReadBool(r.URL.Query(), "dry_run", false)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	file, ok := ih.readUpload(w, r)
+
+	if !ok {
+		return
+	}
+
+	defer func() { _ = file.Close() }()
+
+	workout, err := parse(file, middleware.GetUser(r).ID)
+
+	var maxBytesErr *http.MaxBytesError
+
+	if errors.As(err, &maxBytesErr) {
+		_ = utils.WriteJson(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "upload is too large"})
+		return
+	}
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = validateWorkout(workout)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if dryRun {
+		_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"dry_run": true, "workout": workout})
+		return
+	}
+
+	createdWorkout, err := ih.workoutStore.CreateWorkout(workout)
+
+	if err != nil {
+		ih.logger.Printf("ERROR: importing recording: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create workout"})
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(createdWorkout))
+	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
+}
+
+// validateImport drops the parsed workouts that would fail validateWorkout and
+// reports every row they were built from.
+func validateImport(result *importer.Result) ([]*importer.Workout, []importer.RowError) {
+	workouts := []*importer.Workout{}
+	rowErrors := result.Errors
+
+	for _, parsed := range result.Workouts {
+		err := validateWorkout(parsed.Workout)
+
+		if err != nil {
+			for _, row := range parsed.Rows {
+				rowErrors = append(rowErrors, importer.RowError{Row: row, Error: err.Error()})
+			}
+
+			continue
+		}
+
+		workouts = append(workouts, parsed)
+	}
+
+	sortRowErrors(rowErrors)
+	return workouts, rowErrors
+}
+
+func sortRowErrors(rowErrors []importer.RowError) {
+	slices.SortStableFunc(rowErrors, func(a, b importer.RowError) int { return cmp.Compare(a.Row, b.Row) })
+}
+
+// readUpload returns the "file" part of a multipart upload or writes a 400 or
+// 413 response.
+func (ih *ImportHandler) readUpload(w http.ResponseWriter, r *http.Request) (io.ReadCloser, bool) {
+	err := r.ParseMultipartForm(1 << 20)
+
+	var maxBytesErr *http.MaxBytesError
+
+	if errors.As(err, &maxBytesErr) {
+		_ = utils.WriteJson(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "upload is too large"})
+		return nil, false
+	}
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "expected a multipart/form-data upload"})
+		return nil, false
+	}
+
+	file, _, err := r.FormFile("file")
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "the upload must contain a file field"})
+		return nil, false
+	}
+
+	return file, true
+}
+
+func workoutCSVRecord(workout *store.Workout, entry *store.WorkoutEntry) []string {
+	record := []string{
+		strconv.Itoa(workout.ID),
+		workout.Title,
+		workout.Description,
+		workout.PerformedAt.Format(time.RFC3339),
+		formatOptionalTime(workout.StartedAt),
+		formatOptionalTime(workout.EndedAt),
+		strconv.Itoa(workout.DurationMinutes),
+		strconv.Itoa(workout.CaloriesBurned),
+	}
+
+	if entry == nil {
+		return append(record, make([]string, len(csvColumns)-len(record))...)
+	}
+
+	return append(record,
+		formatOptionalInt(entry.ExerciseID),
+		entry.ExerciseName,
+		strconv.Itoa(entry.Sets),
+		formatOptionalInt(entry.Reps),
+		formatOptionalInt(entry.DurationSeconds),
+		formatOptionalFloat(entry.Weight),
+		entry.Notes,
+		strconv.Itoa(entry.OrderIndex),
+		formatOptionalFloat(entry.DistanceMeters),
+		formatOptionalFloat(entry.ElevationGainMeters),
+		formatOptionalInt(entry.AvgHeartRate),
+		formatOptionalInt(entry.MaxHeartRate),
+	)
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func formatOptionalInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+
+	return strconv.Itoa(*i)
+}
+
+func formatOptionalFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+// importedWorkout is a workout assembled from one or more CSV rows.
+type importedWorkout struct {
+	workout *importer.Workout
+	// orderIndexes holds the order_index column of each entry, if given.
+	orderIndexes []int
+}
+
+// parseWorkoutCSV groups the rows of a CSV file into workouts for userID. It
+// only fails when the file itself is unusable; invalid rows are returned as
+// row errors instead. The returned columns are the header names that were
+// not used.
+func parseWorkoutCSV(r io.Reader, userID int) (*importer.Result, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file is empty")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns, ignored := mapCSVColumns(header)
+
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("the file has no title column")
+	}
+
+	workouts := []*importedWorkout{}
+	workoutsByKey := map[string]*importedWorkout{}
+	rowErrors := []importer.RowError{}
+
+	for {
+		record, err := reader.Read()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var parseErr *csv.ParseError
+
+		if errors.As(err, &parseErr) {
+			rowErrors = append(rowErrors, importer.RowError{Row: parseErr.Line, Error: parseErr.Err.Error()})
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := csvRow{columns: columns, record: record}
+
+		if row.empty() {
+			continue
+		}
+
+		key := row.get("workout_id")
+
+		if key == "" {
+			key = row.get("title") + "\x00" + row.get("performed_at")
+		}
+
+		parsed, ok := workoutsByKey[key]
+
+		if !ok {
+			workout, err := row.workout(userID)
+
+			if err == nil {
+				err = validateWorkout(workout)
+			}
+
+			if err != nil {
+				rowErrors = append(rowErrors, importer.RowError{Row: line, Error: err.Error()})
+				// Keep the key so that the workout's other rows are reported too.
+				workoutsByKey[key] = &importedWorkout{}
+				continue
+			}
+
+			parsed = &importedWorkout{workout: &importer.Workout{Workout: workout}}
+			workoutsByKey[key] = parsed
+			workouts = append(workouts, parsed)
+		}
+
+		if parsed.workout == nil {
+			rowErrors = append(rowErrors, importer.RowError{Row: line, Error: "the row's workout is invalid"})
+			continue
+		}
+
+		parsed.workout.Rows = append(parsed.workout.Rows, line)
+
+		if row.get("exercise_name") == "" && row.entryEmpty() {
+			continue
+		}
+
+		entry, orderIndex, err := row.entry()
+
+		if err == nil {
+			err = validateEntry(entry)
+		}
+
+		if err != nil {
+			rowErrors = append(rowErrors, importer.RowError{Row: line, Error: err.Error()})
+			continue
+		}
+
+		parsed.workout.Workout.Entries = append(parsed.workout.Workout.Entries, entry)
+		parsed.orderIndexes = append(parsed.orderIndexes, orderIndex)
+	}
+
+	result := &importer.Result{Workouts: make([]*importer.Workout, len(workouts)), Errors: rowErrors, IgnoredColumns: ignored}
+
+	for i, parsed := range workouts {
+		parsed.orderEntries()
+		result.Workouts[i] = parsed.workout
+	}
+
+	return result, nil
+}
+
+// orderEntries sorts the entries by their order_index column, keeping file
+// order for ties, and renumbers them from 1.
+func (p *importedWorkout) orderEntries() {
+	order := make([]int, len(p.workout.Workout.Entries))
+
+	for i := range order {
+		order[i] = i
+	}
+
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(p.orderIndexes[a], p.orderIndexes[b]) })
+
+	entries := make([]store.WorkoutEntry, len(order))
+
+	for i, index := range order {
+		entries[i] = p.workout.Workout.Entries[index]
+		entries[i].OrderIndex = i + 1
+	}
+
+	p.workout.Workout.Entries = entries
+}
+
+// mapCSVColumns returns the index of each known column and the header names
+// that matched none of them.
+func mapCSVColumns(header []string) (map[string]int, []string) {
+	columns := map[string]int{}
+	ignored := []string{}
+
+	for i, name := range header {
+		normalized := strings.ToLower(strings.TrimSpace(name))
+		normalized = strings.NewReplacer(" ", "_", "-", "_").Replace(strings.TrimPrefix(normalized, "\ufeff"))
+
+		if alias, ok := csvColumnAliases[normalized]; ok {
+			normalized = alias
+		}
+
+		// exercise_id is only exported for reference. The import resolves it
+		// from exercise_name, so an unknown ID cannot fail a whole batch.
+		if _, known := columns[normalized]; known || !slices.Contains(csvColumns, normalized) || normalized == "exercise_id" {
+			ignored = append(ignored, name)
+			continue
+		}
+
+		columns[normalized] = i
+	}
+
+	return columns, ignored
+}
+
+type csvRow struct {
+	columns map[string]int
+	record  []string
+}
+
+func (r csvRow) get(column string) string {
+	index, ok := r.columns[column]
+
+	if !ok || index >= len(r.record) {
+		return ""
+	}
+
+	return strings.TrimSpace(r.record[index])
+}
+
+func (r csvRow) empty() bool {
+	for _, value := range r.record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r csvRow) entryEmpty() bool {
+	for _, column := range []string{"sets", "reps", "duration_seconds", "weight", "notes", "distance_meters"} {
+		if r.get(column) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r csvRow) workout(userID int) (*store.Workout, error) {
+	workout := &store.Workout{
+		UserID:      userID,
+		Title:       r.get("title"),
+		Description: r.get("description"),
+		Entries:     []store.WorkoutEntry{},
+	}
+
+	var err error
+
+	if performedAt := r.optionalTime("performed_at", &err); performedAt != nil {
+		workout.PerformedAt = *performedAt
+	}
+
+	workout.StartedAt = r.optionalTime("started_at", &err)
+	workout.EndedAt = r.optionalTime("ended_at", &err)
+
+	if duration := r.optionalInt("duration_minutes", &err); duration != nil {
+		workout.DurationMinutes = *duration
+	}
+
+	if calories := r.optionalInt("calories_burned", &err); calories != nil {
+		workout.CaloriesBurned = *calories
+	}
+
+	return workout, err
+}
+
+func (r csvRow) entry() (store.WorkoutEntry, int, error) {
+	var err error
+
+	entry := store.WorkoutEntry{
+		ExerciseName:    r.get("exercise_name"),
+		Reps:            r.optionalInt("reps", &err),
+		DurationSeconds: r.optionalInt("duration_seconds", &err),
+		Weight:          r.optionalFloat("weight", &err),
+		Notes:           r.get("notes"),
+	}
+
+	entry.DistanceMeters = r.optionalFloat("distance_meters", &err)
+	entry.ElevationGainMeters = r.optionalFloat("elevation_gain_meters", &err)
+	entry.AvgHeartRate = r.optionalInt("avg_heart_rate", &err)
+	entry.MaxHeartRate = r.optionalInt("max_heart_rate", &err)
+
+	if sets := r.optionalInt("sets", &err); sets != nil {
+		entry.Sets = *sets
+	}
+
+	orderIndex := 0
+
+	if index := r.optionalInt("order_index", &err); index != nil {
+		orderIndex = *index
+	}
+
+	return entry, orderIndex, err
+}
+
+// The optional* helpers parse a column that may be blank. They keep the first
+// error in *err so that a row reports one problem at a time.
+
+func (r csvRow) optionalInt(column string, err *error) *int {
+	value := r.get(column)
+
+	if value == "" || *err != nil {
+		return nil
+	}
+
+	i, parseErr := strconv.Atoi(value)
+
+	if parseErr != nil {
+		*err = fmt.Errorf("%s must be an integer", column)
+		return nil
+	}
+
+	return &i
+}
+
+func (r csvRow) optionalFloat(column string, err *error) *float64 {
+	value := r.get(column)
+
+	if value == "" || *err != nil {
+		return nil
+	}
+
+	f, parseErr := strconv.ParseFloat(value, 64)
+
+	if parseErr != nil {
+		*err = fmt.Errorf("%s must be a number", column)
+		return nil
+	}
+
+	return &f
+}
+
+func (r csvRow) optionalTime(column string, err *error) *time.Time {
+	value := r.get(column)
+
+	if value == "" || *err != nil {
+		return nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		t, parseErr := time.Parse(layout, value)
+
+		if parseErr == nil {
+			return &t
+		}
+	}
+
+	*err = fmt.Errorf("%s must be a date (YYYY-MM-DD) or an RFC 3339 timestamp", column)
+	return nil
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/importer"
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupImportRouter(workoutStore store.WorkoutStore) http.Handler {
+	handler := NewImportHandler(workoutStore, log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Get("/workouts/export", handler.HandleExportWorkouts)
+	r.Post("/workouts/import", handler.HandleImportWorkouts)
+	r.Post("/workouts/import/gpx", handler.HandleImportGPX)
+	r.Post("/workouts/import/fit", handler.HandleImportFIT)
+
+	return r
+}
+
+func doUpload(t *testing.T, handler http.Handler, user *store.User, target, content string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "workouts.csv")
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = middleware.SetUser(req, user)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+type importReport struct {
+	ImportedWorkouts int                 `json:"imported_workouts"`
+	ImportedEntries  int                 `json:"imported_entries"`
+	IgnoredColumns   []string            `json:"ignored_columns"`
+	Errors           []importer.RowError `json:"errors"`
+}
+
+func TestImportWorkoutsCSV(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupImportRouter(workoutStore)
+
+	content := `Date,Workout,Exercise,Sets,Reps,Seconds,Weight,Notes,RPE
+2025-03-03,Push,Bench Press,5,5,,100,,8
+2025-03-03,Push,Dip,3,10,,,,
+2025-03-03,Push,Plank,3,,60,,,
+2025-03-03,Push,Bench Press,3,5,30,,both reps and seconds,
+2025-03-05,Legs,Back Squat,five,5,,140,,
+2025-03-05,Legs,Back Squat,5,5,,140,,
+,,,,,,,,
+2025-03-07,,Deadlift,1,1,,200,,
+`
+
+	rec := doUpload(t, router, owner, "/workouts/import", content)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var report importReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, 2, report.ImportedWorkouts)
+	assert.Equal(t, 4, report.ImportedEntries)
+	assert.Equal(t, []string{"RPE"}, report.IgnoredColumns)
+	assert.Equal(t, []importer.RowError{
+		{Row: 5, Error: "exactly one of reps or duration_seconds is required"},
+		{Row: 6, Error: "sets must be an integer"},
+		{Row: 9, Error: "title is required"},
+	}, report.Errors)
+
+	push, err := workoutStore.GetWorkoutByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, owner.ID, push.UserID)
+	assert.Equal(t, time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), push.PerformedAt)
+	require.Len(t, push.Entries, 3)
+	assert.Equal(t, "Plank", push.Entries[2].ExerciseName)
+	assert.Equal(t, 3, push.Entries[2].OrderIndex)
+
+	rec = doUpload(t, router, owner, "/workouts/import", "exercise,reps\nBench Press,5\n")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPost, "/workouts/import", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestExportWorkoutsCSVRoundTrip(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupImportRouter(workoutStore)
+	weight := 102.5
+
+	_, err := workoutStore.CreateWorkout(&store.Workout{
+		Title:       "push, heavy",
+		Description: "felt \"great\"",
+		UserID:      owner.ID,
+		PerformedAt: time.Date(2025, 3, 3, 18, 0, 0, 0, time.UTC),
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Bench Press", Sets: 5, Reps: intPtr(5), Weight: &weight, OrderIndex: 1},
+			{ExerciseName: "Plank", Sets: 3, DurationSeconds: intPtr(60), Notes: "line one\nline two", OrderIndex: 2},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = workoutStore.CreateWorkout(&store.Workout{Title: "rest day", UserID: owner.ID, PerformedAt: time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+
+	_, err = workoutStore.CreateWorkout(&store.Workout{Title: "not mine", UserID: intruder.ID, PerformedAt: time.Now()})
+	require.NoError(t, err)
+
+	rec := doRequest(t, router, owner, http.MethodGet, "/workouts/export?format=xlsx", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts/export?format=csv", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	exported := rec.Body.String()
+	records, err := csv.NewReader(bytes.NewReader(rec.Body.Bytes())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, csvColumns, records[0])
+	assert.Equal(t, "push, heavy", records[1][1])
+	assert.Equal(t, "102.5", records[1][13])
+	assert.Equal(t, "rest day", records[3][1])
+	assert.Empty(t, records[3][9])
+
+	imported := newFakeWorkoutStore()
+	rec = doUpload(t, setupImportRouter(imported), intruder, "/workouts/import", exported)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var report importReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, 2, report.ImportedWorkouts)
+	assert.Equal(t, 2, report.ImportedEntries)
+	assert.Equal(t, []string{"exercise_id"}, report.IgnoredColumns)
+	assert.Empty(t, report.Errors)
+
+	push, err := imported.GetWorkoutByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, intruder.ID, push.UserID)
+	assert.Equal(t, `felt "great"`, push.Description)
+	require.Len(t, push.Entries, 2)
+	assert.Equal(t, 102.5, *push.Entries[0].Weight)
+	assert.Equal(t, "line one\nline two", push.Entries[1].Notes)
+
+	restDay, err := imported.GetWorkoutByID(2)
+	require.NoError(t, err)
+	assert.Empty(t, restDay.Entries)
+}
+
+func TestImportStrongDryRun(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupImportRouter(workoutStore)
+
+	content := `Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+2025-03-03 18:00:00,Push,1h 5m,Bench Press,1,100,5,0,0,,,
+2025-03-03 18:00:00,Push,1h 5m,Bench Press,2,100,5,0,0,,,
+2025-03-03 18:00:00,Push,1h 5m,Bench Press,3,1200,5,0,0,,,
+`
+
+	rec := doUpload(t, router, owner, "/workouts/import?source=fitbod", content)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doUpload(t, router, owner, "/workouts/import?source=strong&dry_run=true", content)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var preview struct {
+		DryRun   bool                `json:"dry_run"`
+		Workouts []store.Workout     `json:"workouts"`
+		Errors   []importer.RowError `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &preview))
+	assert.True(t, preview.DryRun)
+	assert.Empty(t, preview.Workouts)
+	require.Len(t, preview.Errors, 3)
+	assert.Equal(t, "entries[1]: weight must be between 0 and 999.99", preview.Errors[0].Error)
+	assert.Empty(t, workoutStore.workouts)
+
+	content = strings.Replace(content, "1200", "102.5", 1)
+
+	rec = doUpload(t, router, owner, "/workouts/import?source=strong&dry_run=1", content)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &preview))
+	require.Len(t, preview.Workouts, 1)
+	assert.Empty(t, preview.Errors)
+	assert.Equal(t, 65, preview.Workouts[0].DurationMinutes)
+	assert.Empty(t, workoutStore.workouts)
+
+	rec = doUpload(t, router, owner, "/workouts/import?source=strong", content)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	workout, err := workoutStore.GetWorkoutByID(1)
+	require.NoError(t, err)
+	require.Len(t, workout.Entries, 2)
+	assert.Equal(t, 2, workout.Entries[0].Sets)
+	assert.Equal(t, 102.5, *workout.Entries[1].Weight)
+}
+
+func TestImportGPXAndReadTrack(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupImportRouter(workoutStore)
+
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk>
+    <name>Lunch Ride</name>
+    <type>cycling</type>
+    <trkseg>
+      <trkpt lat="45.00" lon="19.00"><ele>80</ele><time>2025-06-01T12:00:00Z</time></trkpt>
+      <trkpt lat="45.10" lon="19.00"><ele>95</ele><time>2025-06-01T12:45:00Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+	rec := doUpload(t, router, owner, "/workouts/import/gpx", "not a gpx file")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = doUpload(t, router, owner, "/workouts/import/fit", content)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = doUpload(t, router, owner, "/workouts/import/gpx?dry_run=true", content)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Empty(t, workoutStore.workouts)
+
+	rec = doUpload(t, router, owner, "/workouts/import/gpx", content)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.NotEmpty(t, rec.Header().Get("ETag"))
+
+	var created struct {
+		Workout store.Workout `json:"workout"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, "Lunch Ride", created.Workout.Title)
+	assert.Equal(t, 45, created.Workout.DurationMinutes)
+	require.Len(t, created.Workout.Entries, 1)
+	assert.Equal(t, "Cycling", created.Workout.Entries[0].ExerciseName)
+	assert.InDelta(t, 11120, *created.Workout.Entries[0].DistanceMeters, 5)
+	assert.Equal(t, 15.0, *created.Workout.Entries[0].ElevationGainMeters)
+
+	workouts := setupWorkoutRouter(workoutStore)
+	target := fmt.Sprintf("/workouts/%d/track", created.Workout.ID)
+
+	rec = doRequest(t, workouts, intruder, http.MethodGet, target, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequest(t, workouts, owner, http.MethodGet, target, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var track struct {
+		TrackPoints []store.TrackPoint `json:"track_points"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &track))
+	require.Len(t, track.TrackPoints, 2)
+	assert.Equal(t, 95.0, *track.TrackPoints[1].ElevationMeters)
+}
@@ -0,0 +1,491 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/utils"
+)
+
+// maxScheduleDays caps the range of a single schedule request.
+const maxScheduleDays = 366
+
+type ProgramHandler struct {
+	programStore  store.ProgramStore
+	templateStore store.TemplateStore
+	logger        *log.Logger
+}
+
+// NewProgramHandler Constructor
+func NewProgramHandler(programStore store.ProgramStore, templateStore store.TemplateStore, logger *log.Logger) *ProgramHandler {
+	return &ProgramHandler{
+		programStore:  programStore,
+		templateStore: templateStore,
+		logger:        logger,
+	}
+}
+
+// HandleGetPrograms GET /programs
+//
+// Lists the published programs and the user's own.
+func (ph *ProgramHandler) HandleGetPrograms(w http.ResponseWriter, r *http.Request) {
+	programs, err := ph.programStore.GetPrograms(middleware.GetUser(r).ID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve programs"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"programs": programs})
+}
+
+// HandleGetProgramByID GET /programs/{id}
+func (ph *ProgramHandler) HandleGetProgramByID(w http.ResponseWriter, r *http.Request) {
+	program, ok := ph.loadProgram(w, r)
+
+	if !ok {
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"program": program})
+}
+
+// HandleCreateProgram POST /programs
+func (ph *ProgramHandler) HandleCreateProgram(w http.ResponseWriter, r *http.Request) {
+	var program store.Program
+
+	err := json.NewDecoder(r.Body).Decode(&program)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	program.UserID = middleware.GetUser(r).ID
+
+	err = validateProgram(&program)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = ph.programStore.CreateProgram(&program)
+
+	if errors.Is(err, store.ErrTemplateNotFound) {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create program"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{"program": program})
+}
+
+// HandleUpdateProgram PUT /programs/{id}
+func (ph *ProgramHandler) HandleUpdateProgram(w http.ResponseWriter, r *http.Request) {
+	stored, ok := ph.loadAuthoredProgram(w, r)
+
+	if !ok {
+		return
+	}
+
+	var program store.Program
+
+	err := json.NewDecoder(r.Body).Decode(&program)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	program.ID = stored.ID
+	program.UserID = stored.UserID
+
+	err = validateProgram(&program)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = ph.programStore.UpdateProgram(&program)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Program not found"})
+		return
+	}
+
+	if errors.Is(err, store.ErrTemplateNotFound) || errors.Is(err, store.ErrSessionNotFound) {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update program"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"program": program})
+}
+
+// HandleDeleteProgram DELETE /programs/{id}
+func (ph *ProgramHandler) HandleDeleteProgram(w http.ResponseWriter, r *http.Request) {
+	program, ok := ph.loadAuthoredProgram(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := ph.programStore.DeleteProgram(program.ID, program.UserID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Program not found"})
+		return
+	}
+
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete program"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusNoContent, nil)
+}
+
+type enrollRequest struct {
+	StartDate string `json:"start_date"`
+}
+
+// HandleEnroll POST /programs/{id}/enrollments
+//
+// Only published programs and the user's own can be enrolled in.
+func (ph *ProgramHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	program, ok := ph.loadProgram(w, r)
+
+	if !ok {
+		return
+	}
+
+	var req enrollRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	startDate, err := time.Parse(time.DateOnly, req.StartDate)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "start_date must be a date (YYYY-MM-DD)"})
+		return
+	}
+
+	enrollment := &store.Enrollment{
+		UserID:      middleware.GetUser(r).ID,
+		ProgramID:   program.ID,
+		ProgramName: program.Name,
+		StartDate:   startDate,
+	}
+
+	err = ph.programStore.Enroll(enrollment)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to enroll in program"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{"enrollment": enrollment})
+}
+
+// HandleGetEnrollments GET /users/me/enrollments
+func (ph *ProgramHandler) HandleGetEnrollments(w http.ResponseWriter, r *http.Request) {
+	enrollments, err := ph.programStore.GetEnrollmentsForUser(middleware.GetUser(r).ID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve enrollments"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"enrollments": enrollments})
+}
+
+// HandleDeleteEnrollment DELETE /users/me/enrollments/{id}
+func (ph *ProgramHandler) HandleDeleteEnrollment(w http.ResponseWriter, r *http.Request) {
+	enrollmentID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid enrollment ID"})
+		return
+	}
+
+	err = ph.programStore.DeleteEnrollment(enrollmentID, middleware.GetUser(r).ID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Enrollment not found"})
+		return
+	}
+
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete enrollment"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusNoContent, nil)
+}
+
+// HandleGetSchedule GET /users/me/schedule?from=&to=
+func (ph *ProgramHandler) HandleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	from, to, err := readScheduleRange(r.URL.Query(), time.Now())
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	sessions, err := ph.programStore.GetSchedule(middleware.GetUser(r).ID, from, to)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve schedule"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{
+		"from":     from.Format(time.DateOnly),
+		"to":       to.Format(time.DateOnly),
+		"sessions": sessions,
+	})
+}
+
+type startSessionRequest struct {
+	PerformedAt *time.Time `json:"performed_at"`
+}
+
+// HandleStartSession POST /users/me/enrollments/{id}/sessions/{sessionID}/start
+//
+// Creates a workout from the planned session's template with the week's
+// weight progression applied and marks the session as completed.
+func (ph *ProgramHandler) HandleStartSession(w http.ResponseWriter, r *http.Request) {
+	enrollmentID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid enrollment ID"})
+		return
+	}
+
+	sessionID, err := utils.ReadIntParam(r, "sessionID")
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid session ID"})
+		return
+	}
+
+	var req startSessionRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	userID := middleware.GetUser(r).ID
+
+	session, err := ph.programStore.GetPlannedSession(enrollmentID, sessionID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve session"})
+		return
+	}
+
+	if session == nil || session.UserID != userID {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Planned session not found"})
+		return
+	}
+
+	if session.Completed {
+		_ = utils.WriteJson(w, http.StatusConflict, utils.Envelope{"error": "Planned session has already been completed"})
+		return
+	}
+
+	// The session copies the author's template, which must stay private once
+	// the program is unpublished.
+	if !session.Available {
+		_ = utils.WriteJson(w, http.StatusForbidden, utils.Envelope{"error": "The program is no longer published"})
+		return
+	}
+
+	template, err := ph.templateStore.GetTemplateByID(session.TemplateID)
+
+	if err != nil || template == nil {
+		ph.logger.Printf("ERROR: template %d of session %d: %v", session.TemplateID, session.SessionID, err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve session template"})
+		return
+	}
+
+	workout := template.NewWorkout()
+	workout.UserID = userID
+	workout.Description = fmt.Sprintf("%s, week %d day %d", session.ProgramName, session.Week, session.Day)
+	session.ApplyProgression(workout)
+
+	if req.PerformedAt != nil {
+		workout.PerformedAt = *req.PerformedAt
+	}
+
+	err = ph.programStore.StartSession(session, workout)
+
+	if errors.Is(err, store.ErrSessionCompleted) {
+		_ = utils.WriteJson(w, http.StatusConflict, utils.Envelope{"error": "Planned session has already been completed"})
+		return
+	}
+
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to start workout"})
+		return
+	}
+
+	session.Completed = true
+	session.WorkoutID = &workout.ID
+
+	w.Header().Set("ETag", workoutETag(workout))
+	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{"workout": workout, "session": session})
+}
+
+// loadProgram reads the {id} program and writes a 400 or 404 response unless
+// it exists and is published or belongs to the authenticated user. Unpublished
+// programs of other users are reported as missing.
+func (ph *ProgramHandler) loadProgram(w http.ResponseWriter, r *http.Request) (*store.Program, bool) {
+	programID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid program ID"})
+		return nil, false
+	}
+
+	program, err := ph.programStore.GetProgramByID(programID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve program"})
+		return nil, false
+	}
+
+	if program == nil || (!program.Published && program.UserID != middleware.GetUser(r).ID) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Program not found"})
+		return nil, false
+	}
+
+	return program, true
+}
+
+// loadAuthoredProgram is loadProgram for writes, which only the program's
+// author may make.
+func (ph *ProgramHandler) loadAuthoredProgram(w http.ResponseWriter, r *http.Request) (*store.Program, bool) {
+	program, ok := ph.loadProgram(w, r)
+
+	if !ok {
+		return nil, false
+	}
+
+	if program.UserID != middleware.GetUser(r).ID {
+		_ = utils.WriteJson(w, http.StatusForbidden, utils.Envelope{"error": "You do not have permission to modify this program"})
+		return nil, false
+	}
+
+	return program, true
+}
+
+func validateProgram(program *store.Program) error {
+	program.Name = strings.TrimSpace(program.Name)
+
+	if program.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if program.Weeks < 1 || program.Weeks > 52 {
+		return errors.New("weeks must be between 1 and 52")
+	}
+
+	if program.WeightIncrement < -100 || program.WeightIncrement > 100 {
+		return errors.New("weight_increment must be between -100 and 100")
+	}
+
+	if program.Sessions == nil {
+		program.Sessions = []store.ProgramSession{}
+	}
+
+	for i, session := range program.Sessions {
+		if session.Week < 1 || session.Week > program.Weeks {
+			return fmt.Errorf("sessions[%d]: week must be between 1 and %d", i, program.Weeks)
+		}
+
+		if session.Day < 1 || session.Day > 7 {
+			return fmt.Errorf("sessions[%d]: day must be between 1 and 7", i)
+		}
+
+		if session.TemplateID < 1 {
+			return fmt.Errorf("sessions[%d]: template_id is required", i)
+		}
+	}
+
+	return nil
+}
+
+// readScheduleRange defaults to the four weeks starting today.
+func readScheduleRange(qs url.Values, now time.Time) (time.Time, time.Time, error) {
+	from, err := utils.ReadOptionalTime(qs, "from")
+
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	to, err := utils.ReadOptionalTime(qs, "to")
+
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if from == nil {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		from = &today
+	}
+
+	if to == nil {
+		end := from.AddDate(0, 0, 27)
+		to = &end
+	}
+
+	if to.Before(*from) {
+		return time.Time{}, time.Time{}, errors.New("to must not be before from")
+	}
+
+	if to.Sub(*from) > maxScheduleDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("the schedule can span at most %d days", maxScheduleDays)
+	}
+
+	return *from, *to, nil
+}
@@ -0,0 +1,343 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sessionKey struct {
+	enrollmentID int
+	sessionID    int
+}
+
+// fakeProgramStore serves planned sessions that tests register directly
+// rather than expanding programs into a schedule. Completions are kept apart
+// from the planned sessions, which therefore read like they did before a
+// concurrent start.
+type fakeProgramStore struct {
+	workoutStore *fakeWorkoutStore
+	programs     map[int]*store.Program
+	planned      map[sessionKey]*store.PlannedSession
+	completions  map[sessionKey]int
+	nextID       int
+}
+
+func newFakeProgramStore(workoutStore *fakeWorkoutStore) *fakeProgramStore {
+	return &fakeProgramStore{
+		workoutStore: workoutStore,
+		programs:     map[int]*store.Program{},
+		planned:      map[sessionKey]*store.PlannedSession{},
+		completions:  map[sessionKey]int{},
+		nextID:       1,
+	}
+}
+
+func (s *fakeProgramStore) CreateProgram(program *store.Program) error {
+	program.ID = s.nextID
+	s.nextID++
+	stored := *program
+	s.programs[program.ID] = &stored
+	return nil
+}
+
+func (s *fakeProgramStore) GetProgramByID(id int) (*store.Program, error) {
+	program, ok := s.programs[id]
+
+	if !ok {
+		return nil, nil
+	}
+
+	found := *program
+	return &found, nil
+}
+
+func (s *fakeProgramStore) GetPrograms(userID int) ([]*store.Program, error) {
+	programs := []*store.Program{}
+
+	for _, program := range s.programs {
+		if program.Published || program.UserID == userID {
+			programs = append(programs, program)
+		}
+	}
+
+	return programs, nil
+}
+
+func (s *fakeProgramStore) UpdateProgram(program *store.Program) error {
+	existing, ok := s.programs[program.ID]
+
+	if !ok || existing.UserID != program.UserID {
+		return sql.ErrNoRows
+	}
+
+	stored := *program
+	s.programs[program.ID] = &stored
+	return nil
+}
+
+func (s *fakeProgramStore) DeleteProgram(id, userID int) error {
+	existing, ok := s.programs[id]
+
+	if !ok || existing.UserID != userID {
+		return sql.ErrNoRows
+	}
+
+	delete(s.programs, id)
+	return nil
+}
+
+func (s *fakeProgramStore) Enroll(enrollment *store.Enrollment) error {
+	enrollment.ID = s.nextID
+	s.nextID++
+	return nil
+}
+
+func (s *fakeProgramStore) GetEnrollmentsForUser(userID int) ([]*store.Enrollment, error) {
+	return []*store.Enrollment{}, nil
+}
+
+func (s *fakeProgramStore) DeleteEnrollment(id, userID int) error {
+	return sql.ErrNoRows
+}
+
+func (s *fakeProgramStore) GetSchedule(userID int, from, to time.Time) ([]*store.PlannedSession, error) {
+	sessions := []*store.PlannedSession{}
+
+	for _, session := range s.planned {
+		if session.UserID == userID && !session.Date.Before(from) && !session.Date.After(to) {
+			found := *session
+			sessions = append(sessions, &found)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *fakeProgramStore) GetPlannedSession(enrollmentID, sessionID int) (*store.PlannedSession, error) {
+	session, ok := s.planned[sessionKey{enrollmentID, sessionID}]
+
+	if !ok {
+		return nil, nil
+	}
+
+	found := *session
+	return &found, nil
+}
+
+func (s *fakeProgramStore) StartSession(session *store.PlannedSession, workout *store.Workout) error {
+	key := sessionKey{session.EnrollmentID, session.SessionID}
+
+	if _, ok := s.completions[key]; ok {
+		return store.ErrSessionCompleted
+	}
+
+	_, err := s.workoutStore.CreateWorkout(workout)
+
+	if err != nil {
+		return err
+	}
+
+	s.completions[key] = workout.ID
+	return nil
+}
+
+func setupProgramRouter(programStore store.ProgramStore, templateStore store.TemplateStore) http.Handler {
+	handler := NewProgramHandler(programStore, templateStore, log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Get("/programs", handler.HandleGetPrograms)
+	r.Post("/programs", handler.HandleCreateProgram)
+	r.Get("/programs/{id}", handler.HandleGetProgramByID)
+	r.Put("/programs/{id}", handler.HandleUpdateProgram)
+	r.Delete("/programs/{id}", handler.HandleDeleteProgram)
+	r.Post("/programs/{id}/enrollments", handler.HandleEnroll)
+	r.Get("/users/me/schedule", handler.HandleGetSchedule)
+	r.Post("/users/me/enrollments/{id}/sessions/{sessionID}/start", handler.HandleStartSession)
+
+	return r
+}
+
+func TestProgramValidationAndAuthorship(t *testing.T) {
+	programStore := newFakeProgramStore(newFakeWorkoutStore())
+	router := setupProgramRouter(programStore, newFakeTemplateStore())
+
+	rec := doRequest(t, router, owner, http.MethodPost, "/programs", store.Program{
+		Name:     "5x5",
+		Weeks:    2,
+		Sessions: []store.ProgramSession{{Week: 3, Day: 1, TemplateID: 1}},
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPost, "/programs", store.Program{
+		Name:            "5x5",
+		Weeks:           2,
+		WeightIncrement: 2.5,
+		Sessions:        []store.ProgramSession{{Week: 1, Day: 1, TemplateID: 1}, {Week: 2, Day: 1, TemplateID: 1}},
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	// Unpublished programs are private to their author.
+	rec = doRequest(t, router, intruder, http.MethodGet, "/programs/1", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(t, router, intruder, http.MethodPost, "/programs/1/enrollments", map[string]string{"start_date": "2025-03-03"})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	var programs struct {
+		Programs []store.Program `json:"programs"`
+	}
+
+	rec = doRequest(t, router, intruder, http.MethodGet, "/programs", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &programs))
+	assert.Empty(t, programs.Programs)
+
+	rec = doRequest(t, router, owner, http.MethodPut, "/programs/1", store.Program{
+		Name:            "5x5",
+		Weeks:           2,
+		WeightIncrement: 2.5,
+		Published:       true,
+		Sessions:        []store.ProgramSession{{Week: 1, Day: 1, TemplateID: 1}, {Week: 2, Day: 1, TemplateID: 1}},
+	})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequest(t, router, intruder, http.MethodGet, "/programs", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &programs))
+	assert.Len(t, programs.Programs, 1)
+
+	rec = doRequest(t, router, intruder, http.MethodGet, "/programs/1", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequest(t, router, intruder, http.MethodPut, "/programs/1", store.Program{Name: "mine", Weeks: 1})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequest(t, router, intruder, http.MethodDelete, "/programs/1", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequest(t, router, intruder, http.MethodPost, "/programs/1/enrollments", map[string]string{"start_date": "next monday"})
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = doRequest(t, router, intruder, http.MethodPost, "/programs/1/enrollments", map[string]string{"start_date": "2025-03-03"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var response struct {
+		Enrollment store.Enrollment `json:"enrollment"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, intruder.ID, response.Enrollment.UserID)
+	assert.Equal(t, "5x5", response.Enrollment.ProgramName)
+}
+
+func TestStartPlannedSession(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	programStore := newFakeProgramStore(workoutStore)
+	templateStore := newFakeTemplateStore()
+	router := setupProgramRouter(programStore, templateStore)
+
+	// The template belongs to the program's author, not the enrolled user.
+	weight := 100.0
+	require.NoError(t, templateStore.CreateTemplate(&store.WorkoutTemplate{
+		UserID: intruder.ID,
+		Name:   "squat day",
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Back Squat", Sets: 5, Reps: intPtr(5), Weight: &weight},
+			{ExerciseName: "Plank", Sets: 3, DurationSeconds: intPtr(60)},
+		},
+	}))
+
+	programStore.planned[sessionKey{1, 4}] = &store.PlannedSession{
+		EnrollmentID: 1,
+		ProgramName:  "5x5",
+		SessionID:    4,
+		Week:         3,
+		Day:          1,
+		Date:         time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC),
+		TemplateID:   1,
+		TemplateName: "squat day",
+		WeightOffset: 5,
+		UserID:       owner.ID,
+		Available:    true,
+	}
+
+	rec := doRequest(t, router, owner, http.MethodGet, "/users/me/schedule?from=2025-03-01&to=2025-03-31", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var schedule struct {
+		Sessions []store.PlannedSession `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &schedule))
+	require.Len(t, schedule.Sessions, 1)
+	assert.False(t, schedule.Sessions[0].Completed)
+
+	rec = doRequest(t, router, intruder, http.MethodPost, "/users/me/enrollments/1/sessions/4/start", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPost, "/users/me/enrollments/1/sessions/5/start", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPost, "/users/me/enrollments/1/sessions/4/start", nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("ETag"))
+
+	var response struct {
+		Workout store.Workout        `json:"workout"`
+		Session store.PlannedSession `json:"session"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, owner.ID, response.Workout.UserID)
+	assert.Equal(t, "squat day", response.Workout.Title)
+	require.Len(t, response.Workout.Entries, 2)
+	require.NotNil(t, response.Workout.Entries[0].Weight)
+	assert.Equal(t, 105.0, *response.Workout.Entries[0].Weight)
+	assert.Nil(t, response.Workout.Entries[1].Weight)
+	assert.True(t, response.Session.Completed)
+	require.NotNil(t, response.Session.WorkoutID)
+	assert.Equal(t, response.Workout.ID, *response.Session.WorkoutID)
+
+	template, err := templateStore.GetTemplateByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, *template.Entries[0].Weight, "progression must not modify the template")
+
+	// The planned session still reads as open, like it does for a second
+	// request racing the first one.
+	rec = doRequest(t, router, owner, http.MethodPost, "/users/me/enrollments/1/sessions/4/start", nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Len(t, workoutStore.workouts, 1)
+
+	programStore.planned[sessionKey{1, 4}].Completed = true
+	rec = doRequest(t, router, owner, http.MethodPost, "/users/me/enrollments/1/sessions/4/start", nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// Once the author unpublishes the program, its template stays private.
+	programStore.planned[sessionKey{2, 4}] = &store.PlannedSession{EnrollmentID: 2, SessionID: 4, TemplateID: 1, UserID: owner.ID}
+	rec = doRequest(t, router, owner, http.MethodPost, "/users/me/enrollments/2/sessions/4/start", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Len(t, workoutStore.workouts, 1)
+}
+
+func TestReadScheduleRange(t *testing.T) {
+	now := time.Date(2025, 3, 5, 18, 30, 0, 0, time.UTC)
+
+	from, to, err := readScheduleRange(url.Values{}, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), to)
+
+	_, _, err = readScheduleRange(url.Values{"from": {"2025-03-05"}, "to": {"2025-03-01"}}, now)
+	assert.Error(t, err)
+
+	_, _, err = readScheduleRange(url.Values{"from": {"2025-01-01"}, "to": {"2026-06-01"}}, now)
+	assert.Error(t, err)
+}
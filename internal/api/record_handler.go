@@ -0,0 +1,71 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/utils"
+)
+
+type RecordHandler struct {
+	recordStore   store.PersonalRecordStore
+	exerciseStore store.ExerciseStore
+	logger        *log.Logger
+}
+
+// NewRecordHandler Constructor
+func NewRecordHandler(recordStore store.PersonalRecordStore, exerciseStore store.ExerciseStore, logger *log.Logger) *RecordHandler {
+	return &RecordHandler{
+		recordStore:   recordStore,
+		exerciseStore: exerciseStore,
+		logger:        logger,
+	}
+}
+
+// HandleGetCurrentUserRecords GET /users/me/records
+func (rh *RecordHandler) HandleGetCurrentUserRecords(w http.ResponseWriter, r *http.Request) {
+	records, err := rh.recordStore.GetRecordsForUser(middleware.GetUser(r).ID)
+
+	if err != nil {
+		rh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve personal records"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"records": records})
+}
+
+// HandleGetExerciseRecords GET /exercises/{id}/records
+func (rh *RecordHandler) HandleGetExerciseRecords(w http.ResponseWriter, r *http.Request) {
+	exerciseID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid exercise ID"})
+		return
+	}
+
+	exercise, err := rh.exerciseStore.GetExerciseByID(exerciseID)
+
+	if err != nil {
+		rh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve exercise"})
+		return
+	}
+
+	if exercise == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Exercise not found"})
+		return
+	}
+
+	records, err := rh.recordStore.GetRecordsForExercise(middleware.GetUser(r).ID, exerciseID)
+
+	if err != nil {
+		rh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve personal records"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"exercise": exercise, "records": records})
+}
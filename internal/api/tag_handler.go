@@ -0,0 +1,264 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/utils"
+)
+
+const (
+	maxTagNameLength  = 50
+	maxTagsPerWorkout = 20
+)
+
+type TagHandler struct {
+	tagStore store.TagStore
+	logger   *log.Logger
+}
+
+// NewTagHandler Constructor
+func NewTagHandler(tagStore store.TagStore, logger *log.Logger) *TagHandler {
+	return &TagHandler{
+		tagStore: tagStore,
+		logger:   logger,
+	}
+}
+
+// HandleGetTags GET /tags
+func (th *TagHandler) HandleGetTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := th.tagStore.GetTagsForUser(middleware.GetUser(r).ID)
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve tags"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"tags": tags})
+}
+
+type renameTagRequest struct {
+	Name string `json:"name"`
+}
+
+// HandleRenameTag PATCH /tags/{id}
+func (th *TagHandler) HandleRenameTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := th.loadOwnedTag(w, r)
+
+	if !ok {
+		return
+	}
+
+	var req renameTagRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	name, err := normalizeTagName(req.Name)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = th.tagStore.RenameTag(tag.ID, tag.UserID, name)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Tag not found"})
+		return
+	}
+
+	if errors.Is(err, store.ErrDuplicateTag) {
+		_ = utils.WriteJson(w, http.StatusConflict, utils.Envelope{"error": "a tag with this name already exists, merge the tags instead"})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to rename tag"})
+		return
+	}
+
+	tag.Name = name
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"tag": tag})
+}
+
+type mergeTagRequest struct {
+	Into int `json:"into"`
+}
+
+// HandleMergeTag POST /tags/{id}/merge
+//
+// Moves the {id} tag onto every workout carrying it as the "into" tag and
+// deletes it. Responds with the merged tag.
+func (th *TagHandler) HandleMergeTag(w http.ResponseWriter, r *http.Request) {
+	source, ok := th.loadOwnedTag(w, r)
+
+	if !ok {
+		return
+	}
+
+	var req mergeTagRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if req.Into == source.ID {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "a tag cannot be merged into itself"})
+		return
+	}
+
+	target, err := th.tagStore.GetTagByID(req.Into)
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve tag"})
+		return
+	}
+
+	if target == nil || target.UserID != source.UserID {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "into does not match one of your tags"})
+		return
+	}
+
+	err = th.tagStore.MergeTags(source.ID, target.ID, source.UserID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Tag not found"})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to merge tags"})
+		return
+	}
+
+	merged, err := th.tagStore.GetTagByID(target.ID)
+
+	if err != nil || merged == nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve tag"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"tag": merged})
+}
+
+// HandleDeleteTag DELETE /tags/{id}
+func (th *TagHandler) HandleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := th.loadOwnedTag(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := th.tagStore.DeleteTag(tag.ID, tag.UserID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Tag not found"})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete tag"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusNoContent, nil)
+}
+
+// loadOwnedTag reads the {id} tag and writes a 400, 404 or 403 response
+// unless it exists and belongs to the authenticated user.
+func (th *TagHandler) loadOwnedTag(w http.ResponseWriter, r *http.Request) (*store.Tag, bool) {
+	tagID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid tag ID"})
+		return nil, false
+	}
+
+	tag, err := th.tagStore.GetTagByID(tagID)
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve tag"})
+		return nil, false
+	}
+
+	if tag == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Tag not found"})
+		return nil, false
+	}
+
+	if tag.UserID != middleware.GetUser(r).ID {
+		_ = utils.WriteJson(w, http.StatusForbidden, utils.Envelope{"error": "You do not have permission to access this tag"})
+		return nil, false
+	}
+
+	return tag, true
+}
+
+// normalizeTagName lowercases the name and collapses its whitespace, so that
+// "Competition  Prep" and "competition prep" are the same tag. Commas are
+// rejected because the tag filter of GET /workouts is comma separated.
+func normalizeTagName(name string) (string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+
+	if name == "" {
+		return "", errors.New("tag names must not be empty")
+	}
+
+	if utf8.RuneCountInString(name) > maxTagNameLength {
+		return "", fmt.Errorf("tag names must not be longer than %d characters", maxTagNameLength)
+	}
+
+	if strings.Contains(name, ",") {
+		return "", errors.New("tag names must not contain commas")
+	}
+
+	return name, nil
+}
+
+// normalizeTags normalizes the workout's tag names and drops duplicates.
+func normalizeTags(workout *store.Workout) error {
+	tags := make([]string, 0, len(workout.Tags))
+
+	for _, tag := range workout.Tags {
+		name, err := normalizeTagName(tag)
+
+		if err != nil {
+			return err
+		}
+
+		if !slices.Contains(tags, name) {
+			tags = append(tags, name)
+		}
+	}
+
+	if len(tags) > maxTagsPerWorkout {
+		return fmt.Errorf("a workout must not have more than %d tags", maxTagsPerWorkout)
+	}
+
+	workout.Tags = tags
+	return nil
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTagStore derives the tags and their counts from the tag names stored on
+// the workouts of a fakeWorkoutStore.
+type fakeTagStore struct {
+	workoutStore *fakeWorkoutStore
+	tags         map[int]*store.Tag
+	nextID       int
+}
+
+func newFakeTagStore(workoutStore *fakeWorkoutStore) *fakeTagStore {
+	return &fakeTagStore{workoutStore: workoutStore, tags: map[int]*store.Tag{}, nextID: 1}
+}
+
+// sync creates the tags that workouts use but the store does not know yet
+// and recounts the workouts of every tag.
+func (s *fakeTagStore) sync() {
+	for id := 1; id < s.workoutStore.nextID; id++ {
+		workout, ok := s.workoutStore.workouts[id]
+
+		if !ok {
+			continue
+		}
+
+		for _, name := range workout.Tags {
+			if s.find(workout.UserID, name) == nil {
+				s.tags[s.nextID] = &store.Tag{ID: s.nextID, UserID: workout.UserID, Name: name, CreatedAt: time.Now()}
+				s.nextID++
+			}
+		}
+	}
+
+	for _, tag := range s.tags {
+		tag.WorkoutCount = 0
+
+		for _, workout := range s.workoutsWith(tag) {
+			if workout.DeletedAt == nil {
+				tag.WorkoutCount++
+			}
+		}
+	}
+}
+
+func (s *fakeTagStore) find(userID int, name string) *store.Tag {
+	for _, tag := range s.tags {
+		if tag.UserID == userID && tag.Name == name {
+			return tag
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeTagStore) workoutsWith(tag *store.Tag) []*store.Workout {
+	workouts := []*store.Workout{}
+
+	for _, workout := range s.workoutStore.workouts {
+		if workout.UserID == tag.UserID && slices.Contains(workout.Tags, tag.Name) {
+			workouts = append(workouts, workout)
+		}
+	}
+
+	return workouts
+}
+
+func (s *fakeTagStore) GetTagsForUser(userID int) ([]*store.Tag, error) {
+	s.sync()
+	tags := []*store.Tag{}
+
+	for id := 1; id < s.nextID; id++ {
+		if tag, ok := s.tags[id]; ok && tag.UserID == userID {
+			found := *tag
+			tags = append(tags, &found)
+		}
+	}
+
+	slices.SortStableFunc(tags, func(a, b *store.Tag) int { return b.WorkoutCount - a.WorkoutCount })
+
+	return tags, nil
+}
+
+func (s *fakeTagStore) GetTagByID(id int) (*store.Tag, error) {
+	s.sync()
+	tag, ok := s.tags[id]
+
+	if !ok {
+		return nil, nil
+	}
+
+	found := *tag
+	return &found, nil
+}
+
+func (s *fakeTagStore) RenameTag(id, userID int, name string) error {
+	tag, ok := s.tags[id]
+
+	if !ok || tag.UserID != userID {
+		return sql.ErrNoRows
+	}
+
+	if s.find(userID, name) != nil {
+		return store.ErrDuplicateTag
+	}
+
+	for _, workout := range s.workoutsWith(tag) {
+		workout.Tags[slices.Index(workout.Tags, tag.Name)] = name
+		workout.Version++
+	}
+
+	tag.Name = name
+	return nil
+}
+
+func (s *fakeTagStore) MergeTags(sourceID, targetID, userID int) error {
+	source, ok := s.tags[sourceID]
+	target, targetOK := s.tags[targetID]
+
+	if !ok || !targetOK || sourceID == targetID || source.UserID != userID || target.UserID != userID {
+		return sql.ErrNoRows
+	}
+
+	for _, workout := range s.workoutsWith(source) {
+		workout.Tags = slices.DeleteFunc(workout.Tags, func(name string) bool { return name == source.Name })
+
+		if !slices.Contains(workout.Tags, target.Name) {
+			workout.Tags = append(workout.Tags, target.Name)
+		}
+
+		workout.Version++
+	}
+
+	delete(s.tags, sourceID)
+	return nil
+}
+
+func (s *fakeTagStore) DeleteTag(id, userID int) error {
+	tag, ok := s.tags[id]
+
+	if !ok || tag.UserID != userID {
+		return sql.ErrNoRows
+	}
+
+	for _, workout := range s.workoutsWith(tag) {
+		workout.Tags = slices.DeleteFunc(workout.Tags, func(name string) bool { return name == tag.Name })
+		workout.Version++
+	}
+
+	delete(s.tags, id)
+	return nil
+}
+
+func setupTagRouter(tagStore store.TagStore, workoutStore store.WorkoutStore) http.Handler {
+	tagHandler := NewTagHandler(tagStore, log.New(io.Discard, "", 0))
+	workoutHandler := NewWorkoutHandler(workoutStore, log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Get("/tags", tagHandler.HandleGetTags)
+	r.Patch("/tags/{id}", tagHandler.HandleRenameTag)
+	r.Delete("/tags/{id}", tagHandler.HandleDeleteTag)
+	r.Post("/tags/{id}/merge", tagHandler.HandleMergeTag)
+	r.Get("/workouts", workoutHandler.HandleGetAllWorkouts)
+	r.Post("/workouts", workoutHandler.HandleCreateWorkout)
+
+	return r
+}
+
+func decodeTags(t *testing.T, body []byte) []*store.Tag {
+	t.Helper()
+
+	var response struct {
+		Tags []*store.Tag `json:"tags"`
+	}
+	require.NoError(t, json.Unmarshal(body, &response))
+
+	return response.Tags
+}
+
+func decodeTag(t *testing.T, body []byte) *store.Tag {
+	t.Helper()
+
+	var response struct {
+		Tag *store.Tag `json:"tag"`
+	}
+	require.NoError(t, json.Unmarshal(body, &response))
+
+	return response.Tag
+}
+
+func workoutTitles(t *testing.T, body []byte) []string {
+	t.Helper()
+
+	var response struct {
+		Workouts []*store.Workout `json:"workouts"`
+	}
+	require.NoError(t, json.Unmarshal(body, &response))
+
+	titles := []string{}
+
+	for _, workout := range response.Workouts {
+		titles = append(titles, workout.Title)
+	}
+
+	return titles
+}
+
+func TestWorkoutTags(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	tagStore := newFakeTagStore(workoutStore)
+	router := setupTagRouter(tagStore, workoutStore)
+
+	create := func(title string, tags ...string) *httptest.ResponseRecorder {
+		return doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{Title: title, Tags: tags})
+	}
+
+	rec := create("squats", "Deload", " competition   prep ", "deload")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created struct {
+		Workout store.Workout `json:"workout"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, []string{"deload", "competition prep"}, created.Workout.Tags)
+
+	require.Equal(t, http.StatusCreated, create("bench", "competition prep").Code)
+	require.Equal(t, http.StatusCreated, create("hotel gym", "travel").Code)
+	require.Equal(t, http.StatusCreated, doRequest(t, router, intruder, http.MethodPost, "/workouts", store.Workout{Title: "theirs", Tags: []string{"deload"}}).Code)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, create("bad", "a,b").Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, create("bad", "  ").Code)
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts?tag=deload,travel", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"squats", "hotel gym"}, workoutTitles(t, rec.Body.Bytes()))
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts?tag=deload,Competition%20Prep&tag_match=all", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"squats"}, workoutTitles(t, rec.Body.Bytes()))
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts?tag=deload&tag_match=some", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/tags", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	tags := decodeTags(t, rec.Body.Bytes())
+	require.Len(t, tags, 3)
+	assert.Equal(t, "competition prep", tags[0].Name)
+	assert.Equal(t, 2, tags[0].WorkoutCount)
+
+	ids := map[string]int{}
+
+	for _, tag := range tags {
+		ids[tag.Name] = tag.ID
+	}
+
+	intruderTags, err := tagStore.GetTagsForUser(intruder.ID)
+	require.NoError(t, err)
+	require.Len(t, intruderTags, 1)
+
+	rec = doRequest(t, router, intruder, http.MethodPatch, fmt.Sprintf("/tags/%d", ids["travel"]), map[string]string{"name": "mine"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPatch, fmt.Sprintf("/tags/%d", ids["travel"]), map[string]string{"name": "Deload"})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPatch, fmt.Sprintf("/tags/%d", ids["travel"]), map[string]string{"name": "On The Road"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "on the road", decodeTag(t, rec.Body.Bytes()).Name)
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts?tag=on%20the%20road", nil)
+	assert.Equal(t, []string{"hotel gym"}, workoutTitles(t, rec.Body.Bytes()))
+
+	mergeURL := fmt.Sprintf("/tags/%d/merge", ids["deload"])
+
+	rec = doRequest(t, router, owner, http.MethodPost, mergeURL, map[string]int{"into": ids["deload"]})
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPost, mergeURL, map[string]int{"into": intruderTags[0].ID})
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPost, mergeURL, map[string]int{"into": ids["competition prep"]})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 2, decodeTag(t, rec.Body.Bytes()).WorkoutCount)
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts?tag=deload", nil)
+	assert.Empty(t, workoutTitles(t, rec.Body.Bytes()))
+
+	rec = doRequest(t, router, owner, http.MethodDelete, fmt.Sprintf("/tags/%d", ids["competition prep"]), nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/tags", nil)
+	tags = decodeTags(t, rec.Body.Bytes())
+	require.Len(t, tags, 1)
+	assert.Equal(t, "on the road", tags[0].Name)
+
+	assert.Empty(t, workoutStore.workouts[1].Tags)
+	assert.Equal(t, []string{"deload"}, workoutStore.workouts[4].Tags)
+}
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/utils"
+)
+
+type TemplateHandler struct {
+	templateStore store.TemplateStore
+	workoutStore  store.WorkoutStore
+	logger        *log.Logger
+}
+
+// NewTemplateHandler Constructor
+func NewTemplateHandler(templateStore store.TemplateStore, workoutStore store.WorkoutStore, logger *log.Logger) *TemplateHandler {
+	return &TemplateHandler{
+		templateStore: templateStore,
+		workoutStore:  workoutStore,
+		logger:        logger,
+	}
+}
+
+// HandleGetTemplates GET /templates
+func (th *TemplateHandler) HandleGetTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := th.templateStore.GetTemplatesForUser(middleware.GetUser(r).ID)
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve templates"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"templates": templates})
+}
+
+// HandleGetTemplateByID GET /templates/{id}
+func (th *TemplateHandler) HandleGetTemplateByID(w http.ResponseWriter, r *http.Request) {
+	template, ok := th.loadOwnedTemplate(w, r)
+
+	if !ok {
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"template": template})
+}
+
+// HandleCreateTemplate POST /templates
+func (th *TemplateHandler) HandleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var template store.WorkoutTemplate
+
+	err := json.NewDecoder(r.Body).Decode(&template)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	template.UserID = middleware.GetUser(r).ID
+
+	th.createTemplate(w, &template)
+}
+
+// HandleUpdateTemplate PUT /templates/{id}
+func (th *TemplateHandler) HandleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	stored, ok := th.loadOwnedTemplate(w, r)
+
+	if !ok {
+		return
+	}
+
+	var template store.WorkoutTemplate
+
+	err := json.NewDecoder(r.Body).Decode(&template)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	template.ID = stored.ID
+	template.UserID = stored.UserID
+
+	err = validateTemplate(&template)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = th.templateStore.UpdateTemplate(&template)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Template not found"})
+		return
+	}
+
+	if errors.Is(err, store.ErrExerciseNotFound) {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update template"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"template": template})
+}
+
+// HandleDeleteTemplate DELETE /templates/{id}
+func (th *TemplateHandler) HandleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := th.loadOwnedTemplate(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := th.templateStore.DeleteTemplate(template.ID, template.UserID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Template not found"})
+		return
+	}
+
+	if errors.Is(err, store.ErrTemplateInUse) {
+		_ = utils.WriteJson(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete template"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusNoContent, nil)
+}
+
+type startTemplateRequest struct {
+	Title       string     `json:"title"`
+	PerformedAt *time.Time `json:"performed_at"`
+}
+
+// HandleStartTemplate POST /templates/{id}/start
+//
+// Creates a new workout pre-filled from the template. The optional body can
+// override the title and set performed_at.
+func (th *TemplateHandler) HandleStartTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := th.loadOwnedTemplate(w, r)
+
+	if !ok {
+		return
+	}
+
+	var req startTemplateRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	workout := template.NewWorkout()
+
+	if title := strings.TrimSpace(req.Title); title != "" {
+		workout.Title = title
+	}
+
+	if req.PerformedAt != nil {
+		workout.PerformedAt = *req.PerformedAt
+	}
+
+	createdWorkout, err := th.workoutStore.CreateWorkout(workout)
+
+	if errors.Is(err, store.ErrExerciseNotFound) {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to start workout"})
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(createdWorkout))
+	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
+}
+
+type saveAsTemplateRequest struct {
+	Name string `json:"name"`
+}
+
+// HandleSaveWorkoutAsTemplate POST /workouts/{id}/save-as-template
+func (th *TemplateHandler) HandleSaveWorkoutAsTemplate(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID"})
+		return
+	}
+
+	var req saveAsTemplateRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	workout, err := th.workoutStore.GetWorkoutByID(workoutID)
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve workout"})
+		return
+	}
+
+	if workout == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+		return
+	}
+
+	if workout.UserID != middleware.GetUser(r).ID {
+		_ = utils.WriteJson(w, http.StatusForbidden, utils.Envelope{"error": "You do not have permission to access this workout"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+
+	if name == "" {
+		name = workout.Title
+	}
+
+	th.createTemplate(w, store.TemplateFromWorkout(workout, name))
+}
+
+func (th *TemplateHandler) createTemplate(w http.ResponseWriter, template *store.WorkoutTemplate) {
+	err := validateTemplate(template)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = th.templateStore.CreateTemplate(template)
+
+	if errors.Is(err, store.ErrExerciseNotFound) {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create template"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{"template": template})
+}
+
+// loadOwnedTemplate reads the {id} template and writes a 400, 404 or 403
+// response unless it exists and belongs to the authenticated user.
+func (th *TemplateHandler) loadOwnedTemplate(w http.ResponseWriter, r *http.Request) (*store.WorkoutTemplate, bool) {
+	templateID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid template ID"})
+		return nil, false
+	}
+
+	template, err := th.templateStore.GetTemplateByID(templateID)
+
+	if err != nil {
+		th.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve template"})
+		return nil, false
+	}
+
+	if template == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Template not found"})
+		return nil, false
+	}
+
+	if template.UserID != middleware.GetUser(r).ID {
+		_ = utils.WriteJson(w, http.StatusForbidden, utils.Envelope{"error": "You do not have permission to access this template"})
+		return nil, false
+	}
+
+	return template, true
+}
+
+func validateTemplate(template *store.WorkoutTemplate) error {
+	template.Name = strings.TrimSpace(template.Name)
+
+	if template.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if template.Entries == nil {
+		template.Entries = []store.WorkoutEntry{}
+	}
+
+	return validateEntries(template.Entries)
+}
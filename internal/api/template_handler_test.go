@@ -0,0 +1,169 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTemplateStore struct {
+	templates map[int]*store.WorkoutTemplate
+	nextID    int
+}
+
+func newFakeTemplateStore() *fakeTemplateStore {
+	return &fakeTemplateStore{templates: map[int]*store.WorkoutTemplate{}, nextID: 1}
+}
+
+func (s *fakeTemplateStore) CreateTemplate(template *store.WorkoutTemplate) error {
+	template.ID = s.nextID
+	s.nextID++
+	stored := *template
+	s.templates[template.ID] = &stored
+	return nil
+}
+
+func (s *fakeTemplateStore) GetTemplateByID(id int) (*store.WorkoutTemplate, error) {
+	template, ok := s.templates[id]
+
+	if !ok {
+		return nil, nil
+	}
+
+	found := *template
+	return &found, nil
+}
+
+func (s *fakeTemplateStore) GetTemplatesForUser(userID int) ([]*store.WorkoutTemplate, error) {
+	templates := []*store.WorkoutTemplate{}
+
+	for id := 1; id < s.nextID; id++ {
+		if template, ok := s.templates[id]; ok && template.UserID == userID {
+			templates = append(templates, template)
+		}
+	}
+
+	return templates, nil
+}
+
+func (s *fakeTemplateStore) UpdateTemplate(template *store.WorkoutTemplate) error {
+	existing, ok := s.templates[template.ID]
+
+	if !ok || existing.UserID != template.UserID {
+		return sql.ErrNoRows
+	}
+
+	stored := *template
+	s.templates[template.ID] = &stored
+	return nil
+}
+
+func (s *fakeTemplateStore) DeleteTemplate(id, userID int) error {
+	existing, ok := s.templates[id]
+
+	if !ok || existing.UserID != userID {
+		return sql.ErrNoRows
+	}
+
+	delete(s.templates, id)
+	return nil
+}
+
+func setupTemplateRouter(templateStore store.TemplateStore, workoutStore store.WorkoutStore) http.Handler {
+	handler := NewTemplateHandler(templateStore, workoutStore, log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Get("/templates", handler.HandleGetTemplates)
+	r.Post("/templates", handler.HandleCreateTemplate)
+	r.Get("/templates/{id}", handler.HandleGetTemplateByID)
+	r.Put("/templates/{id}", handler.HandleUpdateTemplate)
+	r.Delete("/templates/{id}", handler.HandleDeleteTemplate)
+	r.Post("/templates/{id}/start", handler.HandleStartTemplate)
+	r.Post("/workouts/{id}/save-as-template", handler.HandleSaveWorkoutAsTemplate)
+
+	return r
+}
+
+func TestStartTemplateCreatesWorkout(t *testing.T) {
+	templateStore := newFakeTemplateStore()
+	workoutStore := newFakeWorkoutStore()
+	router := setupTemplateRouter(templateStore, workoutStore)
+
+	rec := doRequest(t, router, owner, http.MethodPost, "/templates", store.WorkoutTemplate{
+		Name: "push day",
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Bench Press", Sets: 5, Reps: intPtr(5)},
+			{ExerciseName: "Dip", Sets: 3, Reps: intPtr(10)},
+		},
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPost, "/templates", store.WorkoutTemplate{Name: " "})
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = doRequest(t, router, intruder, http.MethodPost, "/templates/1/start", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPost, "/templates/1/start", map[string]string{"title": "push day, week 2"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var response struct {
+		Workout store.Workout `json:"workout"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "push day, week 2", response.Workout.Title)
+	assert.Equal(t, owner.ID, response.Workout.UserID)
+	require.Len(t, response.Workout.Entries, 2)
+	assert.Equal(t, "Bench Press", response.Workout.Entries[0].ExerciseName)
+	assert.Equal(t, 2, response.Workout.Entries[1].OrderIndex)
+
+	rec = doRequest(t, router, owner, http.MethodPost, "/templates/1/start", nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "push day", response.Workout.Title)
+}
+
+func TestSaveWorkoutAsTemplate(t *testing.T) {
+	templateStore := newFakeTemplateStore()
+	workoutStore := newFakeWorkoutStore()
+	router := setupTemplateRouter(templateStore, workoutStore)
+
+	_, err := workoutStore.CreateWorkout(&store.Workout{
+		Title:   "leg day",
+		UserID:  owner.ID,
+		Entries: []store.WorkoutEntry{{ID: 7, ExerciseName: "Back Squat", Sets: 5, Reps: intPtr(5), OrderIndex: 1}},
+	})
+	require.NoError(t, err)
+
+	rec := doRequest(t, router, intruder, http.MethodPost, "/workouts/1/save-as-template", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPost, "/workouts/42/save-as-template", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodPost, "/workouts/1/save-as-template", map[string]string{"name": "legs"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	template, err := templateStore.GetTemplateByID(1)
+	require.NoError(t, err)
+	require.NotNil(t, template)
+	assert.Equal(t, "legs", template.Name)
+	require.Len(t, template.Entries, 1)
+	assert.Zero(t, template.Entries[0].ID)
+	assert.Equal(t, "Back Squat", template.Entries[0].ExerciseName)
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/templates", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequest(t, router, intruder, http.MethodGet, "/templates", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"templates": []}`, rec.Body.String())
+}
@@ -1,11 +1,15 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
 	"github.com/DavidGudovic/api_exercise/internal/store"
 	"github.com/DavidGudovic/api_exercise/internal/tokens"
 	"github.com/DavidGudovic/api_exercise/internal/utils"
@@ -22,6 +26,10 @@ type createTokenRequest struct {
 	Password string `json:"password"`
 }
 
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
 	return &TokenHandler{
 		tokenStore: tokenStore,
@@ -62,7 +70,114 @@ func (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := h.tokenStore.CreateNewToken(user.ID, tokens.ScopeAuth, 24*time.Hour)
+	h.issueTokenPair(w, r, user.ID, "")
+}
+
+// HandleDeleteCurrentToken DELETE /tokens/current
+//
+// Logs the current session out, revoking the refresh token issued along with
+// the auth token too.
+func (h *TokenHandler) HandleDeleteCurrentToken(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	err := h.tokenStore.DeleteSession(tokens.Hash(middleware.GetToken(r)), user.ID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Session not found"})
+		return
+	}
+
+	if err != nil {
+		h.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to log out"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusNoContent, nil)
+}
+
+// HandleDeleteAllTokens DELETE /tokens
+func (h *TokenHandler) HandleDeleteAllTokens(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	for _, scope := range []string{tokens.ScopeRefresh, tokens.ScopeAuth} {
+		err := h.tokenStore.DeleteAllTokensForUser(user.ID, scope)
+
+		if err != nil {
+			h.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to log out"})
+			return
+		}
+	}
+
+	_ = utils.WriteJson(w, http.StatusNoContent, nil)
+}
+
+// HandleGetSessions GET /tokens/sessions
+func (h *TokenHandler) HandleGetSessions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	sessions, err := h.tokenStore.GetSessionsForUser(user.ID, tokens.Hash(middleware.GetToken(r)))
+
+	if err != nil {
+		h.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"sessions": sessions})
+}
+
+// HandleRefreshToken POST /tokens/refresh
+func (h *TokenHandler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil || req.RefreshToken == "" {
+		h.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	token, err := h.tokenStore.GetTokenByHash(tokens.Hash(req.RefreshToken))
+
+	if err != nil {
+		h.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to verify refresh token"})
+		return
+	}
+
+	if token == nil || token.Scope != tokens.ScopeRefresh {
+		_ = utils.WriteJson(w, http.StatusUnauthorized, utils.Envelope{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	rotated := false
+
+	if token.RotatedAt == nil {
+		rotated, err = h.tokenStore.MarkTokenRotated(token.Hash)
+
+		if err != nil {
+			h.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to rotate refresh token"})
+			return
+		}
+	}
+
+	if !rotated {
+		h.revokeSessionsAfterReuse(token.UserID)
+		_ = utils.WriteJson(w, http.StatusUnauthorized, utils.Envelope{"error": "Refresh token has already been used"})
+		return
+	}
+
+	h.issueTokenPair(w, r, token.UserID, token.SessionID)
+}
+
+// issueTokenPair writes a fresh auth token and refresh token for the user.
+// Both belong to sessionID, or to a new session when it is empty.
+func (h *TokenHandler) issueTokenPair(w http.ResponseWriter, r *http.Request, userID int, sessionID string) {
+	authToken, err := h.createSessionToken(r, userID, sessionID, tokens.ScopeAuth, tokens.AuthTTL)
 
 	if err != nil {
 		h.logger.Printf("ERROR: %v", err)
@@ -70,5 +185,67 @@ func (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{"token": token.Plaintext})
+	refreshToken, err := h.createSessionToken(r, userID, authToken.SessionID, tokens.ScopeRefresh, tokens.RefreshTTL)
+
+	if err != nil {
+		h.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create token"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{
+		"token":                authToken.Plaintext,
+		"token_expiry":         authToken.Expiry,
+		"refresh_token":        refreshToken.Plaintext,
+		"refresh_token_expiry": refreshToken.Expiry,
+	})
+}
+
+// createSessionToken stores a new token of the session tagged with the
+// client's user agent and IP. An empty sessionID keeps the generated one.
+func (h *TokenHandler) createSessionToken(r *http.Request, userID int, sessionID, scope string, ttl time.Duration) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, scope)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if sessionID != "" {
+		token.SessionID = sessionID
+	}
+
+	token.UserAgent = r.UserAgent()
+	token.IP = clientIP(r)
+
+	err = h.tokenStore.Insert(token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// revokeSessionsAfterReuse logs the user out everywhere, since a replayed
+// refresh token means it has most likely been stolen.
+func (h *TokenHandler) revokeSessionsAfterReuse(userID int) {
+	h.logger.Printf("WARNING: refresh token reuse detected for user %d, revoking all sessions", userID)
+
+	for _, scope := range []string{tokens.ScopeRefresh, tokens.ScopeAuth} {
+		err := h.tokenStore.DeleteAllTokensForUser(userID, scope)
+
+		if err != nil {
+			h.logger.Printf("ERROR: %v", err)
+		}
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
 }
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/tokens"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// setupTokenRouter authenticates requests carrying a bearer token as the
+// token's user, standing in for the authentication middleware.
+func setupTokenRouter(tokenStore *fakeTokenStore, userStore *fakeUserStore) http.Handler {
+	handler := NewTokenHandler(tokenStore, userStore, log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			plaintext := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			token, _ := tokenStore.GetTokenByHash(tokens.Hash(plaintext))
+
+			if token != nil && token.Scope == tokens.ScopeAuth {
+				r = middleware.SetToken(middleware.SetUser(r, userStore.users[token.UserID]), plaintext)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Post("/tokens/authentication", handler.HandleCreateToken)
+	r.Post("/tokens/refresh", handler.HandleRefreshToken)
+	r.Get("/tokens/sessions", handler.HandleGetSessions)
+	r.Delete("/tokens/current", handler.HandleDeleteCurrentToken)
+
+	return r
+}
+
+func doTokenRequest(t *testing.T, handler http.Handler, method, target, bearer string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var payload io.Reader
+
+	if body != nil {
+		js, err := json.Marshal(body)
+		require.NoError(t, err)
+		payload = bytes.NewReader(js)
+	}
+
+	req := httptest.NewRequest(method, target, payload)
+
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func decodeTokenPair(t *testing.T, rec *httptest.ResponseRecorder) tokenPair {
+	t.Helper()
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var pair tokenPair
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pair))
+	require.NotEmpty(t, pair.Token)
+	require.NotEmpty(t, pair.RefreshToken)
+
+	return pair
+}
+
+func newTokenTestUser(t *testing.T, userStore *fakeUserStore) *store.User {
+	t.Helper()
+
+	user := &store.User{Username: "lifter", Email: "lifter@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("secret-password"))
+	require.NoError(t, userStore.CreateUser(user))
+
+	return user
+}
+
+func login(t *testing.T, router http.Handler) tokenPair {
+	t.Helper()
+
+	return decodeTokenPair(t, doTokenRequest(t, router, http.MethodPost, "/tokens/authentication", "", createTokenRequest{Username: "lifter", Password: "secret-password"}))
+}
+
+func TestLogoutRevokesWholeSession(t *testing.T) {
+	tokenStore := newFakeTokenStore()
+	userStore := newFakeUserStore(tokenStore)
+	router := setupTokenRouter(tokenStore, userStore)
+	newTokenTestUser(t, userStore)
+
+	phone := login(t, router)
+	laptop := login(t, router)
+
+	refreshed := decodeTokenPair(t, doTokenRequest(t, router, http.MethodPost, "/tokens/refresh", "", refreshTokenRequest{RefreshToken: phone.RefreshToken}))
+
+	rec := doTokenRequest(t, router, http.MethodGet, "/tokens/sessions", refreshed.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Sessions []*store.Session `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response.Sessions, 2)
+
+	current := 0
+
+	for _, session := range response.Sessions {
+		assert.NotEmpty(t, session.ID)
+
+		if session.Current {
+			current++
+		}
+	}
+
+	assert.Equal(t, 1, current)
+
+	rec = doTokenRequest(t, router, http.MethodDelete, "/tokens/current", refreshed.Token, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	for _, plaintext := range []string{phone.Token, phone.RefreshToken, refreshed.Token, refreshed.RefreshToken} {
+		token, err := tokenStore.GetTokenByHash(tokens.Hash(plaintext))
+		require.NoError(t, err)
+		assert.Nil(t, token)
+	}
+
+	rec = doTokenRequest(t, router, http.MethodPost, "/tokens/refresh", "", refreshTokenRequest{RefreshToken: refreshed.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	decodeTokenPair(t, doTokenRequest(t, router, http.MethodPost, "/tokens/refresh", "", refreshTokenRequest{RefreshToken: laptop.RefreshToken}))
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	tokenStore := newFakeTokenStore()
+	userStore := newFakeUserStore(tokenStore)
+	router := setupTokenRouter(tokenStore, userStore)
+	user := newTokenTestUser(t, userStore)
+
+	first := login(t, router)
+	second := login(t, router)
+
+	rotated := decodeTokenPair(t, doTokenRequest(t, router, http.MethodPost, "/tokens/refresh", "", refreshTokenRequest{RefreshToken: first.RefreshToken}))
+	assert.NotEqual(t, first.Token, rotated.Token)
+	assert.NotEqual(t, first.RefreshToken, rotated.RefreshToken)
+
+	old, err := tokenStore.GetTokenByHash(tokens.Hash(first.RefreshToken))
+	require.NoError(t, err)
+	require.NotNil(t, old)
+	assert.NotNil(t, old.RotatedAt)
+
+	fresh, err := tokenStore.GetTokenByHash(tokens.Hash(rotated.RefreshToken))
+	require.NoError(t, err)
+	require.NotNil(t, fresh)
+	assert.Equal(t, old.SessionID, fresh.SessionID)
+	assert.Equal(t, http.StatusOK, doTokenRequest(t, router, http.MethodGet, "/tokens/sessions", rotated.Token, nil).Code)
+
+	// Replaying a rotated refresh token logs the user out everywhere.
+	rec := doTokenRequest(t, router, http.MethodPost, "/tokens/refresh", "", refreshTokenRequest{RefreshToken: first.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Zero(t, tokenStore.countForUser(user.ID, tokens.ScopeAuth))
+	assert.Zero(t, tokenStore.countForUser(user.ID, tokens.ScopeRefresh))
+
+	for _, refreshToken := range []string{rotated.RefreshToken, second.RefreshToken} {
+		rec = doTokenRequest(t, router, http.MethodPost, "/tokens/refresh", "", refreshTokenRequest{RefreshToken: refreshToken})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestRefreshTokenExpired(t *testing.T) {
+	tokenStore := newFakeTokenStore()
+	userStore := newFakeUserStore(tokenStore)
+	router := setupTokenRouter(tokenStore, userStore)
+	newTokenTestUser(t, userStore)
+
+	pair := login(t, router)
+
+	refreshToken, err := tokenStore.GetTokenByHash(tokens.Hash(pair.RefreshToken))
+	require.NoError(t, err)
+	require.NotNil(t, refreshToken)
+	refreshToken.Expiry = time.Now().Add(-time.Minute)
+
+	rec := doTokenRequest(t, router, http.MethodPost, "/tokens/refresh", "", refreshTokenRequest{RefreshToken: pair.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Nil(t, refreshToken.RotatedAt)
+}
@@ -1,16 +1,24 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"regexp"
 
+	"github.com/DavidGudovic/api_exercise/internal/mailer"
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
 	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/tokens"
 	"github.com/DavidGudovic/api_exercise/internal/utils"
 )
 
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
 type registerUserRequest struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
@@ -18,15 +26,49 @@ type registerUserRequest struct {
 	Bio      string `json:"bio"`
 }
 
+type updateUserRequest struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+	Bio      *string `json:"bio"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type passwordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type resendActivationRequest struct {
+	Email string `json:"email"`
+}
+
+type activateUserRequest struct {
+	Token string `json:"token"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
 type UserHandler struct {
-	userStore store.UserStore
-	logger    *log.Logger
+	userStore  store.UserStore
+	tokenStore store.TokenStore
+	mailer     mailer.Mailer
+	baseURL    string
+	logger     *log.Logger
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, tokenStore store.TokenStore, mailer mailer.Mailer, baseURL string, logger *log.Logger) *UserHandler {
 	return &UserHandler{
-		userStore: userStore,
-		logger:    logger,
+		userStore:  userStore,
+		tokenStore: tokenStore,
+		mailer:     mailer,
+		baseURL:    baseURL,
+		logger:     logger,
 	}
 }
 
@@ -35,8 +77,6 @@ func (uh *UserHandler) validateRegisterRequest(req *registerUserRequest) error {
 		return errors.New("username, email and password are required")
 	}
 
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-
 	if !emailRegex.MatchString(req.Email) {
 		return errors.New("invalid email format")
 	}
@@ -82,11 +122,455 @@ func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request
 
 	err = uh.userStore.CreateUser(user)
 
+	if errors.Is(err, store.ErrDuplicateUsername) || errors.Is(err, store.ErrDuplicateEmail) {
+		_ = utils.WriteJson(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	if err != nil {
 		uh.logger.Printf("ERROR: %v", err)
 		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create user"})
 		return
 	}
 
+	// The account exists at this point, so a failed email is logged rather than
+	// reported; the user can ask for a new link at POST /users/activation.
+	err = uh.sendActivationEmail(user)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+	}
+
 	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{"user": user})
 }
+
+// HandleGetCurrentUser GET /users/me
+func (uh *UserHandler) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user, err := uh.userStore.GetUserByID(middleware.GetUser(r).ID)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if user == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "User not found"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleUpdateCurrentUser PATCH /users/me
+func (uh *UserHandler) HandleUpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	var req updateUserRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	user, err := uh.userStore.GetUserByID(middleware.GetUser(r).ID)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if user == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "User not found"})
+		return
+	}
+
+	if req.Username != nil {
+		if *req.Username == "" {
+			_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "username cannot be empty"})
+			return
+		}
+
+		user.Username = *req.Username
+	}
+
+	emailChanged := false
+
+	if req.Email != nil && *req.Email != user.Email {
+		if !emailRegex.MatchString(*req.Email) {
+			_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "invalid email format"})
+			return
+		}
+
+		// A new address has to be verified again before the account is usable.
+		user.Email = *req.Email
+		user.Activated = false
+		emailChanged = true
+	}
+
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+
+	err = uh.userStore.UpdateUser(user)
+
+	if errors.Is(err, store.ErrDuplicateUsername) || errors.Is(err, store.ErrDuplicateEmail) {
+		_ = utils.WriteJson(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update user"})
+		return
+	}
+
+	if emailChanged {
+		// Links mailed to the old address must not activate the new one or
+		// reset the password.
+		for _, scope := range []string{tokens.ScopeActivation, tokens.ScopePasswordReset} {
+			err = uh.tokenStore.DeleteAllTokensForUser(user.ID, scope)
+
+			if err != nil {
+				uh.logger.Printf("ERROR: %v", err)
+				_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to revoke tokens"})
+				return
+			}
+		}
+
+		err = uh.sendActivationEmail(user)
+
+		if err != nil {
+			uh.logger.Printf("ERROR: %v", err)
+		}
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleDeleteCurrentUser DELETE /users/me
+func (uh *UserHandler) HandleDeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	err := uh.userStore.DeleteUser(middleware.GetUser(r).ID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "User not found"})
+		return
+	}
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete user"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusNoContent, nil)
+}
+
+// HandleChangePassword PUT /users/me/password
+func (uh *UserHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req changePasswordRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "current_password and new_password are required"})
+		return
+	}
+
+	user, err := uh.userStore.GetUserByID(middleware.GetUser(r).ID)
+
+	if err != nil || user == nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve user"})
+		return
+	}
+
+	passwordsDoMatch, err := user.PasswordHash.Matches(req.CurrentPassword)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to verify password"})
+		return
+	}
+
+	if !passwordsDoMatch {
+		_ = utils.WriteJson(w, http.StatusUnauthorized, utils.Envelope{"error": "Current password is incorrect"})
+		return
+	}
+
+	err = user.PasswordHash.Set(req.NewPassword)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to set user password"})
+		return
+	}
+
+	err = uh.userStore.UpdateUser(user)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update password"})
+		return
+	}
+
+	// Keep the session that made this request and sign out every other device,
+	// refresh tokens included, so a stolen one cannot mint new auth tokens.
+	err = uh.tokenStore.DeleteOtherSessionsForUser(user.ID, tokens.Hash(middleware.GetToken(r)))
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to revoke other sessions"})
+		return
+	}
+
+	// Calendar feed URLs outlive any session, so a leaked one is revoked too,
+	// as on a password reset. The user can create a new feed URL afterwards.
+	err = uh.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeCalendar)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to revoke calendar tokens"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"message": "Your password has been changed"})
+}
+
+// HandleActivateUser PUT /users/activated
+func (uh *UserHandler) HandleActivateUser(w http.ResponseWriter, r *http.Request) {
+	var req activateUserRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil || req.Token == "" {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	user, err := uh.userStore.GetUserToken(tokens.ScopeActivation, req.Token)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to verify activation token"})
+		return
+	}
+
+	if user == nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid or expired activation token"})
+		return
+	}
+
+	user.Activated = true
+
+	err = uh.userStore.UpdateUser(user)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to activate user"})
+		return
+	}
+
+	err = uh.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeActivation)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleResendActivation POST /users/activation
+//
+// Replaces any pending activation link of an inactive account, for when the
+// first email never arrived or an email change deactivated the account.
+func (uh *UserHandler) HandleResendActivation(w http.ResponseWriter, r *http.Request) {
+	var req resendActivationRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil || req.Email == "" {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	// As with password resets, the response does not reveal whether the email
+	// is registered or already activated.
+	accepted := utils.Envelope{"message": "If that email belongs to an inactive account, an activation link has been sent"}
+
+	user, err := uh.userStore.GetUserByEmail(req.Email)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to resend activation link"})
+		return
+	}
+
+	if user == nil || user.Activated {
+		_ = utils.WriteJson(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	err = uh.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeActivation)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to resend activation link"})
+		return
+	}
+
+	err = uh.sendActivationEmail(user)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to send activation email"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusAccepted, accepted)
+}
+
+func (uh *UserHandler) sendActivationEmail(user *store.User) error {
+	token, err := uh.tokenStore.CreateNewToken(user.ID, tokens.ScopeActivation, tokens.ActivationTTL)
+
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/activate?token=%s", uh.baseURL, url.QueryEscape(token.Plaintext))
+	body := fmt.Sprintf("Hi %s,\n\nThanks for signing up. Confirm your email address to activate your account:\n\n%s\n\nThe link expires in %v.\n", user.Username, link, tokens.ActivationTTL)
+
+	return uh.mailer.Send(user.Email, "Activate your account", body)
+}
+
+// HandleRequestPasswordReset POST /users/password-reset
+func (uh *UserHandler) HandleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil || req.Email == "" {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	// The response is the same whether or not the email is registered, so the
+	// endpoint cannot be used to discover accounts.
+	accepted := utils.Envelope{"message": "If that email is registered, a password reset link has been sent"}
+
+	user, err := uh.userStore.GetUserByEmail(req.Email)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to request password reset"})
+		return
+	}
+
+	if user == nil {
+		_ = utils.WriteJson(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	err = uh.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopePasswordReset)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to request password reset"})
+		return
+	}
+
+	token, err := uh.tokenStore.CreateNewToken(user.ID, tokens.ScopePasswordReset, tokens.PasswordResetTTL)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to request password reset"})
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", uh.baseURL, url.QueryEscape(token.Plaintext))
+	body := fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %v.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n", user.Username, tokens.PasswordResetTTL, link)
+
+	err = uh.mailer.Send(user.Email, "Reset your password", body)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to send password reset email"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusAccepted, accepted)
+}
+
+// HandleResetPassword PUT /users/password
+func (uh *UserHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if req.Token == "" || req.Password == "" {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "token and password are required"})
+		return
+	}
+
+	// Consuming the token up front lets only one of two concurrent requests
+	// with the same link set a password.
+	user, err := uh.userStore.ConsumeUserToken(tokens.ScopePasswordReset, req.Token)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to verify reset token"})
+		return
+	}
+
+	if user == nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	err = user.PasswordHash.Set(req.Password)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to set user password"})
+		return
+	}
+
+	err = uh.userStore.UpdateUser(user)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update password"})
+		return
+	}
+
+	// Other reset links are revoked too, and a new password logs out every
+	// device and calendar subscription.
+	for _, scope := range []string{tokens.ScopePasswordReset, tokens.ScopeRefresh, tokens.ScopeAuth, tokens.ScopeCalendar} {
+		err = uh.tokenStore.DeleteAllTokensForUser(user.ID, scope)
+
+		if err != nil {
+			uh.logger.Printf("ERROR: %v", err)
+			_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to revoke tokens"})
+			return
+		}
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"message": "Your password has been reset"})
+}
@@ -0,0 +1,484 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/mailer"
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/DavidGudovic/api_exercise/internal/tokens"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTokenStore struct {
+	tokens map[string]*tokens.Token
+}
+
+func newFakeTokenStore() *fakeTokenStore {
+	return &fakeTokenStore{tokens: map[string]*tokens.Token{}}
+}
+
+func (s *fakeTokenStore) Insert(token *tokens.Token) error {
+	s.tokens[hex.EncodeToString(token.Hash)] = token
+	return nil
+}
+
+func (s *fakeTokenStore) CreateNewToken(userID int, tokenType string, ttl time.Duration) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, tokenType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return token, s.Insert(token)
+}
+
+func (s *fakeTokenStore) DeleteAllTokensForUser(userID int, tokenType string) error {
+	for key, token := range s.tokens {
+		if token.UserID == userID && token.Scope == tokenType {
+			delete(s.tokens, key)
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeTokenStore) DeleteOtherSessionsForUser(userID int, keepHash []byte) error {
+	kept := s.tokens[hex.EncodeToString(keepHash)]
+
+	for key, token := range s.tokens {
+		if token.UserID == userID && isSessionScope(token.Scope) && (kept == nil || token.SessionID != kept.SessionID) {
+			delete(s.tokens, key)
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeTokenStore) GetTokenByHash(hash []byte) (*tokens.Token, error) {
+	token, ok := s.tokens[hex.EncodeToString(hash)]
+
+	if !ok || !token.Expiry.After(time.Now()) {
+		return nil, nil
+	}
+
+	return token, nil
+}
+
+func (s *fakeTokenStore) MarkTokenRotated(hash []byte) (bool, error) {
+	token, ok := s.tokens[hex.EncodeToString(hash)]
+
+	if !ok || token.RotatedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	token.RotatedAt = &now
+	return true, nil
+}
+
+func (s *fakeTokenStore) DeleteSession(hash []byte, userID int) error {
+	current, ok := s.tokens[hex.EncodeToString(hash)]
+
+	if !ok || current.UserID != userID {
+		return sql.ErrNoRows
+	}
+
+	for key, token := range s.tokens {
+		if token.UserID == userID && isSessionScope(token.Scope) && token.SessionID == current.SessionID {
+			delete(s.tokens, key)
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeTokenStore) GetSessionsForUser(userID int, currentHash []byte) ([]*store.Session, error) {
+	sessions := []*store.Session{}
+	byID := map[string]*store.Session{}
+
+	for _, token := range s.tokens {
+		if token.UserID != userID || token.Scope != tokens.ScopeAuth {
+			continue
+		}
+
+		session, ok := byID[token.SessionID]
+
+		if !ok {
+			session = &store.Session{ID: token.SessionID, CreatedAt: token.CreatedAt, Expiry: token.Expiry}
+			byID[token.SessionID] = session
+			sessions = append(sessions, session)
+		}
+
+		session.Current = session.Current || bytes.Equal(token.Hash, currentHash)
+	}
+
+	return sessions, nil
+}
+
+func (s *fakeTokenStore) countForUser(userID int, scope string) int {
+	count := 0
+
+	for _, token := range s.tokens {
+		if token.UserID == userID && token.Scope == scope {
+			count++
+		}
+	}
+
+	return count
+}
+
+func isSessionScope(scope string) bool {
+	return scope == tokens.ScopeAuth || scope == tokens.ScopeRefresh
+}
+
+type fakeUserStore struct {
+	users      map[int]*store.User
+	tokenStore *fakeTokenStore
+}
+
+func newFakeUserStore(tokenStore *fakeTokenStore) *fakeUserStore {
+	return &fakeUserStore{users: map[int]*store.User{}, tokenStore: tokenStore}
+}
+
+func (s *fakeUserStore) checkUnique(user *store.User) error {
+	for _, existing := range s.users {
+		if existing.ID == user.ID {
+			continue
+		}
+
+		if existing.Username == user.Username {
+			return store.ErrDuplicateUsername
+		}
+
+		if strings.EqualFold(existing.Email, user.Email) {
+			return store.ErrDuplicateEmail
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeUserStore) CreateUser(user *store.User) error {
+	if err := s.checkUnique(user); err != nil {
+		return err
+	}
+
+	user.ID = len(s.users) + 1
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s *fakeUserStore) GetUserByID(id int) (*store.User, error) {
+	user, ok := s.users[id]
+
+	if !ok {
+		return nil, nil
+	}
+
+	found := *user
+	return &found, nil
+}
+
+func (s *fakeUserStore) UpdateUser(user *store.User) error {
+	if _, ok := s.users[user.ID]; !ok {
+		return sql.ErrNoRows
+	}
+
+	if err := s.checkUnique(user); err != nil {
+		return err
+	}
+
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+func (s *fakeUserStore) DeleteUser(id int) error {
+	if _, ok := s.users[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(s.users, id)
+	return nil
+}
+
+func (s *fakeUserStore) GetUserByUsername(username string) (*store.User, error) {
+	for _, user := range s.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *fakeUserStore) GetUserByEmail(email string) (*store.User, error) {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *fakeUserStore) GetUserToken(scope, plaintextPassword string) (*store.User, error) {
+	token, _ := s.tokenStore.GetTokenByHash(tokens.Hash(plaintextPassword))
+
+	if token == nil || token.Scope != scope || token.Expiry.Before(time.Now()) {
+		return nil, nil
+	}
+
+	return s.users[token.UserID], nil
+}
+
+func (s *fakeUserStore) ConsumeUserToken(scope, plaintextPassword string) (*store.User, error) {
+	user, err := s.GetUserToken(scope, plaintextPassword)
+
+	if user != nil {
+		delete(s.tokenStore.tokens, hex.EncodeToString(tokens.Hash(plaintextPassword)))
+	}
+
+	return user, err
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	tokenStore := newFakeTokenStore()
+	userStore := newFakeUserStore(tokenStore)
+
+	user := &store.User{Username: "forgetful", Email: "forgetful@example.com"}
+	require.NoError(t, user.PasswordHash.Set("old-password"))
+	require.NoError(t, userStore.CreateUser(user))
+
+	_, err := tokenStore.CreateNewToken(user.ID, tokens.ScopeAuth, tokens.AuthTTL)
+	require.NoError(t, err)
+
+	var outbox bytes.Buffer
+	handler := NewUserHandler(userStore, tokenStore, mailer.NewLogMailer(&outbox), "http://example.test", log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Post("/users/password-reset", handler.HandleRequestPasswordReset)
+	r.Put("/users/password", handler.HandleResetPassword)
+
+	rec := doRequest(t, r, store.AnonymousUser, http.MethodPost, "/users/password-reset", passwordResetRequest{Email: "nobody@example.com"})
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Empty(t, outbox.String())
+
+	rec = doRequest(t, r, store.AnonymousUser, http.MethodPost, "/users/password-reset", passwordResetRequest{Email: "Forgetful@example.com"})
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Contains(t, outbox.String(), "To: forgetful@example.com")
+
+	match := regexp.MustCompile(`reset-password\?token=([A-Z0-9]+)`).FindStringSubmatch(outbox.String())
+	require.Len(t, match, 2)
+	resetToken := match[1]
+
+	rec = doRequest(t, r, store.AnonymousUser, http.MethodPut, "/users/password", resetPasswordRequest{Token: resetToken, Password: "new-password"})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	matches, err := userStore.users[user.ID].PasswordHash.Matches("new-password")
+	require.NoError(t, err)
+	assert.True(t, matches)
+	assert.Zero(t, tokenStore.countForUser(user.ID, tokens.ScopeAuth))
+	assert.Zero(t, tokenStore.countForUser(user.ID, tokens.ScopePasswordReset))
+
+	rec = doRequest(t, r, store.AnonymousUser, http.MethodPut, "/users/password", resetPasswordRequest{Token: resetToken, Password: "another-password"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	matches, err = userStore.users[user.ID].PasswordHash.Matches("new-password")
+	require.NoError(t, err)
+	assert.True(t, matches)
+}
+
+func TestRegisterAndActivateUser(t *testing.T) {
+	tokenStore := newFakeTokenStore()
+	userStore := newFakeUserStore(tokenStore)
+
+	var outbox bytes.Buffer
+	handler := NewUserHandler(userStore, tokenStore, mailer.NewLogMailer(&outbox), "http://example.test", log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Post("/users/register", handler.HandleRegisterUser)
+	r.Put("/users/activated", handler.HandleActivateUser)
+
+	rec := doRequest(t, r, store.AnonymousUser, http.MethodPost, "/users/register", registerUserRequest{Username: "newbie", Email: "newbie@example.com", Password: "secret-password"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	user, err := userStore.GetUserByUsername("newbie")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.False(t, user.Activated)
+
+	match := regexp.MustCompile(`activate\?token=([A-Z0-9]+)`).FindStringSubmatch(outbox.String())
+	require.Len(t, match, 2)
+
+	rec = doRequest(t, r, store.AnonymousUser, http.MethodPut, "/users/activated", activateUserRequest{Token: match[1]})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, userStore.users[user.ID].Activated)
+	assert.Zero(t, tokenStore.countForUser(user.ID, tokens.ScopeActivation))
+
+	rec = doRequest(t, r, store.AnonymousUser, http.MethodPut, "/users/activated", activateUserRequest{Token: match[1]})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestResendActivation(t *testing.T) {
+	tokenStore := newFakeTokenStore()
+	userStore := newFakeUserStore(tokenStore)
+
+	active := &store.User{Username: "veteran", Email: "veteran@example.com", Activated: true}
+	require.NoError(t, active.PasswordHash.Set("secret-password"))
+	require.NoError(t, userStore.CreateUser(active))
+
+	// The activation email sent at registration never arrived.
+	pending := &store.User{Username: "newbie", Email: "newbie@example.com"}
+	require.NoError(t, pending.PasswordHash.Set("secret-password"))
+	require.NoError(t, userStore.CreateUser(pending))
+
+	lost, err := tokenStore.CreateNewToken(pending.ID, tokens.ScopeActivation, tokens.ActivationTTL)
+	require.NoError(t, err)
+
+	var outbox bytes.Buffer
+	handler := NewUserHandler(userStore, tokenStore, mailer.NewLogMailer(&outbox), "http://example.test", log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Post("/users/activation", handler.HandleResendActivation)
+	r.Put("/users/activated", handler.HandleActivateUser)
+
+	rec := doRequest(t, r, store.AnonymousUser, http.MethodPost, "/users/activation", resendActivationRequest{Email: "nobody@example.com"})
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	unknown := rec.Body.String()
+
+	rec = doRequest(t, r, store.AnonymousUser, http.MethodPost, "/users/activation", resendActivationRequest{Email: "veteran@example.com"})
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, unknown, rec.Body.String())
+	assert.Empty(t, outbox.String())
+
+	rec = doRequest(t, r, store.AnonymousUser, http.MethodPost, "/users/activation", resendActivationRequest{Email: "Newbie@example.com"})
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, unknown, rec.Body.String())
+	assert.Contains(t, outbox.String(), "To: newbie@example.com")
+	assert.Equal(t, 1, tokenStore.countForUser(pending.ID, tokens.ScopeActivation))
+
+	rec = doRequest(t, r, store.AnonymousUser, http.MethodPut, "/users/activated", activateUserRequest{Token: lost.Plaintext})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	match := regexp.MustCompile(`activate\?token=([A-Z0-9]+)`).FindStringSubmatch(outbox.String())
+	require.Len(t, match, 2)
+
+	rec = doRequest(t, r, store.AnonymousUser, http.MethodPut, "/users/activated", activateUserRequest{Token: match[1]})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, userStore.users[pending.ID].Activated)
+
+	rec = doRequest(t, r, store.AnonymousUser, http.MethodPost, "/users/activation", resendActivationRequest{})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestUpdateCurrentUser(t *testing.T) {
+	tokenStore := newFakeTokenStore()
+	userStore := newFakeUserStore(tokenStore)
+
+	alice := &store.User{Username: "alice", Email: "alice@example.com", Bio: "lifter", Activated: true}
+	bob := &store.User{Username: "bob", Email: "bob@example.com", Activated: true}
+	require.NoError(t, userStore.CreateUser(alice))
+	require.NoError(t, userStore.CreateUser(bob))
+
+	handler := NewUserHandler(userStore, tokenStore, mailer.NewLogMailer(io.Discard), "http://example.test", log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Patch("/users/me", handler.HandleUpdateCurrentUser)
+
+	taken := "bob"
+	rec := doRequest(t, r, alice, http.MethodPatch, "/users/me", updateUserRequest{Username: &taken})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	takenEmail := "Bob@Example.com"
+	rec = doRequest(t, r, alice, http.MethodPatch, "/users/me", updateUserRequest{Email: &takenEmail})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	bio := "powerlifter"
+	rec = doRequest(t, r, alice, http.MethodPatch, "/users/me", updateUserRequest{Bio: &bio})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	stored := userStore.users[alice.ID]
+	assert.Equal(t, "alice", stored.Username)
+	assert.Equal(t, "alice@example.com", stored.Email)
+	assert.Equal(t, "powerlifter", stored.Bio)
+	assert.True(t, stored.Activated)
+
+	// Links mailed to the old address stop working once the email changes.
+	oldActivation, err := tokenStore.CreateNewToken(alice.ID, tokens.ScopeActivation, tokens.ActivationTTL)
+	require.NoError(t, err)
+	oldReset, err := tokenStore.CreateNewToken(alice.ID, tokens.ScopePasswordReset, tokens.PasswordResetTTL)
+	require.NoError(t, err)
+
+	newEmail := "alice@new.example.com"
+	rec = doRequest(t, r, alice, http.MethodPatch, "/users/me", updateUserRequest{Email: &newEmail})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, userStore.users[alice.ID].Activated)
+
+	for _, token := range []*tokens.Token{oldActivation, oldReset} {
+		found, err := tokenStore.GetTokenByHash(token.Hash)
+		require.NoError(t, err)
+		assert.Nil(t, found, token.Scope)
+	}
+
+	assert.Equal(t, 1, tokenStore.countForUser(alice.ID, tokens.ScopeActivation))
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	tokenStore := newFakeTokenStore()
+	userStore := newFakeUserStore(tokenStore)
+
+	user := &store.User{Username: "worried", Email: "worried@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("old-password"))
+	require.NoError(t, userStore.CreateUser(user))
+
+	current, err := tokenStore.CreateNewToken(user.ID, tokens.ScopeAuth, tokens.AuthTTL)
+	require.NoError(t, err)
+	_, err = tokenStore.CreateNewToken(user.ID, tokens.ScopeAuth, tokens.AuthTTL)
+	require.NoError(t, err)
+	_, err = tokenStore.CreateNewToken(user.ID, tokens.ScopeRefresh, tokens.RefreshTTL)
+	require.NoError(t, err)
+	_, err = tokenStore.CreateNewToken(user.ID, tokens.ScopeCalendar, tokens.CalendarTTL)
+	require.NoError(t, err)
+
+	handler := NewUserHandler(userStore, tokenStore, mailer.NewLogMailer(io.Discard), "http://example.test", log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, middleware.SetToken(r, current.Plaintext))
+		})
+	})
+	r.Put("/users/me/password", handler.HandleChangePassword)
+
+	rec := doRequest(t, r, user, http.MethodPut, "/users/me/password", changePasswordRequest{CurrentPassword: "wrong", NewPassword: "new-password"})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, 2, tokenStore.countForUser(user.ID, tokens.ScopeAuth))
+	assert.Equal(t, 1, tokenStore.countForUser(user.ID, tokens.ScopeCalendar))
+
+	rec = doRequest(t, r, user, http.MethodPut, "/users/me/password", changePasswordRequest{CurrentPassword: "old-password", NewPassword: "new-password"})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	matches, err := userStore.users[user.ID].PasswordHash.Matches("new-password")
+	require.NoError(t, err)
+	assert.True(t, matches)
+
+	remaining, err := tokenStore.GetTokenByHash(current.Hash)
+	require.NoError(t, err)
+	assert.NotNil(t, remaining)
+	assert.Equal(t, 1, tokenStore.countForUser(user.ID, tokens.ScopeAuth))
+	assert.Zero(t, tokenStore.countForUser(user.ID, tokens.ScopeRefresh))
+	assert.Zero(t, tokenStore.countForUser(user.ID, tokens.ScopeCalendar))
+}
@@ -1,17 +1,29 @@
 package api
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/DavidGudovic/api_exercise/internal/jsonpatch"
 	"github.com/DavidGudovic/api_exercise/internal/middleware"
 	"github.com/DavidGudovic/api_exercise/internal/store"
 	"github.com/DavidGudovic/api_exercise/internal/utils"
 )
 
+const maxPatchBytes = 1 << 20
+
 type WorkoutHandler struct {
 	workoutStore store.WorkoutStore
 	logger       *log.Logger
@@ -25,7 +37,7 @@ func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *Wor
 	}
 }
 
-// HandleGetWorkoutByID GET /workouts/{workoutID}
+// HandleGetWorkoutByID GET /workouts/{id}
 func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 
@@ -35,6 +47,10 @@ func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if !wh.authorizeWorkoutAccess(w, r, workoutID) {
+		return
+	}
+
 	workout, err := wh.workoutStore.GetWorkoutByID(workoutID)
 
 	if err != nil {
@@ -43,6 +59,19 @@ func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if workout == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+		return
+	}
+
+	etag := workoutETag(workout)
+	w.Header().Set("ETag", etag)
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"workout": workout})
 }
 
@@ -60,21 +89,53 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 
 	workout.UserID = middleware.GetUser(r).ID
 
+	err = validateWorkout(&workout)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	createdWorkout, err := wh.workoutStore.CreateWorkout(&workout)
 
+	if errors.Is(err, store.ErrExerciseNotFound) {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	if err != nil {
 		wh.logger.Printf("ERROR: %v", err)
 		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create workout"})
 		return
 	}
 
+	w.Header().Set("ETag", workoutETag(createdWorkout))
 	_ = utils.WriteJson(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
 }
 
-// HandleUpdateWorkout PUT /workouts/{workoutID}
+// HandleUpdateWorkout PUT /workouts/{id}
+//
+// Replaces the workout, except that a missing performed_at keeps the stored
+// one. See store.Workout.InheritTimes.
 func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID"})
+		return
+	}
+
+	if !wh.authorizeWorkoutAccess(w, r, workoutID) {
+		return
+	}
+
+	stored, ok := wh.checkIfMatch(w, r, workoutID)
+
+	if !ok {
+		return
+	}
+
 	workout := store.Workout{
 		ID: workoutID,
 	}
@@ -87,9 +148,39 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	workout.ID = workoutID
 	workout.UserID = middleware.GetUser(r).ID
+	workout.Version = stored.Version
+	workout.InheritTimes(stored)
+
+	err = validateWorkout(&workout)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	updatedWorkout, err := wh.workoutStore.UpdateWorkout(&workout)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+		return
+	}
+
+	if errors.Is(err, store.ErrEntryNotFound) {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 
-	err = wh.workoutStore.UpdateWorkout(&workout)
+	if errors.Is(err, store.ErrExerciseNotFound) {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, store.ErrEditConflict) {
+		_ = utils.WriteJson(w, http.StatusPreconditionFailed, utils.Envelope{"error": err.Error()})
+		return
+	}
 
 	if err != nil {
 		wh.logger.Printf("ERROR: %v", err)
@@ -97,10 +188,129 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"workout": workout})
+	w.Header().Set("ETag", workoutETag(updatedWorkout))
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"workout": updatedWorkout})
 }
 
-// HandleDeleteWorkout DELETE /workouts/{workoutID}
+// HandlePatchWorkout PATCH /workouts/{id}
+//
+// Accepts either a JSON Merge Patch (application/merge-patch+json) or a JSON
+// Patch (application/json-patch+json) and applies it to the stored workout.
+func (wh *WorkoutHandler) HandlePatchWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID"})
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var applyPatch func(doc, patch []byte) ([]byte, error)
+
+	switch mediaType {
+	case "application/merge-patch+json":
+		applyPatch = jsonpatch.MergePatch
+	case "application/json-patch+json":
+		applyPatch = jsonpatch.Apply
+	default:
+		_ = utils.WriteJson(w, http.StatusUnsupportedMediaType, utils.Envelope{"error": "Content-Type must be application/merge-patch+json or application/json-patch+json"})
+		return
+	}
+
+	if !wh.authorizeWorkoutAccess(w, r, workoutID) {
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchBytes))
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Failed to read patch"})
+		return
+	}
+
+	stored, ok := wh.checkIfMatch(w, r, workoutID)
+
+	if !ok {
+		return
+	}
+
+	original, err := json.Marshal(stored)
+
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to encode workout"})
+		return
+	}
+
+	patched, err := applyPatch(original, patch)
+
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		_ = utils.WriteJson(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var workout store.Workout
+
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(&workout)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": fmt.Sprintf("patched workout is invalid: %v", err)})
+		return
+	}
+
+	workout.ID = stored.ID
+	workout.UserID = stored.UserID
+	workout.Version = stored.Version
+	workout.InheritTimes(stored)
+
+	err = validateWorkout(&workout)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	updatedWorkout, err := wh.workoutStore.UpdateWorkout(&workout)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+		return
+	}
+
+	if errors.Is(err, store.ErrEntryNotFound) || errors.Is(err, store.ErrExerciseNotFound) {
+		_ = utils.WriteJson(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, store.ErrEditConflict) {
+		_ = utils.WriteJson(w, http.StatusPreconditionFailed, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update workout"})
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(updatedWorkout))
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"workout": updatedWorkout})
+}
+
+// HandleDeleteWorkout DELETE /workouts/{id}
+//
+// Moves the workout to the trash, from which it can be restored until it is
+// purged.
 func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 
@@ -110,7 +320,27 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = wh.workoutStore.DeleteWorkout(workoutID)
+	if !wh.authorizeWorkoutAccess(w, r, workoutID) {
+		return
+	}
+
+	stored, ok := wh.checkIfMatch(w, r, workoutID)
+
+	if !ok {
+		return
+	}
+
+	err = wh.workoutStore.DeleteWorkout(workoutID, middleware.GetUser(r).ID, stored.Version)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+		return
+	}
+
+	if errors.Is(err, store.ErrEditConflict) {
+		_ = utils.WriteJson(w, http.StatusPreconditionFailed, utils.Envelope{"error": err.Error()})
+		return
+	}
 
 	if err != nil {
 		wh.logger.Printf("ERROR: %v", err)
@@ -121,20 +351,487 @@ func (wh *WorkoutHandler) HandleDeleteWorkout(w http.ResponseWriter, r *http.Req
 	_ = utils.WriteJson(w, http.StatusNoContent, nil)
 }
 
-// HandleGetAllWorkouts GET /workouts
-func (wh *WorkoutHandler) HandleGetAllWorkouts(w http.ResponseWriter, _ *http.Request) {
-	workouts, err := wh.workoutStore.GetAllWorkouts()
+// HandleGetTrash GET /workouts/trash
+//
+// Lists the user's deleted workouts, most recently deleted first, until they
+// are purged. Accepts the page and page_size parameters of
+// HandleGetAllWorkouts; its filters, sort and cursor are rejected.
+func (wh *WorkoutHandler) HandleGetTrash(w http.ResponseWriter, r *http.Request) {
+	err := rejectQueryParams(r.URL.Query(), "cursor", "sort", "title", "from", "to", "min_duration", "max_duration", "min_calories", "max_calories", "tag", "tag_match")
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	filter, err := readWorkoutFilter(r.URL.Query())
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	workouts, metadata, err := wh.workoutStore.GetDeletedWorkouts(middleware.GetUser(r).ID, filter)
+
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve deleted workouts"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{
+		"workouts": workouts,
+		"metadata": metadata,
+		"links":    paginationLinks(r.URL, metadata),
+	})
+}
+
+// HandleRestoreWorkout POST /workouts/{id}/restore
+func (wh *WorkoutHandler) HandleRestoreWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID"})
+		return
+	}
+
+	workout, err := wh.workoutStore.RestoreWorkout(workoutID, middleware.GetUser(r).ID)
 
 	if errors.Is(err, sql.ErrNoRows) {
-		_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"workouts": []store.Workout{}})
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found in the trash"})
 		return
 	}
 
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to restore workout"})
+		return
+	}
+
+	// Another request may have deleted the workout again right after it was
+	// restored.
+	if workout == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout))
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"workout": workout})
+}
+
+// HandleGetAllWorkouts GET /workouts
+//
+// Pages are numbered by page, or continue from the metadata's next_cursor
+// when it is passed as cursor. Cursor pages stay stable while workouts are
+// added, which shifts numbered pages.
+func (wh *WorkoutHandler) HandleGetAllWorkouts(w http.ResponseWriter, r *http.Request) {
+	filter, err := readWorkoutFilter(r.URL.Query())
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	workouts, metadata, err := wh.workoutStore.GetAllWorkouts(middleware.GetUser(r).ID, filter)
+
 	if err != nil {
 		wh.logger.Printf("ERROR: %v", err)
 		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve workouts"})
 		return
 	}
 
-	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"workouts": workouts})
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{
+		"workouts": workouts,
+		"metadata": metadata,
+		"links":    paginationLinks(r.URL, metadata),
+	})
+}
+
+// maxSearchQueryLength bounds q so that a search cannot parse an arbitrarily
+// large tsquery.
+const maxSearchQueryLength = 200
+
+// HandleSearchWorkouts GET /workouts/search?q=
+//
+// Returns the user's workouts whose title, description, exercise names or
+// entry notes match q, best matches first. Accepts the page, page_size, from
+// and to parameters of HandleGetAllWorkouts; the other filters and sort are
+// rejected since results are always ordered by rank.
+func (wh *WorkoutHandler) HandleSearchWorkouts(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	query := strings.TrimSpace(qs.Get("q"))
+
+	if query == "" {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "q is required"})
+		return
+	}
+
+	if len(query) > maxSearchQueryLength {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("q must be at most %d bytes long", maxSearchQueryLength)})
+		return
+	}
+
+	err := rejectQueryParams(qs, "cursor", "sort", "title", "min_duration", "max_duration", "min_calories", "max_calories", "tag", "tag_match")
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	filter, err := readWorkoutFilter(qs)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	results, metadata, err := wh.workoutStore.SearchWorkouts(middleware.GetUser(r).ID, query, filter)
+
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to search workouts"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{
+		"results":  results,
+		"metadata": metadata,
+		"links":    paginationLinks(r.URL, metadata),
+	})
+}
+
+// HandleGetWorkoutTrack GET /workouts/{id}/track
+func (wh *WorkoutHandler) HandleGetWorkoutTrack(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		_ = utils.WriteJson(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid workout ID"})
+		return
+	}
+
+	if !wh.authorizeWorkoutAccess(w, r, workoutID) {
+		return
+	}
+
+	points, err := wh.workoutStore.GetTrackPoints(workoutID)
+
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve track"})
+		return
+	}
+
+	_ = utils.WriteJson(w, http.StatusOK, utils.Envelope{"track_points": points})
+}
+
+// authorizeWorkoutAccess writes a 404 or 403 response and returns false unless
+// the workout exists and belongs to the authenticated user.
+func (wh *WorkoutHandler) authorizeWorkoutAccess(w http.ResponseWriter, r *http.Request, workoutID int) bool {
+	ownerID, err := wh.workoutStore.GetWorkoutOwnerID(workoutID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+		return false
+	}
+
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve workout"})
+		return false
+	}
+
+	if ownerID != middleware.GetUser(r).ID {
+		_ = utils.WriteJson(w, http.StatusForbidden, utils.Envelope{"error": "You do not have permission to access this workout"})
+		return false
+	}
+
+	return true
+}
+
+// checkIfMatch enforces the If-Match precondition required on writes. It
+// returns the stored workout when the header matches its current ETag and
+// otherwise writes a 428 or 412 response.
+func (wh *WorkoutHandler) checkIfMatch(w http.ResponseWriter, r *http.Request, workoutID int) (*store.Workout, bool) {
+	ifMatch := r.Header.Get("If-Match")
+
+	if ifMatch == "" {
+		_ = utils.WriteJson(w, http.StatusPreconditionRequired, utils.Envelope{"error": "If-Match header is required"})
+		return nil, false
+	}
+
+	stored, err := wh.workoutStore.GetWorkoutByID(workoutID)
+
+	if err != nil {
+		wh.logger.Printf("ERROR: %v", err)
+		_ = utils.WriteJson(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve workout"})
+		return nil, false
+	}
+
+	if stored == nil {
+		_ = utils.WriteJson(w, http.StatusNotFound, utils.Envelope{"error": "Workout not found"})
+		return nil, false
+	}
+
+	etag := workoutETag(stored)
+
+	if !etagMatches(ifMatch, etag, false) {
+		w.Header().Set("ETag", etag)
+		_ = utils.WriteJson(w, http.StatusPreconditionFailed, utils.Envelope{"error": "Workout has been modified since it was retrieved"})
+		return nil, false
+	}
+
+	return stored, true
+}
+
+func workoutETag(workout *store.Workout) string {
+	return fmt.Sprintf(`"%d"`, workout.Version)
+}
+
+// etagMatches reports whether etag is listed in an If-Match or If-None-Match
+// header. If-None-Match uses weak comparison, so a W/ prefix is ignored there.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateWorkout mirrors the database constraints so that bad input is
+// reported as a 422 instead of failing on insert.
+func validateWorkout(workout *store.Workout) error {
+	if workout.Title == "" {
+		return errors.New("title is required")
+	}
+
+	if workout.DurationMinutes < 0 {
+		return errors.New("duration_minutes must not be negative")
+	}
+
+	if workout.CaloriesBurned < 0 {
+		return errors.New("calories_burned must not be negative")
+	}
+
+	if workout.StartedAt != nil && workout.EndedAt != nil && workout.EndedAt.Before(*workout.StartedAt) {
+		return errors.New("ended_at must not be before started_at")
+	}
+
+	if workout.EndedAt != nil && workout.StartedAt == nil {
+		return errors.New("started_at is required when ended_at is given")
+	}
+
+	err := normalizeTags(workout)
+
+	if err != nil {
+		return err
+	}
+
+	return validateEntries(workout.Entries)
+}
+
+// validateEntries checks workout and template entries against the
+// workout_entries constraints.
+func validateEntries(entries []store.WorkoutEntry) error {
+	for i, entry := range entries {
+		err := validateEntry(entry)
+
+		if err != nil {
+			return fmt.Errorf("entries[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func validateEntry(entry store.WorkoutEntry) error {
+	if entry.ExerciseName == "" {
+		return errors.New("exercise_name is required")
+	}
+
+	if entry.Sets < 0 {
+		return errors.New("sets must not be negative")
+	}
+
+	if (entry.Reps == nil) == (entry.DurationSeconds == nil) {
+		return errors.New("exactly one of reps or duration_seconds is required")
+	}
+
+	if entry.Weight != nil && (*entry.Weight < 0 || *entry.Weight >= 1000) {
+		return errors.New("weight must be between 0 and 999.99")
+	}
+
+	if entry.DistanceMeters != nil && (*entry.DistanceMeters < 0 || *entry.DistanceMeters >= 1e8) {
+		return errors.New("distance_meters must be between 0 and 99999999.99")
+	}
+
+	if entry.ElevationGainMeters != nil && (*entry.ElevationGainMeters < 0 || *entry.ElevationGainMeters >= 1e5) {
+		return errors.New("elevation_gain_meters must be between 0 and 99999.99")
+	}
+
+	for _, heartRate := range []*int{entry.AvgHeartRate, entry.MaxHeartRate} {
+		if heartRate != nil && (*heartRate < 1 || *heartRate > 300) {
+			return errors.New("heart rates must be between 1 and 300")
+		}
+	}
+
+	if entry.AvgHeartRate != nil && entry.MaxHeartRate != nil && *entry.AvgHeartRate > *entry.MaxHeartRate {
+		return errors.New("avg_heart_rate must not exceed max_heart_rate")
+	}
+
+	return nil
+}
+
+func readWorkoutFilter(qs url.Values) (store.WorkoutFilter, error) {
+	var err error
+
+	filter := store.WorkoutFilter{
+		Sort:  utils.ReadString(qs, "sort", "-performed_at"),
+		Title: utils.ReadString(qs, "title", ""),
+	}
+
+	if filter.Page, err = utils.ReadInt(qs, "page", 1); err != nil {
+		return filter, err
+	}
+
+	if filter.PageSize, err = utils.ReadInt(qs, "page_size", 20); err != nil {
+		return filter, err
+	}
+
+	if filter.Page < 1 || filter.Page > 10_000_000 {
+		return filter, errors.New("page must be between 1 and 10000000")
+	}
+
+	if filter.PageSize < 1 || filter.PageSize > 100 {
+		return filter, errors.New("page_size must be between 1 and 100")
+	}
+
+	if !slices.Contains(store.WorkoutSortSafelist, filter.Sort) {
+		return filter, fmt.Errorf("sort must be one of %v", store.WorkoutSortSafelist)
+	}
+
+	if cursor := qs.Get("cursor"); cursor != "" {
+		if qs.Has("page") {
+			return filter, errors.New("page and cursor cannot be combined")
+		}
+
+		if filter.After, err = store.DecodeCursor(cursor, filter.Sort); err != nil {
+			return filter, err
+		}
+	}
+
+	if filter.From, err = utils.ReadOptionalTime(qs, "from"); err != nil {
+		return filter, err
+	}
+
+	if filter.To, err = utils.ReadOptionalTime(qs, "to"); err != nil {
+		return filter, err
+	}
+
+	// A bare date in "to" covers the whole day.
+	if filter.To != nil && len(qs.Get("to")) == len(time.DateOnly) {
+		endOfDay := filter.To.Add(24*time.Hour - time.Nanosecond)
+		filter.To = &endOfDay
+	}
+
+	if filter.MinDuration, err = utils.ReadOptionalInt(qs, "min_duration"); err != nil {
+		return filter, err
+	}
+
+	if filter.MaxDuration, err = utils.ReadOptionalInt(qs, "max_duration"); err != nil {
+		return filter, err
+	}
+
+	if filter.MinCalories, err = utils.ReadOptionalInt(qs, "min_calories"); err != nil {
+		return filter, err
+	}
+
+	if filter.MaxCalories, err = utils.ReadOptionalInt(qs, "max_calories"); err != nil {
+		return filter, err
+	}
+
+	for _, tag := range strings.Split(qs.Get("tag"), ",") {
+		if tag = strings.ToLower(strings.Join(strings.Fields(tag), " ")); tag != "" && !slices.Contains(filter.Tags, tag) {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
+
+	switch utils.ReadString(qs, "tag_match", "any") {
+	case "any":
+	case "all":
+		filter.TagMatchAll = true
+	default:
+		return filter, errors.New("tag_match must be any or all")
+	}
+
+	return filter, nil
+}
+
+// rejectQueryParams fails for the first of names that the query sets, for
+// endpoints that share readWorkoutFilter but cannot honor every parameter.
+func rejectQueryParams(qs url.Values, names ...string) error {
+	for _, name := range names {
+		if qs.Has(name) {
+			return fmt.Errorf("%s is not supported by this endpoint", name)
+		}
+	}
+
+	return nil
+}
+
+// paginationLinks builds self, first, last, next and prev URLs that keep the
+// request's filters and only change the page number. Pages read with a
+// cursor only link to the first page and, through the next cursor, onwards.
+func paginationLinks(requestURL *url.URL, metadata store.Metadata) map[string]*string {
+	linkWith := func(key, value string) *string {
+		qs := requestURL.Query()
+		qs.Del("page")
+		qs.Del("cursor")
+		qs.Set(key, value)
+		link := requestURL.Path + "?" + qs.Encode()
+		return &link
+	}
+
+	linkTo := func(page int) *string {
+		return linkWith("page", strconv.Itoa(page))
+	}
+
+	links := map[string]*string{"self": nil, "first": nil, "last": nil, "next": nil, "prev": nil}
+
+	if metadata.TotalRecords == 0 {
+		return links
+	}
+
+	if metadata.CurrentPage == 0 {
+		links["self"] = linkWith("cursor", requestURL.Query().Get("cursor"))
+		links["first"] = linkTo(1)
+
+		if metadata.NextCursor != "" {
+			links["next"] = linkWith("cursor", metadata.NextCursor)
+		}
+
+		return links
+	}
+
+	links["self"] = linkTo(metadata.CurrentPage)
+	links["first"] = linkTo(metadata.FirstPage)
+	links["last"] = linkTo(metadata.LastPage)
+
+	if metadata.CurrentPage < metadata.LastPage {
+		links["next"] = linkTo(metadata.CurrentPage + 1)
+	}
+
+	// A page past the end leads back to the last one.
+	if metadata.CurrentPage > metadata.FirstPage {
+		links["prev"] = linkTo(min(metadata.CurrentPage-1, metadata.LastPage))
+	}
+
+	return links
 }
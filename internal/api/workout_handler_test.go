@@ -0,0 +1,874 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/middleware"
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeWorkoutStore struct {
+	workouts map[int]*store.Workout
+	nextID   int
+}
+
+func newFakeWorkoutStore() *fakeWorkoutStore {
+	return &fakeWorkoutStore{workouts: map[int]*store.Workout{}, nextID: 1}
+}
+
+func (s *fakeWorkoutStore) CreateWorkout(workout *store.Workout) (*store.Workout, error) {
+	workout.ID = s.nextID
+	workout.Version = 1
+	s.nextID++
+	stored := *workout
+	s.workouts[workout.ID] = &stored
+	return workout, nil
+}
+
+func (s *fakeWorkoutStore) CreateWorkouts(workouts []*store.Workout) error {
+	for _, workout := range workouts {
+		_, _ = s.CreateWorkout(workout)
+	}
+
+	return nil
+}
+
+// live returns the workout unless it is missing or in the trash.
+func (s *fakeWorkoutStore) live(id int) (*store.Workout, bool) {
+	workout, ok := s.workouts[id]
+
+	if !ok || workout.DeletedAt != nil {
+		return nil, false
+	}
+
+	return workout, true
+}
+
+func (s *fakeWorkoutStore) GetWorkoutByID(id int) (*store.Workout, error) {
+	workout, ok := s.live(id)
+
+	if !ok {
+		return nil, nil
+	}
+
+	found := *workout
+	return &found, nil
+}
+
+func (s *fakeWorkoutStore) UpdateWorkout(workout *store.Workout) (*store.Workout, error) {
+	existing, ok := s.live(workout.ID)
+
+	if !ok || existing.UserID != workout.UserID {
+		return nil, sql.ErrNoRows
+	}
+
+	if existing.Version != workout.Version {
+		return nil, store.ErrEditConflict
+	}
+
+	stored := *workout
+	stored.Version++
+	s.workouts[workout.ID] = &stored
+	return s.GetWorkoutByID(workout.ID)
+}
+
+func (s *fakeWorkoutStore) DeleteWorkout(id, userID, version int) error {
+	existing, ok := s.live(id)
+
+	if !ok || existing.UserID != userID {
+		return sql.ErrNoRows
+	}
+
+	if existing.Version != version {
+		return store.ErrEditConflict
+	}
+
+	deletedAt := time.Now()
+	existing.DeletedAt = &deletedAt
+	existing.Version++
+	return nil
+}
+
+func (s *fakeWorkoutStore) RestoreWorkout(id, userID int) (*store.Workout, error) {
+	existing, ok := s.workouts[id]
+
+	if !ok || existing.UserID != userID || existing.DeletedAt == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	existing.DeletedAt = nil
+	existing.Version++
+	return s.GetWorkoutByID(id)
+}
+
+// GetDeletedWorkouts ignores pagination and lists the trash in ID order.
+func (s *fakeWorkoutStore) GetDeletedWorkouts(userID int, filter store.WorkoutFilter) ([]*store.Workout, store.Metadata, error) {
+	workouts := []*store.Workout{}
+
+	for id := 1; id < s.nextID; id++ {
+		if workout, ok := s.workouts[id]; ok && workout.UserID == userID && workout.DeletedAt != nil {
+			workouts = append(workouts, workout)
+		}
+	}
+
+	return workouts, store.Metadata{TotalRecords: len(workouts)}, nil
+}
+
+func (s *fakeWorkoutStore) PurgeDeletedWorkouts(deletedBefore time.Time) (int, error) {
+	purged := 0
+
+	for id, workout := range s.workouts {
+		if workout.DeletedAt != nil && workout.DeletedAt.Before(deletedBefore) {
+			delete(s.workouts, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (s *fakeWorkoutStore) GetAllWorkouts(userID int, filter store.WorkoutFilter) ([]*store.Workout, store.Metadata, error) {
+	workouts := []*store.Workout{}
+
+	for id := 1; id < s.nextID; id++ {
+		if workout, ok := s.live(id); ok && workout.UserID == userID && matchesTags(workout, filter) &&
+			strings.Contains(strings.ToLower(workout.Title), strings.ToLower(filter.Title)) {
+			workouts = append(workouts, workout)
+		}
+	}
+
+	total := len(workouts)
+
+	if filter.After != nil {
+		start := len(workouts)
+
+		for i, workout := range workouts {
+			if workout.ID > filter.After.ID {
+				start = i
+				break
+			}
+		}
+
+		end := min(start+filter.PageSize, total)
+		metadata := store.Metadata{PageSize: filter.PageSize, TotalRecords: total}
+
+		if end < total {
+			metadata.NextCursor = store.NewCursor(workouts[end-1], filter.Sort).Encode()
+		}
+
+		return workouts[start:end], metadata, nil
+	}
+
+	start := min(filter.Page*filter.PageSize-filter.PageSize, total)
+	end := min(start+filter.PageSize, total)
+	metadata := store.Metadata{TotalRecords: total}
+
+	if total > 0 {
+		metadata = store.Metadata{
+			CurrentPage:  filter.Page,
+			PageSize:     filter.PageSize,
+			FirstPage:    1,
+			LastPage:     (total + filter.PageSize - 1) / filter.PageSize,
+			TotalRecords: total,
+		}
+
+		if end < total {
+			metadata.NextCursor = store.NewCursor(workouts[end-1], filter.Sort).Encode()
+		}
+	}
+
+	return workouts[start:end], metadata, nil
+}
+
+func matchesTags(workout *store.Workout, filter store.WorkoutFilter) bool {
+	matched := 0
+
+	for _, tag := range filter.Tags {
+		if slices.Contains(workout.Tags, tag) {
+			matched++
+		}
+	}
+
+	if filter.TagMatchAll {
+		return matched == len(filter.Tags)
+	}
+
+	return len(filter.Tags) == 0 || matched > 0
+}
+
+func (s *fakeWorkoutStore) ExportWorkouts(userID int, visit func(*store.Workout) error) error {
+	for id := 1; id < s.nextID; id++ {
+		if workout, ok := s.live(id); ok && workout.UserID == userID {
+			if err := visit(workout); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SearchWorkouts matches q as a case-insensitive substring instead of
+// running a full-text search, and ranks title matches above the rest.
+func (s *fakeWorkoutStore) SearchWorkouts(userID int, query string, filter store.WorkoutFilter) ([]*store.WorkoutSearchResult, store.Metadata, error) {
+	results := []*store.WorkoutSearchResult{}
+	query = strings.ToLower(query)
+
+	for id := 1; id < s.nextID; id++ {
+		workout, ok := s.live(id)
+
+		if !ok || workout.UserID != userID {
+			continue
+		}
+
+		texts := []string{workout.Title, workout.Description}
+
+		for _, entry := range workout.Entries {
+			texts = append(texts, entry.ExerciseName, entry.Notes)
+		}
+
+		for i, text := range texts {
+			if strings.Contains(strings.ToLower(text), query) {
+				rank := 0.5
+
+				if i == 0 {
+					rank = 1
+				}
+
+				results = append(results, &store.WorkoutSearchResult{Workout: workout, Rank: rank, Snippet: text})
+				break
+			}
+		}
+	}
+
+	slices.SortStableFunc(results, func(a, b *store.WorkoutSearchResult) int { return cmp.Compare(b.Rank, a.Rank) })
+
+	return results, store.Metadata{TotalRecords: len(results)}, nil
+}
+
+func (s *fakeWorkoutStore) GetTrackPoints(workoutID int) ([]store.TrackPoint, error) {
+	points := []store.TrackPoint{}
+
+	if workout, ok := s.workouts[workoutID]; ok {
+		for _, entry := range workout.Entries {
+			for _, point := range entry.TrackPoints {
+				point.EntryID = entry.ID
+				points = append(points, point)
+			}
+		}
+	}
+
+	return points, nil
+}
+
+func (s *fakeWorkoutStore) GetWorkoutOwnerID(workoutID int) (int, error) {
+	workout, ok := s.live(workoutID)
+
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	return workout.UserID, nil
+}
+
+var (
+	owner    = &store.User{ID: 1, Username: "owner"}
+	intruder = &store.User{ID: 2, Username: "intruder"}
+)
+
+func setupWorkoutRouter(workoutStore store.WorkoutStore) http.Handler {
+	handler := NewWorkoutHandler(workoutStore, log.New(io.Discard, "", 0))
+
+	r := chi.NewRouter()
+	r.Get("/workouts", handler.HandleGetAllWorkouts)
+	r.Post("/workouts", handler.HandleCreateWorkout)
+	r.Get("/workouts/search", handler.HandleSearchWorkouts)
+	r.Get("/workouts/trash", handler.HandleGetTrash)
+	r.Get("/workouts/{id}", handler.HandleGetWorkoutByID)
+	r.Put("/workouts/{id}", handler.HandleUpdateWorkout)
+	r.Patch("/workouts/{id}", handler.HandlePatchWorkout)
+	r.Delete("/workouts/{id}", handler.HandleDeleteWorkout)
+	r.Get("/workouts/{id}/track", handler.HandleGetWorkoutTrack)
+	r.Post("/workouts/{id}/restore", handler.HandleRestoreWorkout)
+
+	return r
+}
+
+func doRequest(t *testing.T, handler http.Handler, user *store.User, method, target string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return doConditionalRequest(t, handler, user, method, target, "", body)
+}
+
+// doConditionalRequest sends ifMatch as the If-Match header when it is not empty.
+func doConditionalRequest(t *testing.T, handler http.Handler, user *store.User, method, target, ifMatch string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var payload io.Reader
+
+	if body != nil {
+		js, err := json.Marshal(body)
+		require.NoError(t, err)
+		payload = bytes.NewReader(js)
+	}
+
+	req := httptest.NewRequest(method, target, payload)
+	req = middleware.SetUser(req, user)
+
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestWorkoutOwnership(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(workoutStore)
+
+	rec := doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{Title: "push day", DurationMinutes: 60})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	tests := []struct {
+		name       string
+		user       *store.User
+		method     string
+		target     string
+		body       interface{}
+		wantStatus int
+	}{
+		{
+			name:       "owner can read workout",
+			user:       owner,
+			method:     http.MethodGet,
+			target:     "/workouts/1",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "intruder cannot read workout",
+			user:       intruder,
+			method:     http.MethodGet,
+			target:     "/workouts/1",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "intruder cannot update workout",
+			user:       intruder,
+			method:     http.MethodPut,
+			target:     "/workouts/1",
+			body:       store.Workout{Title: "hijacked", DurationMinutes: 1},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "intruder cannot delete workout",
+			user:       intruder,
+			method:     http.MethodDelete,
+			target:     "/workouts/1",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "missing workout is not found",
+			user:       owner,
+			method:     http.MethodGet,
+			target:     "/workouts/42",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, router, tt.user, tt.method, tt.target, tt.body)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+
+	stored, err := workoutStore.GetWorkoutByID(1)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "push day", stored.Title)
+	assert.Equal(t, owner.ID, stored.UserID)
+}
+
+func TestGetAllWorkoutsOnlyReturnsOwnWorkouts(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(workoutStore)
+
+	_ = doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{Title: "owner day", DurationMinutes: 30})
+	_ = doRequest(t, router, intruder, http.MethodPost, "/workouts", store.Workout{Title: "intruder day", DurationMinutes: 45})
+
+	rec := doRequest(t, router, intruder, http.MethodGet, "/workouts", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Workouts []store.Workout `json:"workouts"`
+	}
+
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response.Workouts, 1)
+	assert.Equal(t, "intruder day", response.Workouts[0].Title)
+	assert.Equal(t, intruder.ID, response.Workouts[0].UserID)
+}
+
+func TestOwnerCanUpdateAndDeleteWorkout(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(workoutStore)
+
+	_ = doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{Title: "leg day", DurationMinutes: 50})
+
+	rec := doConditionalRequest(t, router, owner, http.MethodPut, "/workouts/1", `"1"`, store.Workout{Title: "heavy leg day", DurationMinutes: 70})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	stored, err := workoutStore.GetWorkoutByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, "heavy leg day", stored.Title)
+
+	rec = doConditionalRequest(t, router, owner, http.MethodDelete, "/workouts/1", `"2"`, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	stored, err = workoutStore.GetWorkoutByID(1)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+}
+
+func TestUpdateWorkoutKeepsTimes(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(workoutStore)
+
+	performedAt := time.Date(2025, 3, 3, 18, 0, 0, 0, time.UTC)
+	startedAt := performedAt
+	endedAt := performedAt.Add(time.Hour)
+
+	rec := doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{
+		Title:           "back-dated",
+		PerformedAt:     performedAt,
+		StartedAt:       &startedAt,
+		EndedAt:         &endedAt,
+		DurationMinutes: 60,
+	})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	// performed_at is left out and ended_at moves by half an hour.
+	laterEnd := endedAt.Add(30 * time.Minute)
+	rec = doConditionalRequest(t, router, owner, http.MethodPut, "/workouts/1", `"1"`, map[string]interface{}{
+		"title":            "back-dated",
+		"started_at":       startedAt,
+		"ended_at":         laterEnd,
+		"duration_minutes": 60,
+	})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	stored, err := workoutStore.GetWorkoutByID(1)
+	require.NoError(t, err)
+	assert.True(t, performedAt.Equal(stored.PerformedAt), "performed_at moved to %s", stored.PerformedAt)
+	assert.Equal(t, 90, stored.DurationMinutes)
+
+	rec = doPatch(router, owner, "/workouts/1", "application/merge-patch+json", `{"ended_at":"2025-03-03T18:45:00Z"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	stored, err = workoutStore.GetWorkoutByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, 45, stored.DurationMinutes)
+
+	// An explicit duration wins over the times.
+	rec = doPatch(router, owner, "/workouts/1", "application/merge-patch+json", `{"ended_at":"2025-03-03T19:00:00Z","duration_minutes":50}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	stored, err = workoutStore.GetWorkoutByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, 50, stored.DurationMinutes)
+	assert.True(t, performedAt.Equal(stored.PerformedAt))
+}
+
+func TestGetAllWorkoutsPagination(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(workoutStore)
+
+	for i := 0; i < 5; i++ {
+		_ = doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{Title: "session", DurationMinutes: 30})
+	}
+
+	rec := doRequest(t, router, owner, http.MethodGet, "/workouts?page=2&page_size=2&sort=title", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Workouts []store.Workout    `json:"workouts"`
+		Metadata store.Metadata     `json:"metadata"`
+		Links    map[string]*string `json:"links"`
+	}
+
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response.Workouts, 2)
+	assert.Equal(t, 5, response.Metadata.TotalRecords)
+	assert.Equal(t, 3, response.Metadata.LastPage)
+	require.NotNil(t, response.Links["next"])
+	assert.Equal(t, "/workouts?page=3&page_size=2&sort=title", *response.Links["next"])
+	require.NotNil(t, response.Links["prev"])
+	assert.Equal(t, "/workouts?page=1&page_size=2&sort=title", *response.Links["prev"])
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts?page=9&page_size=2&sort=title", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	response.Links = nil
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Empty(t, response.Workouts)
+	assert.Equal(t, 5, response.Metadata.TotalRecords)
+	assert.Nil(t, response.Links["next"])
+	require.NotNil(t, response.Links["prev"])
+	assert.Equal(t, "/workouts?page=3&page_size=2&sort=title", *response.Links["prev"])
+
+	for _, query := range []string{"page=0", "page_size=500", "sort=password_hash", "min_duration=abc", "from=yesterday"} {
+		rec = doRequest(t, router, owner, http.MethodGet, "/workouts?"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestGetAllWorkoutsTitleFilter(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(workoutStore)
+
+	for _, title := range []string{"100% effort", "1000m row", "Easy_run", "Easy run"} {
+		_ = doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{Title: title, DurationMinutes: 30})
+	}
+
+	titles := func(query string) []string {
+		rec := doRequest(t, router, owner, http.MethodGet, "/workouts?sort=id&title="+url.QueryEscape(query), nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Workouts []store.Workout `json:"workouts"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+
+		names := []string{}
+
+		for _, workout := range response.Workouts {
+			names = append(names, workout.Title)
+		}
+
+		return names
+	}
+
+	assert.Equal(t, []string{"100% effort"}, titles("100%"))
+	assert.Equal(t, []string{"Easy_run"}, titles("y_r"))
+	assert.Equal(t, []string{"Easy_run", "Easy run"}, titles("EASY"))
+}
+
+func TestGetAllWorkoutsCursor(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(workoutStore)
+
+	for i := 0; i < 5; i++ {
+		_ = doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{Title: "session", DurationMinutes: 30})
+	}
+
+	type page struct {
+		Workouts []store.Workout    `json:"workouts"`
+		Metadata store.Metadata     `json:"metadata"`
+		Links    map[string]*string `json:"links"`
+	}
+
+	next := "/workouts?page_size=2&sort=id"
+	seen := []int{}
+
+	for next != "" {
+		rec := doRequest(t, router, owner, http.MethodGet, next, nil)
+		require.Equal(t, http.StatusOK, rec.Code, next)
+
+		var response page
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, 5, response.Metadata.TotalRecords)
+
+		for _, workout := range response.Workouts {
+			seen = append(seen, workout.ID)
+		}
+
+		if len(seen) > 2 {
+			assert.Zero(t, response.Metadata.CurrentPage)
+			assert.Nil(t, response.Links["prev"])
+		}
+
+		next = ""
+
+		if response.Metadata.NextCursor != "" {
+			next = "/workouts?cursor=" + response.Metadata.NextCursor + "&page_size=2&sort=id"
+
+			if len(seen) > 2 {
+				require.NotNil(t, response.Links["next"])
+				assert.Equal(t, next, *response.Links["next"])
+			}
+		}
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, seen)
+
+	cursor := store.Cursor{Sort: "id", Value: "2", ID: 2}.Encode()
+
+	for _, query := range []string{
+		"cursor=not-a-cursor",
+		"sort=title&cursor=" + cursor,
+		"page=2&sort=id&cursor=" + cursor,
+		"sort=id&cursor=" + store.Cursor{Sort: "id", Value: "two", ID: 2}.Encode(),
+	} {
+		rec := doRequest(t, router, owner, http.MethodGet, "/workouts?"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+
+	for _, target := range []string{"/workouts/trash?sort=id&cursor=" + cursor, "/workouts/search?q=session&sort=id&cursor=" + cursor} {
+		rec := doRequest(t, router, owner, http.MethodGet, target, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+	}
+}
+
+func doPatch(handler http.Handler, user *store.User, target, contentType, patch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(patch))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("If-Match", "*")
+	req = middleware.SetUser(req, user)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestPatchWorkout(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(workoutStore)
+
+	_ = doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{
+		Title:           "push day",
+		Description:     "chest and triceps",
+		DurationMinutes: 60,
+		Entries: []store.WorkoutEntry{
+			{ID: 7, ExerciseName: "Bench Press", Sets: 3, Reps: intPtr(5)},
+		},
+	})
+
+	rec := doPatch(router, owner, "/workouts/1", "application/merge-patch+json", `{"title":"heavy push day"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	stored, err := workoutStore.GetWorkoutByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, "heavy push day", stored.Title)
+	assert.Equal(t, "chest and triceps", stored.Description)
+	assert.Equal(t, 60, stored.DurationMinutes)
+	require.Len(t, stored.Entries, 1)
+
+	rec = doPatch(router, owner, "/workouts/1", "application/json-patch+json", `[{"op":"replace","path":"/entries/0/reps","value":6}]`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	stored, err = workoutStore.GetWorkoutByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, 6, *stored.Entries[0].Reps)
+	assert.Equal(t, 7, stored.Entries[0].ID)
+
+	tests := []struct {
+		name        string
+		user        *store.User
+		contentType string
+		patch       string
+		wantStatus  int
+	}{
+		{"plain json is rejected", owner, "application/json", `{"title":"x"}`, http.StatusUnsupportedMediaType},
+		{"failed test op conflicts", owner, "application/json-patch+json", `[{"op":"test","path":"/title","value":"leg day"}]`, http.StatusConflict},
+		{"invalid result is rejected", owner, "application/merge-patch+json", `{"title":null}`, http.StatusUnprocessableEntity},
+		{"entry constraint is enforced", owner, "application/json-patch+json", `[{"op":"add","path":"/entries/0/duration_seconds","value":30}]`, http.StatusUnprocessableEntity},
+		{"intruder cannot patch", intruder, "application/merge-patch+json", `{"title":"hijacked"}`, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doPatch(router, tt.user, "/workouts/1", tt.contentType, tt.patch)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestWorkoutPreconditions(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(workoutStore)
+
+	rec := doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{Title: "push day", DurationMinutes: 60})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req := httptest.NewRequest(http.MethodGet, "/workouts/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	req = middleware.SetUser(req, owner)
+	notModified := httptest.NewRecorder()
+	router.ServeHTTP(notModified, req)
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.String())
+
+	update := store.Workout{Title: "heavy push day", DurationMinutes: 75}
+
+	rec = doRequest(t, router, owner, http.MethodPut, "/workouts/1", update)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+
+	rec = doConditionalRequest(t, router, owner, http.MethodPut, "/workouts/1", etag, update)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+
+	// A second device still holding the old ETag must not overwrite the change.
+	rec = doConditionalRequest(t, router, owner, http.MethodPut, "/workouts/1", etag, store.Workout{Title: "stale edit", DurationMinutes: 10})
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = doConditionalRequest(t, router, owner, http.MethodDelete, "/workouts/1", etag, nil)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	stored, err := workoutStore.GetWorkoutByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, "heavy push day", stored.Title)
+
+	req = httptest.NewRequest(http.MethodGet, "/workouts/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	req = middleware.SetUser(req, owner)
+	modified := httptest.NewRecorder()
+	router.ServeHTTP(modified, req)
+	assert.Equal(t, http.StatusOK, modified.Code)
+}
+
+func TestSearchWorkouts(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(workoutStore)
+
+	for _, workout := range []*store.Workout{
+		{Title: "Push", UserID: owner.ID, Entries: []store.WorkoutEntry{{ExerciseName: "Bench Press", Sets: 1, Reps: intPtr(5), Notes: "shoulder hurt on the last set"}}},
+		{Title: "Shoulder day", UserID: owner.ID},
+		{Title: "Pull", UserID: owner.ID},
+		{Title: "Shoulder rehab", UserID: intruder.ID},
+	} {
+		_, err := workoutStore.CreateWorkout(workout)
+		require.NoError(t, err)
+	}
+
+	rec := doRequest(t, router, owner, http.MethodGet, "/workouts/search", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts/search?q="+strings.Repeat("a", maxSearchQueryLength+1), nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts/search?q=shoulder&page_size=0", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Results are ranked and only filtered by date, so the other listing
+	// parameters would be silently ignored.
+	for _, query := range []string{"sort=title", "title=push", "tag=deload", "min_duration=30"} {
+		rec = doRequest(t, router, owner, http.MethodGet, "/workouts/search?q=shoulder&"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts/search?q=shoulder", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Results  []store.WorkoutSearchResult `json:"results"`
+		Metadata store.Metadata              `json:"metadata"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response.Results, 2)
+	assert.Equal(t, "Shoulder day", response.Results[0].Workout.Title)
+	assert.Equal(t, "Push", response.Results[1].Workout.Title)
+	assert.Equal(t, "shoulder hurt on the last set", response.Results[1].Snippet)
+	assert.Equal(t, 2, response.Metadata.TotalRecords)
+}
+
+func TestTrashAndRestoreWorkout(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(workoutStore)
+
+	rec := doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{Title: "leg day", DurationMinutes: 50})
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = doConditionalRequest(t, router, owner, http.MethodDelete, "/workouts/1", `"1"`, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	assert.Equal(t, http.StatusNotFound, doRequest(t, router, owner, http.MethodGet, "/workouts/1", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doConditionalRequest(t, router, owner, http.MethodDelete, "/workouts/1", `"2"`, nil).Code)
+
+	var response struct {
+		Workouts []*store.Workout `json:"workouts"`
+	}
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts", nil)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Empty(t, response.Workouts)
+
+	rec = doRequest(t, router, owner, http.MethodGet, "/workouts/trash", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response.Workouts, 1)
+	assert.Equal(t, "leg day", response.Workouts[0].Title)
+	assert.NotNil(t, response.Workouts[0].DeletedAt)
+
+	rec = doRequest(t, router, intruder, http.MethodGet, "/workouts/trash", nil)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Empty(t, response.Workouts)
+
+	for _, query := range []string{"sort=title", "title=leg", "from=2025-01-01", "max_calories=100", "tag=deload"} {
+		rec = doRequest(t, router, owner, http.MethodGet, "/workouts/trash?"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+
+	assert.Equal(t, http.StatusNotFound, doRequest(t, router, intruder, http.MethodPost, "/workouts/1/restore", nil).Code)
+
+	rec = doRequest(t, router, owner, http.MethodPost, "/workouts/1/restore", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	assert.NotContains(t, rec.Body.String(), "deleted_at")
+
+	assert.Equal(t, http.StatusOK, doRequest(t, router, owner, http.MethodGet, "/workouts/1", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, router, owner, http.MethodPost, "/workouts/1/restore", nil).Code)
+}
+
+// redeletingWorkoutStore deletes a workout again as soon as it is restored,
+// like a concurrent DELETE landing before the restored workout is read back.
+type redeletingWorkoutStore struct {
+	*fakeWorkoutStore
+}
+
+func (s redeletingWorkoutStore) RestoreWorkout(id, userID int) (*store.Workout, error) {
+	if _, err := s.fakeWorkoutStore.RestoreWorkout(id, userID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s.workouts[id].DeletedAt = &now
+	return s.GetWorkoutByID(id)
+}
+
+func TestRestoreWorkoutDeletedAgain(t *testing.T) {
+	workoutStore := newFakeWorkoutStore()
+	router := setupWorkoutRouter(redeletingWorkoutStore{workoutStore})
+
+	_ = doRequest(t, router, owner, http.MethodPost, "/workouts", store.Workout{Title: "leg day", DurationMinutes: 45})
+	require.Equal(t, http.StatusNoContent, doConditionalRequest(t, router, owner, http.MethodDelete, "/workouts/1", `"1"`, nil).Code)
+
+	rec := doRequest(t, router, owner, http.MethodPost, "/workouts/1/restore", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Header().Get("ETag"))
+}
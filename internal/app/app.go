@@ -1,24 +1,39 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/DavidGudovic/api_exercise/internal/analytics"
 	"github.com/DavidGudovic/api_exercise/internal/api"
+	"github.com/DavidGudovic/api_exercise/internal/mailer"
 	"github.com/DavidGudovic/api_exercise/internal/middleware"
 	"github.com/DavidGudovic/api_exercise/internal/store"
 	"github.com/DavidGudovic/api_exercise/migrations"
 )
 
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	TokenHandler   *api.TokenHandler
-	Middleware     middleware.UserMiddleware
-	DB             *sql.DB
+	Logger           *log.Logger
+	WorkoutHandler   *api.WorkoutHandler
+	UserHandler      *api.UserHandler
+	TokenHandler     *api.TokenHandler
+	ExerciseHandler  *api.ExerciseHandler
+	RecordHandler    *api.RecordHandler
+	AnalyticsHandler *api.AnalyticsHandler
+	TemplateHandler  *api.TemplateHandler
+	ProgramHandler   *api.ProgramHandler
+	ImportHandler    *api.ImportHandler
+	CalendarHandler  *api.CalendarHandler
+	TagHandler       *api.TagHandler
+	Middleware       middleware.UserMiddleware
+	DB               *sql.DB
+	stopPurge        context.CancelFunc
+	purgeDone        chan struct{}
 }
 
 func NewApplication() (*Application, error) {
@@ -39,25 +54,109 @@ func NewApplication() (*Application, error) {
 	workoutStore := store.NewPostgresWorkoutStore(pgDB)
 	userStore := store.NewPostgresUserStore(pgDB)
 	tokenStore := store.NewPostgresTokenStore(pgDB)
+	exerciseStore := store.NewPostgresExerciseStore(pgDB)
+	recordStore := store.NewPostgresPersonalRecordStore(pgDB)
+	analyticsStore := analytics.NewPostgresStore(pgDB)
+	templateStore := store.NewPostgresTemplateStore(pgDB)
+	tagStore := store.NewPostgresTagStore(pgDB)
+	programStore := store.NewPostgresProgramStore(pgDB)
 
 	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
-	userHandler := api.NewUserHandler(userStore, logger)
+	userHandler := api.NewUserHandler(userStore, tokenStore, newMailer(logger), baseURL(), logger)
 	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
+	exerciseHandler := api.NewExerciseHandler(exerciseStore, logger)
+	recordHandler := api.NewRecordHandler(recordStore, exerciseStore, logger)
+	analyticsHandler := api.NewAnalyticsHandler(analyticsStore, exerciseStore, logger)
+	templateHandler := api.NewTemplateHandler(templateStore, workoutStore, logger)
+	programHandler := api.NewProgramHandler(programStore, templateStore, logger)
+	importHandler := api.NewImportHandler(workoutStore, logger)
+	calendarHandler := api.NewCalendarHandler(workoutStore, programStore, tokenStore, baseURL(), logger)
+	tagHandler := api.NewTagHandler(tagStore, logger)
 	middlewareHandler := middleware.UserMiddleware{UserStore: userStore}
 
 	app := &Application{
-		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHandler,
-		TokenHandler:   tokenHandler,
-		Middleware:     middlewareHandler,
-		DB:             pgDB,
+		Logger:           logger,
+		WorkoutHandler:   workoutHandler,
+		UserHandler:      userHandler,
+		TokenHandler:     tokenHandler,
+		ExerciseHandler:  exerciseHandler,
+		RecordHandler:    recordHandler,
+		AnalyticsHandler: analyticsHandler,
+		TemplateHandler:  templateHandler,
+		ProgramHandler:   programHandler,
+		ImportHandler:    importHandler,
+		CalendarHandler:  calendarHandler,
+		TagHandler:       tagHandler,
+		Middleware:       middlewareHandler,
+		DB:               pgDB,
+		purgeDone:        make(chan struct{}),
 	}
 
+	ctx, stopPurge := context.WithCancel(context.Background())
+	app.stopPurge = stopPurge
+
+	go func() {
+		defer close(app.purgeDone)
+		purgeTrash(ctx, workoutStore, trashRetention(logger), trashPurgeInterval, logger)
+	}()
+
 	return app, nil
 }
 
+// Close stops the background trash purge, waiting for a running purge to
+// finish, and then closes the database.
+func (a *Application) Close() error {
+	a.stopPurge()
+	<-a.purgeDone
+
+	return a.DB.Close()
+}
+
 func (a *Application) HealthCheck(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("Listening for requests"))
 }
+
+// newMailer sends real email when SMTP_HOST is set and otherwise logs messages to stdout.
+func newMailer(logger *log.Logger) mailer.Mailer {
+	host := os.Getenv("SMTP_HOST")
+
+	if host == "" {
+		logger.Println("SMTP_HOST not set, emails will be written to stdout")
+		return mailer.NewLogMailer(os.Stdout)
+	}
+
+	port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+
+	if err != nil {
+		port = 587
+	}
+
+	return mailer.NewSMTPMailer(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("SMTP_SENDER"))
+}
+
+func baseURL() string {
+	if url := os.Getenv("APP_BASE_URL"); url != "" {
+		return url
+	}
+
+	return "http://localhost:8080"
+}
+
+// trashRetention reads how long deleted workouts stay restorable from
+// TRASH_RETENTION_DAYS and defaults to 30 days.
+func trashRetention(logger *log.Logger) time.Duration {
+	days := 30
+
+	if value := os.Getenv("TRASH_RETENTION_DAYS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+
+		if err != nil || parsed < 1 {
+			logger.Printf("TRASH_RETENTION_DAYS must be a positive number of days, using %d", days)
+		} else {
+			days = parsed
+		}
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
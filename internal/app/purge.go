@@ -0,0 +1,37 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+)
+
+// trashPurgeInterval is how often workouts past the trash retention window
+// are purged.
+const trashPurgeInterval = time.Hour
+
+// purgeTrash permanently deletes the workouts that have been in the trash for
+// longer than retention, once on startup and then on every interval, until
+// ctx is done.
+func purgeTrash(ctx context.Context, workoutStore store.WorkoutStore, retention, interval time.Duration, logger *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := workoutStore.PurgeDeletedWorkouts(time.Now().Add(-retention))
+
+		if err != nil {
+			logger.Printf("ERROR: purging deleted workouts: %v", err)
+		} else if purged > 0 {
+			logger.Printf("purged %d deleted workouts", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
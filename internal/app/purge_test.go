@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingWorkoutStore only implements the purge; any other method panics.
+type countingWorkoutStore struct {
+	store.WorkoutStore
+	purges atomic.Int32
+}
+
+func (s *countingWorkoutStore) PurgeDeletedWorkouts(deletedBefore time.Time) (int, error) {
+	s.purges.Add(1)
+	return 0, nil
+}
+
+func TestPurgeTrashStopsWithContext(t *testing.T) {
+	workoutStore := &countingWorkoutStore{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		purgeTrash(ctx, workoutStore, time.Hour, time.Millisecond, log.New(io.Discard, "", 0))
+	}()
+
+	assert.Eventually(t, func() bool { return workoutStore.purges.Load() >= 2 }, time.Second, time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("purgeTrash did not stop after its context was canceled")
+	}
+}
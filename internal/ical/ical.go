@@ -0,0 +1,131 @@
+// Package ical writes iCalendar (RFC 5545) feeds of events.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxLineOctets is the length after which content lines must be folded.
+	maxLineOctets = 75
+
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405Z"
+)
+
+// Event is a VEVENT. All-day events only use the date of Start and End, and
+// End is exclusive as the RFC requires.
+type Event struct {
+	UID          string
+	Start        time.Time
+	End          *time.Time
+	AllDay       bool
+	Summary      string
+	Description  string
+	Sequence     int
+	LastModified *time.Time
+}
+
+// Calendar writes a VCALENDAR to w. Call Close to finish the feed.
+type Calendar struct {
+	w     *bufio.Writer
+	stamp time.Time
+}
+
+// NewCalendar writes the calendar header. name is shown by calendar apps as
+// the title of the subscription.
+func NewCalendar(w io.Writer, productID, name string) *Calendar {
+	calendar := &Calendar{w: bufio.NewWriter(w), stamp: time.Now().UTC()}
+
+	calendar.line("BEGIN:VCALENDAR")
+	calendar.line("VERSION:2.0")
+	calendar.line("PRODID:" + productID)
+	calendar.line("CALSCALE:GREGORIAN")
+	calendar.line("METHOD:PUBLISH")
+	calendar.line("X-WR-CALNAME:" + EscapeText(name))
+
+	return calendar
+}
+
+func (c *Calendar) WriteEvent(event Event) {
+	c.line("BEGIN:VEVENT")
+	c.line("UID:" + event.UID)
+	c.line("DTSTAMP:" + c.stamp.Format(dateTimeLayout))
+
+	if event.AllDay {
+		c.line("DTSTART;VALUE=DATE:" + event.Start.Format(dateLayout))
+	} else {
+		c.line("DTSTART:" + event.Start.UTC().Format(dateTimeLayout))
+	}
+
+	if event.End != nil && event.AllDay {
+		c.line("DTEND;VALUE=DATE:" + event.End.Format(dateLayout))
+	} else if event.End != nil {
+		c.line("DTEND:" + event.End.UTC().Format(dateTimeLayout))
+	}
+
+	c.line("SUMMARY:" + EscapeText(event.Summary))
+
+	if event.Description != "" {
+		c.line("DESCRIPTION:" + EscapeText(event.Description))
+	}
+
+	if event.Sequence > 0 {
+		c.line("SEQUENCE:" + strconv.Itoa(event.Sequence))
+	}
+
+	if event.LastModified != nil {
+		c.line("LAST-MODIFIED:" + event.LastModified.UTC().Format(dateTimeLayout))
+	}
+
+	c.line("END:VEVENT")
+}
+
+// Close ends the calendar and flushes it, returning the first write error.
+func (c *Calendar) Close() error {
+	c.line("END:VCALENDAR")
+	return c.w.Flush()
+}
+
+// line writes a content line terminated by CRLF, folding it into lines of at
+// most maxLineOctets without splitting a UTF-8 sequence. Write errors are
+// kept by the bufio.Writer and reported by Close.
+func (c *Calendar) line(content string) {
+	limit := maxLineOctets
+
+	for len(content) > limit {
+		cut := limit
+
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+
+		_, _ = c.w.WriteString(content[:cut])
+		_, _ = c.w.WriteString("\r\n ")
+		content = content[cut:]
+
+		// Continuation lines start with a space, which counts towards the limit.
+		limit = maxLineOctets - 1
+	}
+
+	_, _ = c.w.WriteString(content)
+	_, _ = c.w.WriteString("\r\n")
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+// EscapeText escapes a value of the TEXT type.
+func EscapeText(text string) string {
+	return textEscaper.Replace(text)
+}
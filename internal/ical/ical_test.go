@@ -0,0 +1,54 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendar(t *testing.T) {
+	var out bytes.Buffer
+	start := time.Date(2025, 3, 3, 18, 0, 0, 0, time.FixedZone("CET", 3600))
+	end := start.Add(65 * time.Minute)
+	day := time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC)
+	nextDay := day.AddDate(0, 0, 1)
+
+	calendar := NewCalendar(&out, "-//test//EN", "Workouts")
+	calendar.WriteEvent(Event{UID: "workout-1@test", Start: start, End: &end, Summary: "Push, heavy", Description: "Bench; 5x5\nDip", Sequence: 2})
+	calendar.WriteEvent(Event{UID: "session-1-2@test", Start: day, End: &nextDay, AllDay: true, Summary: "Week 1 day 2"})
+	require.NoError(t, calendar.Close())
+
+	lines := strings.Split(out.String(), "\r\n")
+	assert.Equal(t, "BEGIN:VCALENDAR", lines[0])
+	assert.Equal(t, "", lines[len(lines)-1])
+	assert.Equal(t, "END:VCALENDAR", lines[len(lines)-2])
+	assert.Contains(t, lines, "DTSTART:20250303T170000Z")
+	assert.Contains(t, lines, "DTEND:20250303T180500Z")
+	assert.Contains(t, lines, `SUMMARY:Push\, heavy`)
+	assert.Contains(t, lines, `DESCRIPTION:Bench\; 5x5\nDip`)
+	assert.Contains(t, lines, "SEQUENCE:2")
+	assert.Contains(t, lines, "DTSTART;VALUE=DATE:20250305")
+	assert.Contains(t, lines, "DTEND;VALUE=DATE:20250306")
+}
+
+func TestLineFolding(t *testing.T) {
+	var out bytes.Buffer
+	summary := strings.Repeat("ü", 100)
+
+	calendar := NewCalendar(&out, "-//test//EN", "Workouts")
+	calendar.WriteEvent(Event{UID: "1", Start: time.Now(), Summary: summary})
+	require.NoError(t, calendar.Close())
+
+	unfolded := strings.ReplaceAll(out.String(), "\r\n ", "")
+	assert.Contains(t, unfolded, "SUMMARY:"+summary+"\r\n")
+
+	for _, line := range strings.Split(out.String(), "\r\n") {
+		assert.LessOrEqual(t, len(line), maxLineOctets, line)
+		assert.True(t, utf8.ValidString(line), line)
+	}
+}
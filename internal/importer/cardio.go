@@ -0,0 +1,192 @@
+package importer
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+)
+
+// elevationThreshold is the change in meters that counts as a climb. Smaller
+// changes are mostly GPS noise and would inflate the elevation gain.
+const elevationThreshold = 3
+
+const earthRadiusMeters = 6371000
+
+var ErrNoTimestamps = errors.New("the recording has no timestamps")
+
+// cardioExercises maps the activity types of GPX and FIT files onto catalog
+// exercise names.
+var cardioExercises = map[string]string{
+	"running":  "Running",
+	"run":      "Running",
+	"cycling":  "Cycling",
+	"biking":   "Cycling",
+	"ride":     "Cycling",
+	"rowing":   "Rowing",
+	"walking":  "Walking",
+	"hiking":   "Hiking",
+	"swimming": "Swimming",
+}
+
+func cardioExercise(activity string) string {
+	if name, ok := cardioExercises[strings.ToLower(strings.TrimSpace(activity))]; ok {
+		return name
+	}
+
+	return "Cardio"
+}
+
+// trackSummary holds the totals of a recording. Devices that compute their
+// own totals, such as FIT sessions, override the values derived from the
+// points.
+type trackSummary struct {
+	start, end    time.Time
+	movingSeconds *int
+	distance      *float64
+	elevationGain *float64
+	avgHeartRate  *int
+	maxHeartRate  *int
+}
+
+// summarizeTrack derives the totals of a recording. Distance is not counted
+// across the gaps between segments.
+func summarizeTrack(segments [][]store.TrackPoint) trackSummary {
+	summary := trackSummary{}
+	var distance, gain float64
+	hasPosition, hasElevation := false, false
+	heartRateSum, heartRateCount, maxHeartRate := 0, 0, 0
+
+	for _, segment := range segments {
+		var previous *store.TrackPoint
+		var reference *float64
+
+		for i := range segment {
+			point := &segment[i]
+
+			if point.RecordedAt != nil {
+				if summary.start.IsZero() || point.RecordedAt.Before(summary.start) {
+					summary.start = *point.RecordedAt
+				}
+
+				if point.RecordedAt.After(summary.end) {
+					summary.end = *point.RecordedAt
+				}
+			}
+
+			if point.Latitude != nil && point.Longitude != nil {
+				if previous != nil {
+					distance += haversine(*previous.Latitude, *previous.Longitude, *point.Latitude, *point.Longitude)
+				}
+
+				hasPosition = true
+				previous = point
+			}
+
+			if point.ElevationMeters != nil {
+				elevation := *point.ElevationMeters
+				hasElevation = true
+
+				if reference == nil {
+					reference = &elevation
+				} else if climb := elevation - *reference; climb >= elevationThreshold {
+					gain += climb
+					reference = &elevation
+				} else if climb <= -elevationThreshold {
+					reference = &elevation
+				}
+			}
+
+			if point.HeartRate != nil {
+				heartRateSum += *point.HeartRate
+				heartRateCount++
+				maxHeartRate = max(maxHeartRate, *point.HeartRate)
+			}
+		}
+	}
+
+	if hasPosition {
+		summary.distance = &distance
+	}
+
+	if hasElevation {
+		summary.elevationGain = &gain
+	}
+
+	if heartRateCount > 0 {
+		average := int(math.Round(float64(heartRateSum) / float64(heartRateCount)))
+		summary.avgHeartRate = &average
+		summary.maxHeartRate = &maxHeartRate
+	}
+
+	return summary
+}
+
+// haversine returns the great-circle distance in meters between two points.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// cardioEntry builds a single-set entry whose duration is the moving time, or
+// the elapsed time when the recording does not say.
+func cardioEntry(exercise string, summary trackSummary, points []store.TrackPoint) store.WorkoutEntry {
+	seconds := int(summary.end.Sub(summary.start).Round(time.Second).Seconds())
+
+	if summary.movingSeconds != nil {
+		seconds = *summary.movingSeconds
+	}
+
+	return store.WorkoutEntry{
+		ExerciseName:        exercise,
+		Sets:                1,
+		DurationSeconds:     &seconds,
+		DistanceMeters:      roundTo(summary.distance, 2),
+		ElevationGainMeters: roundTo(summary.elevationGain, 2),
+		AvgHeartRate:        summary.avgHeartRate,
+		MaxHeartRate:        summary.maxHeartRate,
+		TrackPoints:         points,
+	}
+}
+
+// cardioWorkout builds the workout for a recording that ran from start to end.
+func cardioWorkout(userID int, title string, start, end time.Time, entries []store.WorkoutEntry) (*store.Workout, error) {
+	if start.IsZero() {
+		return nil, ErrNoTimestamps
+	}
+
+	for i := range entries {
+		entries[i].OrderIndex = i + 1
+	}
+
+	if title == "" && len(entries) > 0 {
+		title = entries[0].ExerciseName
+	}
+
+	return &store.Workout{
+		UserID:          userID,
+		Title:           title,
+		PerformedAt:     start,
+		StartedAt:       &start,
+		EndedAt:         &end,
+		DurationMinutes: int(end.Sub(start).Round(time.Minute).Minutes()),
+		Entries:         entries,
+	}, nil
+}
+
+func roundTo(value *float64, decimals int) *float64 {
+	if value == nil {
+		return nil
+	}
+
+	scale := math.Pow(10, float64(decimals))
+	rounded := math.Round(*value*scale) / scale
+	return &rounded
+}
@@ -0,0 +1,177 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGPX(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"
+     xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+  <metadata><name>Morning Run</name></metadata>
+  <trk>
+    <type>running</type>
+    <trkseg>
+      <trkpt lat="45.0000" lon="19.0000"><ele>80</ele><time>2025-06-01T06:00:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>120</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+      <trkpt lat="45.0090" lon="19.0000"><ele>81</ele><time>2025-06-01T06:05:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>150</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="46.0000" lon="19.0000"><ele>90</ele><time>2025-06-01T06:20:00Z</time></trkpt>
+      <trkpt lat="46.0090" lon="19.0000"><ele>85</ele><time>2025-06-01T06:29:40Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>171</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions>
+      </trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+	workout, err := ParseGPX(strings.NewReader(content), 4)
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, workout.UserID)
+	assert.Equal(t, "Morning Run", workout.Title)
+	assert.Equal(t, time.Date(2025, 6, 1, 6, 0, 0, 0, time.UTC), workout.PerformedAt)
+	assert.Equal(t, 30, workout.DurationMinutes)
+	require.NotNil(t, workout.EndedAt)
+	assert.Equal(t, time.Date(2025, 6, 1, 6, 29, 40, 0, time.UTC), *workout.EndedAt)
+
+	require.Len(t, workout.Entries, 1)
+	entry := workout.Entries[0]
+	assert.Equal(t, "Running", entry.ExerciseName)
+	assert.Equal(t, 1, entry.OrderIndex)
+	assert.Equal(t, 1780, *entry.DurationSeconds)
+	// Two segments of 0.009 degrees of latitude each; the gap between them
+	// is not counted.
+	assert.InDelta(t, 2001.5, *entry.DistanceMeters, 0.5)
+	assert.Equal(t, 0.0, *entry.ElevationGainMeters)
+	assert.Equal(t, 147, *entry.AvgHeartRate)
+	assert.Equal(t, 171, *entry.MaxHeartRate)
+	require.Len(t, entry.TrackPoints, 4)
+	assert.Nil(t, entry.TrackPoints[2].HeartRate)
+
+	_, err = ParseGPX(strings.NewReader(`<gpx><trk><trkseg><trkpt lat="1" lon="2"/></trkseg></trk></gpx>`), 4)
+	assert.ErrorIs(t, err, ErrNoTimestamps)
+
+	_, err = ParseGPX(strings.NewReader(`<gpx></gpx>`), 4)
+	assert.EqualError(t, err, "the file has no track points")
+
+	_, err = ParseGPX(strings.NewReader(`<kml></kml>`), 4)
+	assert.ErrorContains(t, err, "the file is not valid GPX")
+}
+
+func TestSummarizeTrackElevationGain(t *testing.T) {
+	segment := []float64{100, 101, 100, 102, 104, 103, 110, 108, 104, 109}
+	points := make([]store.TrackPoint, len(segment))
+
+	for i := range segment {
+		points[i].ElevationMeters = &segment[i]
+	}
+
+	summary := summarizeTrack([][]store.TrackPoint{points})
+
+	// The wobble below three meters is ignored: 100 -> 104 -> 110, then
+	// down to 104 and up to 109.
+	assert.Equal(t, 15.0, *summary.elevationGain)
+	assert.Nil(t, summary.distance)
+	assert.Nil(t, summary.avgHeartRate)
+}
+
+// fitWriter builds FIT files for tests.
+type fitWriter struct {
+	body bytes.Buffer
+}
+
+func (w *fitWriter) define(local byte, global uint16, fields ...fitField) {
+	w.body.WriteByte(0x40 | local)
+	w.body.Write([]byte{0, 0})
+	_ = binary.Write(&w.body, binary.LittleEndian, global)
+	w.body.WriteByte(byte(len(fields)))
+
+	for _, field := range fields {
+		w.body.Write([]byte{field.number, field.size, 0})
+	}
+}
+
+func (w *fitWriter) data(header byte, values ...any) {
+	w.body.WriteByte(header)
+
+	for _, value := range values {
+		_ = binary.Write(&w.body, binary.LittleEndian, value)
+	}
+}
+
+func (w *fitWriter) bytes() []byte {
+	file := []byte{12, 0x10, 0, 0, 0, 0, 0, 0, '.', 'F', 'I', 'T'}
+	binary.LittleEndian.PutUint32(file[4:8], uint32(w.body.Len()))
+	file = append(file, w.body.Bytes()...)
+
+	return binary.LittleEndian.AppendUint16(file, fitCRC(file))
+}
+
+func TestParseFIT(t *testing.T) {
+	start := time.Date(2025, 6, 1, 6, 0, 0, 0, time.UTC)
+	startFIT := uint32(start.Sub(fitEpoch).Seconds())
+	toSemicircles := func(degrees float64) int32 { return int32(degrees / semicirclesToDegrees) }
+
+	w := &fitWriter{}
+	w.define(0, fitMessageRecord,
+		fitField{fitFieldTimestamp, 4}, fitField{0, 4}, fitField{1, 4}, fitField{2, 2}, fitField{3, 1}, fitField{5, 4})
+	w.data(0, startFIT, toSemicircles(45), toSemicircles(19), uint16((80+500)*5), uint8(120), uint32(0))
+	w.data(0, startFIT+10, toSemicircles(45.0009), toSemicircles(19), uint16((84+500)*5), uint8(0xFF), uint32(10000))
+
+	// A compressed timestamp header for local message 1, two seconds on.
+	w.define(1, fitMessageRecord, fitField{0, 4}, fitField{1, 4}, fitField{3, 1})
+	w.data(0x80|1<<5|byte((startFIT+12)&0x1F), toSemicircles(45.0018), toSemicircles(19), uint8(160))
+
+	w.define(2, fitMessageSession,
+		fitField{2, 4}, fitField{7, 4}, fitField{8, 4}, fitField{9, 4}, fitField{5, 1}, fitField{22, 2}, fitField{17, 1})
+	w.data(2, startFIT, uint32(1_805_400), uint32(1_750_000), uint32(520_000), uint8(1), uint16(42), uint8(182))
+
+	workout, err := ParseFIT(bytes.NewReader(w.bytes()), 9)
+	require.NoError(t, err)
+
+	assert.Equal(t, 9, workout.UserID)
+	assert.Equal(t, "Running", workout.Title)
+	assert.Equal(t, start, workout.PerformedAt)
+	assert.Equal(t, 30, workout.DurationMinutes)
+	require.NotNil(t, workout.EndedAt)
+	assert.Equal(t, start.Add(30*time.Minute+5*time.Second), *workout.EndedAt)
+
+	require.Len(t, workout.Entries, 1)
+	entry := workout.Entries[0]
+	assert.Equal(t, 1750, *entry.DurationSeconds)
+	assert.Equal(t, 5200.0, *entry.DistanceMeters)
+	assert.Equal(t, 42.0, *entry.ElevationGainMeters)
+	assert.Equal(t, 140, *entry.AvgHeartRate)
+	assert.Equal(t, 182, *entry.MaxHeartRate)
+
+	require.Len(t, entry.TrackPoints, 3)
+	assert.InDelta(t, 45.0009, *entry.TrackPoints[1].Latitude, 1e-6)
+	assert.Equal(t, 84.0, *entry.TrackPoints[1].ElevationMeters)
+	assert.Nil(t, entry.TrackPoints[1].HeartRate)
+	assert.Equal(t, start.Add(12*time.Second), *entry.TrackPoints[2].RecordedAt)
+	assert.Nil(t, entry.TrackPoints[2].ElevationMeters)
+
+	corrupted := w.bytes()
+	corrupted[20] ^= 0xFF
+	_, err = ParseFIT(bytes.NewReader(corrupted), 9)
+	assert.EqualError(t, err, "the FIT file is corrupted")
+
+	_, err = ParseFIT(strings.NewReader("<gpx></gpx>"), 9)
+	assert.EqualError(t, err, "the file is not a FIT file")
+}
+
+func TestFITCRC(t *testing.T) {
+	assert.Equal(t, uint16(0xBB3D), fitCRC([]byte("123456789")))
+}
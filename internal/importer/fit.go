@@ -0,0 +1,440 @@
+package importer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+)
+
+// The FIT protocol is a stream of definition messages, which describe the
+// layout of the data messages that follow them under a local message number.
+// Only the session, sport and record messages are read; everything else is
+// skipped using its definition.
+
+const (
+	fitMessageSession = 18
+	fitMessageRecord  = 20
+	fitMessageSport   = 12
+
+	fitFieldTimestamp = 253
+
+	// semicirclesToDegrees converts FIT positions, which span the full range
+	// of an int32, to degrees.
+	semicirclesToDegrees = 180.0 / (1 << 31)
+)
+
+// fitEpoch is the zero of FIT timestamps.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+var errNotFIT = errors.New("the file is not a FIT file")
+
+// fitSports names the values of the FIT sport enum that map onto exercises.
+var fitSports = map[uint64]string{
+	1:  "running",
+	2:  "cycling",
+	5:  "swimming",
+	11: "walking",
+	15: "rowing",
+	17: "hiking",
+}
+
+type fitField struct {
+	number, size byte
+}
+
+type fitDefinition struct {
+	global        uint16
+	bigEndian     bool
+	fields        []fitField
+	developerSize int
+}
+
+// fitMessage holds the raw bytes of each field of a data message.
+type fitMessage struct {
+	global    uint16
+	bigEndian bool
+	fields    map[byte][]byte
+}
+
+// ParseFIT reads a Garmin FIT activity file into a workout with a single
+// cardio entry. Totals recorded by the device in its session message take
+// precedence over totals derived from the track points.
+func ParseFIT(r io.Reader, userID int) (*store.Workout, error) {
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := decodeFIT(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	points := []store.TrackPoint{}
+	var session *fitMessage
+	var sport, sportName string
+	var recordedDistance *float64
+
+	for _, message := range messages {
+		switch message.global {
+		case fitMessageRecord:
+			points = append(points, message.trackPoint())
+
+			if distance, ok := message.uint(5); ok {
+				meters := float64(distance) / 100
+				recordedDistance = &meters
+			}
+		case fitMessageSession:
+			if session == nil {
+				session = &message
+			}
+		case fitMessageSport:
+			if value, ok := message.uint(0); ok {
+				sport = fitSports[value]
+			}
+
+			sportName = message.string(3)
+		}
+	}
+
+	if len(points) == 0 && session == nil {
+		return nil, errors.New("the file has no records")
+	}
+
+	summary := summarizeTrack([][]store.TrackPoint{points})
+
+	// Indoor activities have no positions, but the device still counts the
+	// distance.
+	if recordedDistance != nil {
+		summary.distance = recordedDistance
+	}
+
+	if session != nil {
+		session.summarize(&summary)
+
+		if value, ok := session.uint(5); ok && sport == "" {
+			sport = fitSports[value]
+		}
+	}
+
+	entry := cardioEntry(cardioExercise(sport), summary, points)
+
+	return cardioWorkout(userID, sportName, summary.start, summary.end, []store.WorkoutEntry{entry})
+}
+
+// decodeFIT checks the header and CRC of a FIT file and returns its data
+// messages.
+func decodeFIT(data []byte) ([]fitMessage, error) {
+	if len(data) < 12 {
+		return nil, errNotFIT
+	}
+
+	headerSize := int(data[0])
+
+	if (headerSize != 12 && headerSize != 14) || len(data) < headerSize || string(data[8:12]) != ".FIT" {
+		return nil, errNotFIT
+	}
+
+	end := headerSize + int(binary.LittleEndian.Uint32(data[4:8]))
+
+	if len(data) < end+2 {
+		return nil, errors.New("the FIT file is truncated")
+	}
+
+	if fitCRC(data[:end]) != binary.LittleEndian.Uint16(data[end:end+2]) {
+		return nil, errors.New("the FIT file is corrupted")
+	}
+
+	definitions := map[byte]*fitDefinition{}
+	messages := []fitMessage{}
+	var lastTimestamp uint32
+
+	for offset := headerSize; offset < end; {
+		header := data[offset]
+		offset++
+
+		var local byte
+		var compressedTimestamp *uint32
+
+		switch {
+		case header&0x80 != 0:
+			// Compressed timestamp headers carry the low five bits of the
+			// timestamp, which roll over relative to the last full timestamp.
+			local = (header >> 5) & 0x03
+			timeOffset := uint32(header & 0x1F)
+			timestamp := lastTimestamp&^0x1F + timeOffset
+
+			if timeOffset < lastTimestamp&0x1F {
+				timestamp += 0x20
+			}
+
+			lastTimestamp = timestamp
+			compressedTimestamp = &timestamp
+		case header&0x40 != 0:
+			definition, size, err := readFITDefinition(data[offset:end], header&0x20 != 0)
+
+			if err != nil {
+				return nil, err
+			}
+
+			definitions[header&0x0F] = definition
+			offset += size
+			continue
+		default:
+			local = header & 0x0F
+		}
+
+		definition, ok := definitions[local]
+
+		if !ok {
+			return nil, fmt.Errorf("the FIT file uses local message %d before defining it", local)
+		}
+
+		message, size, err := readFITMessage(definition, data[offset:end])
+
+		if err != nil {
+			return nil, err
+		}
+
+		offset += size
+
+		if compressedTimestamp != nil {
+			message.fields[fitFieldTimestamp] = message.encode(*compressedTimestamp)
+		} else if timestamp, ok := message.uint(fitFieldTimestamp); ok {
+			lastTimestamp = uint32(timestamp)
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+func readFITDefinition(data []byte, developer bool) (*fitDefinition, int, error) {
+	errTruncated := errors.New("the FIT file has a truncated definition message")
+
+	if len(data) < 5 {
+		return nil, 0, errTruncated
+	}
+
+	definition := &fitDefinition{bigEndian: data[1] == 1}
+	count := int(data[4])
+	size := 5 + count*3
+
+	if len(data) < size {
+		return nil, 0, errTruncated
+	}
+
+	if definition.bigEndian {
+		definition.global = binary.BigEndian.Uint16(data[2:4])
+	} else {
+		definition.global = binary.LittleEndian.Uint16(data[2:4])
+	}
+
+	for i := 0; i < count; i++ {
+		field := data[5+i*3:]
+		definition.fields = append(definition.fields, fitField{number: field[0], size: field[1]})
+	}
+
+	if developer {
+		if len(data) < size+1 {
+			return nil, 0, errTruncated
+		}
+
+		count = int(data[size])
+		size++
+
+		if len(data) < size+count*3 {
+			return nil, 0, errTruncated
+		}
+
+		for i := 0; i < count; i++ {
+			definition.developerSize += int(data[size+i*3+1])
+		}
+
+		size += count * 3
+	}
+
+	return definition, size, nil
+}
+
+func readFITMessage(definition *fitDefinition, data []byte) (fitMessage, int, error) {
+	message := fitMessage{global: definition.global, bigEndian: definition.bigEndian, fields: map[byte][]byte{}}
+	offset := 0
+
+	for _, field := range definition.fields {
+		if len(data) < offset+int(field.size) {
+			return message, 0, errors.New("the FIT file has a truncated data message")
+		}
+
+		message.fields[field.number] = data[offset : offset+int(field.size)]
+		offset += int(field.size)
+	}
+
+	if len(data) < offset+definition.developerSize {
+		return message, 0, errors.New("the FIT file has a truncated data message")
+	}
+
+	return message, offset + definition.developerSize, nil
+}
+
+func (m fitMessage) order() binary.ByteOrder {
+	if m.bigEndian {
+		return binary.BigEndian
+	}
+
+	return binary.LittleEndian
+}
+
+// uint reads an unsigned field. The all-ones value marks a field the device
+// did not record.
+func (m fitMessage) uint(number byte) (uint64, bool) {
+	value := m.fields[number]
+
+	switch len(value) {
+	case 1:
+		return uint64(value[0]), value[0] != math.MaxUint8
+	case 2:
+		v := m.order().Uint16(value)
+		return uint64(v), v != math.MaxUint16
+	case 4:
+		v := m.order().Uint32(value)
+		return uint64(v), v != math.MaxUint32
+	default:
+		return 0, false
+	}
+}
+
+// int32 reads a signed 32-bit field, whose invalid value is MaxInt32.
+func (m fitMessage) int32(number byte) (int32, bool) {
+	value := m.fields[number]
+
+	if len(value) != 4 {
+		return 0, false
+	}
+
+	v := int32(m.order().Uint32(value))
+	return v, v != math.MaxInt32
+}
+
+func (m fitMessage) string(number byte) string {
+	value := m.fields[number]
+
+	for i, b := range value {
+		if b == 0 {
+			return string(value[:i])
+		}
+	}
+
+	return string(value)
+}
+
+func (m fitMessage) time(number byte) *time.Time {
+	value, ok := m.uint(number)
+
+	if !ok {
+		return nil
+	}
+
+	t := fitEpoch.Add(time.Duration(value) * time.Second)
+	return &t
+}
+
+func (m fitMessage) encode(timestamp uint32) []byte {
+	value := make([]byte, 4)
+	m.order().PutUint32(value, timestamp)
+	return value
+}
+
+func (m fitMessage) trackPoint() store.TrackPoint {
+	point := store.TrackPoint{RecordedAt: m.time(fitFieldTimestamp)}
+
+	latitude, hasLatitude := m.int32(0)
+	longitude, hasLongitude := m.int32(1)
+
+	if hasLatitude && hasLongitude {
+		lat := float64(latitude) * semicirclesToDegrees
+		lon := float64(longitude) * semicirclesToDegrees
+		point.Latitude, point.Longitude = &lat, &lon
+	}
+
+	// Altitude is stored as (meters + 500) * 5; the enhanced field has more
+	// range and wins when both are present.
+	for _, number := range []byte{2, 78} {
+		if altitude, ok := m.uint(number); ok {
+			meters := float64(altitude)/5 - 500
+			point.ElevationMeters = &meters
+		}
+	}
+
+	if heartRate, ok := m.uint(3); ok {
+		hr := int(heartRate)
+		point.HeartRate = &hr
+	}
+
+	return point
+}
+
+// summarize overrides the derived totals with the ones the device recorded.
+func (m fitMessage) summarize(summary *trackSummary) {
+	if start := m.time(2); start != nil {
+		summary.start = *start
+	}
+
+	if elapsed, ok := m.uint(7); ok && !summary.start.IsZero() {
+		summary.end = summary.start.Add(time.Duration(elapsed) * time.Millisecond).Round(time.Second)
+	}
+
+	if timer, ok := m.uint(8); ok {
+		seconds := int(math.Round(float64(timer) / 1000))
+		summary.movingSeconds = &seconds
+	}
+
+	if distance, ok := m.uint(9); ok {
+		meters := float64(distance) / 100
+		summary.distance = &meters
+	}
+
+	if ascent, ok := m.uint(22); ok {
+		meters := float64(ascent)
+		summary.elevationGain = &meters
+	}
+
+	if heartRate, ok := m.uint(16); ok {
+		hr := int(heartRate)
+		summary.avgHeartRate = &hr
+	}
+
+	if heartRate, ok := m.uint(17); ok {
+		hr := int(heartRate)
+		summary.maxHeartRate = &hr
+	}
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// fitCRC computes the CRC-16 used by FIT files, a nibble at a time as in the
+// FIT SDK.
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+
+	for _, b := range data {
+		for _, nibble := range []byte{b & 0x0F, b >> 4} {
+			tmp := fitCRCTable[crc&0x0F]
+			crc = (crc >> 4) & 0x0FFF
+			crc = crc ^ tmp ^ fitCRCTable[nibble]
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,111 @@
+package importer
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+)
+
+// gpxDocument covers the parts of GPX 1.1 that describe recorded tracks.
+// Element names are matched in any namespace, which also picks up heart rate
+// from Garmin's TrackPointExtension.
+type gpxDocument struct {
+	XMLName  xml.Name `xml:"gpx"`
+	Metadata struct {
+		Name string `xml:"name"`
+	} `xml:"metadata"`
+	Tracks []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name     string `xml:"name"`
+	Type     string `xml:"type"`
+	Segments []struct {
+		Points []gpxPoint `xml:"trkpt"`
+	} `xml:"trkseg"`
+}
+
+type gpxPoint struct {
+	Latitude  float64    `xml:"lat,attr"`
+	Longitude float64    `xml:"lon,attr"`
+	Elevation *float64   `xml:"ele"`
+	Time      *time.Time `xml:"time"`
+	HeartRate *int       `xml:"extensions>TrackPointExtension>hr"`
+}
+
+// ParseGPX reads a GPX 1.1 file into a workout with one cardio entry per
+// track.
+func ParseGPX(r io.Reader, userID int) (*store.Workout, error) {
+	var document gpxDocument
+
+	err := xml.NewDecoder(r).Decode(&document)
+
+	if err != nil {
+		return nil, fmt.Errorf("the file is not valid GPX: %w", err)
+	}
+
+	entries := []store.WorkoutEntry{}
+	var start, end time.Time
+
+	for _, track := range document.Tracks {
+		segments := make([][]store.TrackPoint, len(track.Segments))
+		points := []store.TrackPoint{}
+
+		for i, segment := range track.Segments {
+			for _, point := range segment.Points {
+				segments[i] = append(segments[i], point.trackPoint())
+			}
+
+			points = append(points, segments[i]...)
+		}
+
+		if len(points) == 0 {
+			continue
+		}
+
+		summary := summarizeTrack(segments)
+
+		if summary.start.IsZero() {
+			return nil, ErrNoTimestamps
+		}
+
+		if start.IsZero() || summary.start.Before(start) {
+			start = summary.start
+		}
+
+		if summary.end.After(end) {
+			end = summary.end
+		}
+
+		entries = append(entries, cardioEntry(cardioExercise(track.Type), summary, points))
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("the file has no track points")
+	}
+
+	title := document.Metadata.Name
+
+	if title == "" && len(document.Tracks) == 1 {
+		title = document.Tracks[0].Name
+	}
+
+	return cardioWorkout(userID, strings.TrimSpace(title), start, end, entries)
+}
+
+func (p gpxPoint) trackPoint() store.TrackPoint {
+	latitude, longitude := p.Latitude, p.Longitude
+
+	return store.TrackPoint{
+		RecordedAt:      p.Time,
+		Latitude:        &latitude,
+		Longitude:       &longitude,
+		ElevationMeters: p.Elevation,
+		HeartRate:       p.HeartRate,
+	}
+}
@@ -0,0 +1,160 @@
+package importer
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+)
+
+var hevyColumns = map[string][]string{
+	"title":          {"title"},
+	"start_time":     {"start_time"},
+	"end_time":       {"end_time"},
+	"description":    {"description"},
+	"exercise":       {"exercise_title"},
+	"exercise_notes": {"exercise_notes"},
+	"set_type":       {"set_type"},
+	"weight":         {"weight_kg", "weight"},
+	"weight_lbs":     {"weight_lbs"},
+	"reps":           {"reps"},
+	"distance_km":    {"distance_km"},
+	"distance_miles": {"distance_miles"},
+	"seconds":        {"duration_seconds"},
+}
+
+var hevyTimeLayouts = []string{"2 Jan 2006, 15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", time.RFC3339}
+
+// hevySetTypes names the values of Hevy's set_type column other than "normal".
+var hevySetTypes = map[string]string{
+	"warmup":  "warm-up",
+	"dropset": "drop set",
+	"failure": "failure",
+}
+
+// parseHevy reads a Hevy export, which has one row per set and identifies a
+// workout by its title and start time.
+func parseHevy(r io.Reader, userID int) (*Result, error) {
+	t, err := readTable(r, hevyColumns, "title", "start_time", "exercise")
+
+	if err != nil {
+		return nil, err
+	}
+
+	workouts := newWorkoutSet(t.ignored)
+
+	for {
+		row, err := t.next()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if row == nil {
+			return nil, err
+		}
+
+		if err != nil {
+			workouts.fail(row.line, err)
+			continue
+		}
+
+		startedAt, err := row.time("start_time", hevyTimeLayouts...)
+
+		if err != nil {
+			workouts.fail(row.line, err)
+			continue
+		}
+
+		var endedAt *time.Time
+
+		if row.get("end_time") != "" {
+			end, err := row.time("end_time", hevyTimeLayouts...)
+
+			if err != nil {
+				workouts.fail(row.line, err)
+				continue
+			}
+
+			if !end.Before(startedAt) {
+				endedAt = &end
+			}
+		}
+
+		workout := workouts.workout(row.get("title")+"\x00"+row.get("start_time"), func() *store.Workout {
+			workout := &store.Workout{
+				UserID:      userID,
+				Title:       row.get("title"),
+				Description: row.get("description"),
+				PerformedAt: startedAt,
+				StartedAt:   &startedAt,
+				EndedAt:     endedAt,
+			}
+
+			if endedAt != nil {
+				workout.DurationMinutes = int(endedAt.Sub(startedAt).Round(time.Minute).Minutes())
+			}
+
+			return workout
+		})
+
+		s, err := hevySet(row)
+
+		if err != nil {
+			workouts.fail(row.line, err)
+			continue
+		}
+
+		workouts.add(workout, s)
+	}
+
+	return workouts.finish(), nil
+}
+
+func hevySet(row *tableRow) (set, error) {
+	s := set{
+		row:      row.line,
+		exercise: row.get("exercise"),
+		notes:    joinNotes(hevySetTypes[row.get("set_type")], row.get("exercise_notes")),
+	}
+
+	var err error
+
+	if s.reps, err = row.count("reps"); err != nil {
+		return s, err
+	}
+
+	if s.seconds, err = row.count("seconds"); err != nil {
+		return s, err
+	}
+
+	if s.weight, err = row.nonZero("weight"); err != nil {
+		return s, err
+	}
+
+	if s.weight == nil {
+		if s.weight, err = row.nonZero("weight_lbs"); err != nil {
+			return s, err
+		}
+
+		if s.weight != nil {
+			*s.weight = toKilograms(*s.weight, "lbs")
+		}
+	}
+
+	for _, column := range []struct{ name, unit string }{{"distance_km", "km"}, {"distance_miles", "mi"}} {
+		distance, err := row.nonZero(column.name)
+
+		if err != nil {
+			return s, err
+		}
+
+		if distance != nil && s.distanceMeters == nil {
+			meters := *distance * metersPerUnit[column.unit]
+			s.distanceMeters = &meters
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,228 @@
+// Package importer converts the CSV exports of other workout apps, and GPX
+// and FIT recordings of cardio sessions, into workouts.
+//
+// The apps export one row per set while a workout entry describes several
+// sets, so consecutive identical sets of an exercise are merged into a single
+// entry. Rows that cannot be imported are reported by line number instead of
+// failing the whole file.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+)
+
+const (
+	SourceStrong = "strong"
+	SourceHevy   = "hevy"
+)
+
+var ErrUnknownSource = fmt.Errorf("source must be one of %s, %s", SourceStrong, SourceHevy)
+
+// metersPerUnit converts the distance units used by the exports to meters.
+// Distances without a unit are in kilometers.
+var metersPerUnit = map[string]float64{
+	"":      1000,
+	"km":    1000,
+	"m":     1,
+	"mi":    1609.344,
+	"miles": 1609.344,
+	"yd":    0.9144,
+}
+
+// kilogramsPerUnit converts the weight units used by the exports to
+// kilograms. Weights without a unit are in kilograms.
+var kilogramsPerUnit = map[string]float64{
+	"":    1,
+	"kg":  1,
+	"kgs": 1,
+	"lb":  0.45359237,
+	"lbs": 0.45359237,
+}
+
+// toKilograms converts a weight and rounds it to the two decimals workout
+// entries store.
+func toKilograms(weight float64, unit string) float64 {
+	return math.Round(weight*kilogramsPerUnit[unit]*100) / 100
+}
+
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// Workout is an unsaved workout together with the lines it was built from.
+type Workout struct {
+	Workout *store.Workout
+	Rows    []int
+}
+
+type Result struct {
+	Workouts []*Workout
+	Errors   []RowError
+	// IgnoredColumns lists the header names that the parser does not use.
+	IgnoredColumns []string
+}
+
+// Parse reads an export of the given source app and builds workouts owned by
+// userID. It only returns an error when the file as a whole is unusable.
+func Parse(source string, r io.Reader, userID int) (*Result, error) {
+	switch source {
+	case SourceStrong:
+		return parseStrong(r, userID)
+	case SourceHevy:
+		return parseHevy(r, userID)
+	default:
+		return nil, ErrUnknownSource
+	}
+}
+
+// set is one exported row, already converted to workout entry units.
+type set struct {
+	row            int
+	exercise       string
+	reps           *int
+	seconds        *int
+	weight         *float64
+	distanceMeters *float64
+	notes          string
+}
+
+func (s set) validate() error {
+	if s.exercise == "" {
+		return errors.New("exercise is required")
+	}
+
+	if s.reps == nil && s.seconds == nil {
+		return errors.New("the set has neither reps nor seconds")
+	}
+
+	return nil
+}
+
+// entry converts the set into a single-set workout entry.
+func (s set) entry() store.WorkoutEntry {
+	entry := store.WorkoutEntry{
+		ExerciseName:   s.exercise,
+		Sets:           1,
+		Weight:         s.weight,
+		DistanceMeters: roundTo(s.distanceMeters, 2),
+		Notes:          s.notes,
+	}
+
+	// Entries take either reps or a duration; reps win for timed sets that
+	// also counted reps.
+	if s.reps != nil {
+		entry.Reps = s.reps
+	} else {
+		entry.DurationSeconds = s.seconds
+	}
+
+	return entry
+}
+
+// joinNotes joins the non-empty notes with semicolons.
+func joinNotes(notes ...string) string {
+	parts := make([]string, 0, len(notes))
+
+	for _, note := range notes {
+		if note != "" {
+			parts = append(parts, note)
+		}
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// workoutSet groups sets into workouts by key, in the order in which the
+// workouts first appear.
+type workoutSet struct {
+	result *Result
+	byKey  map[string]*Workout
+}
+
+func newWorkoutSet(ignored []string) *workoutSet {
+	return &workoutSet{
+		result: &Result{Workouts: []*Workout{}, Errors: []RowError{}, IgnoredColumns: ignored},
+		byKey:  map[string]*Workout{},
+	}
+}
+
+func (ws *workoutSet) fail(row int, err error) {
+	ws.result.Errors = append(ws.result.Errors, RowError{Row: row, Error: err.Error()})
+}
+
+// workout returns the workout for key, calling create for the first row of a
+// new workout.
+func (ws *workoutSet) workout(key string, create func() *store.Workout) *Workout {
+	workout, ok := ws.byKey[key]
+
+	if !ok {
+		workout = &Workout{Workout: create()}
+		workout.Workout.Entries = []store.WorkoutEntry{}
+		ws.byKey[key] = workout
+		ws.result.Workouts = append(ws.result.Workouts, workout)
+	}
+
+	return workout
+}
+
+// add appends the set to the workout, merging it into the previous entry when
+// that entry is the same exercise with the same reps, duration, weight,
+// distance and notes.
+func (ws *workoutSet) add(workout *Workout, s set) {
+	err := s.validate()
+
+	if err != nil {
+		ws.fail(s.row, err)
+		return
+	}
+
+	workout.Rows = append(workout.Rows, s.row)
+	entry := s.entry()
+	entries := workout.Workout.Entries
+
+	if last := len(entries) - 1; last >= 0 && sameEntry(entries[last], entry) {
+		entries[last].Sets++
+		return
+	}
+
+	entry.OrderIndex = len(entries) + 1
+	workout.Workout.Entries = append(entries, entry)
+}
+
+// finish drops the workouts none of whose rows could be imported.
+func (ws *workoutSet) finish() *Result {
+	workouts := ws.result.Workouts[:0]
+
+	for _, workout := range ws.result.Workouts {
+		if len(workout.Rows) > 0 {
+			workouts = append(workouts, workout)
+		}
+	}
+
+	ws.result.Workouts = workouts
+	return ws.result
+}
+
+func sameEntry(a, b store.WorkoutEntry) bool {
+	return a.ExerciseName == b.ExerciseName &&
+		equalPtr(a.Reps, b.Reps) &&
+		equalPtr(a.DurationSeconds, b.DurationSeconds) &&
+		equalPtr(a.Weight, b.Weight) &&
+		equalPtr(a.DistanceMeters, b.DistanceMeters) &&
+		a.Notes == b.Notes
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
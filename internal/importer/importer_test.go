@@ -0,0 +1,168 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStrong(t *testing.T) {
+	content := `Date;Workout Name;Duration;Exercise Name;Set Order;Weight;Reps;Distance;Seconds;Notes;Workout Notes;RPE
+2025-03-03 18:00:00;Push;1h 5m;Bench Press;W;60;10;0;0;;felt strong;
+2025-03-03 18:00:00;Push;1h 5m;Bench Press;1;102,5;5;0;0;;felt strong;8
+2025-03-03 18:00:00;Push;1h 5m;Bench Press;2;102,5;5;0;0;;felt strong;9
+2025-03-03 18:00:00;Push;1h 5m;Bench Press;Rest Timer;0;0;0;90;;felt strong;
+2025-03-03 18:00:00;Push;1h 5m;Plank;1;0;0;0;60;;felt strong;
+2025-03-03 18:00:00;Push;1h 5m;Dip;1;0;0;0;0;;felt strong;
+2025-03-05 07:30:00;Run;32m;Running;1;0;0;5,2;1860;easy pace;;
+2025-03-06;Broken;1h;Squat;1;100;5;0;0;;;
+`
+
+	result, err := Parse(SourceStrong, strings.NewReader(content), 7)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"RPE"}, result.IgnoredColumns)
+	assert.Equal(t, []RowError{
+		{Row: 7, Error: "the set has neither reps nor seconds"},
+		{Row: 9, Error: `date "2025-03-06" is not a recognized date`},
+	}, result.Errors)
+	require.Len(t, result.Workouts, 2)
+
+	push := result.Workouts[0].Workout
+	assert.Equal(t, []int{2, 3, 4, 6}, result.Workouts[0].Rows)
+	assert.Equal(t, 7, push.UserID)
+	assert.Equal(t, "Push", push.Title)
+	assert.Equal(t, "felt strong", push.Description)
+	assert.Equal(t, time.Date(2025, 3, 3, 18, 0, 0, 0, time.UTC), push.PerformedAt)
+	assert.Equal(t, 65, push.DurationMinutes)
+	require.NotNil(t, push.EndedAt)
+	assert.Equal(t, time.Date(2025, 3, 3, 19, 5, 0, 0, time.UTC), *push.EndedAt)
+
+	require.Len(t, push.Entries, 3)
+	assert.Equal(t, "warm-up", push.Entries[0].Notes)
+	assert.Equal(t, 1, push.Entries[0].Sets)
+	assert.Equal(t, 2, push.Entries[1].Sets)
+	assert.Equal(t, 102.5, *push.Entries[1].Weight)
+	assert.Equal(t, 5, *push.Entries[1].Reps)
+	assert.Equal(t, 2, push.Entries[1].OrderIndex)
+	assert.Nil(t, push.Entries[2].Reps)
+	assert.Nil(t, push.Entries[2].Weight)
+	assert.Equal(t, 60, *push.Entries[2].DurationSeconds)
+
+	run := result.Workouts[1].Workout
+	require.Len(t, run.Entries, 1)
+	assert.Equal(t, 32, run.DurationMinutes)
+	assert.Equal(t, 1860, *run.Entries[0].DurationSeconds)
+	assert.Equal(t, 5200.0, *run.Entries[0].DistanceMeters)
+	assert.Equal(t, "easy pace", run.Entries[0].Notes)
+}
+
+func TestParseHevy(t *testing.T) {
+	content := `"title","start_time","end_time","description","exercise_title","superset_id","exercise_notes","set_index","set_type","weight_kg","reps","distance_km","duration_seconds","rpe"
+"Legs","8 Aug 2025, 07:12","8 Aug 2025, 08:02","","Squat (Barbell)",,"",0,"warmup",60,8,,,
+"Legs","8 Aug 2025, 07:12","8 Aug 2025, 08:02","","Squat (Barbell)",,"",1,"normal",140,5,,,
+"Legs","8 Aug 2025, 07:12","8 Aug 2025, 08:02","","Squat (Barbell)",,"",2,"normal",140,5,,,
+"Legs","8 Aug 2025, 07:12","8 Aug 2025, 08:02","","Squat (Barbell)",,"",3,"failure",140,4,,,
+"Legs","8 Aug 2025, 07:12","8 Aug 2025, 08:02","","Treadmill",,"cool down",0,"normal",,,1.5,600,
+"Legs","8 Aug 2025, 07:12","8 Aug 2025, 08:02","","Leg Press",,"",0,"normal",two hundred,10,,,
+`
+
+	result, err := Parse(SourceHevy, strings.NewReader(content), 3)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"superset_id", "set_index", "rpe"}, result.IgnoredColumns)
+	assert.Equal(t, []RowError{{Row: 7, Error: "weight must be a number"}}, result.Errors)
+	require.Len(t, result.Workouts, 1)
+
+	legs := result.Workouts[0].Workout
+	assert.Equal(t, time.Date(2025, 8, 8, 7, 12, 0, 0, time.UTC), legs.PerformedAt)
+	assert.Equal(t, 50, legs.DurationMinutes)
+	require.Len(t, legs.Entries, 4)
+	assert.Equal(t, "warm-up", legs.Entries[0].Notes)
+	assert.Equal(t, 2, legs.Entries[1].Sets)
+	assert.Equal(t, "failure", legs.Entries[2].Notes)
+	assert.Equal(t, "Treadmill", legs.Entries[3].ExerciseName)
+	assert.Equal(t, 600, *legs.Entries[3].DurationSeconds)
+	assert.Equal(t, 1500.0, *legs.Entries[3].DistanceMeters)
+	assert.Equal(t, "cool down", legs.Entries[3].Notes)
+}
+
+func TestParseConvertsPoundsToKilograms(t *testing.T) {
+	strong := `Date,Workout Name,Duration,Exercise Name,Set Order,Weight (lbs),Reps,Distance,Seconds,Notes,Workout Notes
+2025-03-03 18:00:00,Push,1h,Bench Press,1,225,5,0,0,,
+2025-03-03 18:00:00,Push,1h,Bench Press,2,225,5,0,0,,
+2025-03-03 18:00:00,Push,1h,Curl,1,45.5,12,0,0,,
+`
+
+	result, err := Parse(SourceStrong, strings.NewReader(strong), 1)
+	require.NoError(t, err)
+	require.Empty(t, result.Errors)
+	require.Len(t, result.Workouts, 1)
+
+	entries := result.Workouts[0].Workout.Entries
+	require.Len(t, entries, 2)
+	assert.Equal(t, 2, entries[0].Sets)
+	assert.Equal(t, 102.06, *entries[0].Weight)
+	assert.Equal(t, 20.64, *entries[1].Weight)
+
+	unitColumn := `Date;Workout Name;Duration;Exercise Name;Set Order;Weight;Weight Unit;Reps;Distance;Distance Unit;Seconds
+2025-03-03 18:00:00;Push;1h;Bench Press;1;225;lbs;5;0;;0
+2025-03-03 18:00:00;Push;1h;Squat;1;100;kg;5;0;;0
+2025-03-03 18:00:00;Push;1h;Dip;1;20;stone;5;0;;0
+`
+
+	result, err = Parse(SourceStrong, strings.NewReader(unitColumn), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []RowError{{Row: 4, Error: `weight unit "stone" is not recognized`}}, result.Errors)
+	require.Len(t, result.Workouts, 1)
+
+	entries = result.Workouts[0].Workout.Entries
+	require.Len(t, entries, 2)
+	assert.Equal(t, 102.06, *entries[0].Weight)
+	assert.Equal(t, 100.0, *entries[1].Weight)
+
+	hevy := `"title","start_time","end_time","exercise_title","set_type","weight_lbs","reps"
+"Legs","8 Aug 2025, 07:12","8 Aug 2025, 08:02","Squat (Barbell)","normal",315,5
+`
+
+	result, err = Parse(SourceHevy, strings.NewReader(hevy), 1)
+	require.NoError(t, err)
+	require.Empty(t, result.Errors)
+	require.Len(t, result.Workouts, 1)
+	assert.Equal(t, 142.88, *result.Workouts[0].Workout.Entries[0].Weight)
+}
+
+func TestParseRejectsUnusableFiles(t *testing.T) {
+	_, err := Parse("fitbod", strings.NewReader("date\n"), 1)
+	assert.ErrorIs(t, err, ErrUnknownSource)
+
+	_, err = Parse(SourceStrong, strings.NewReader(""), 1)
+	assert.EqualError(t, err, "the file is empty")
+
+	_, err = Parse(SourceHevy, strings.NewReader("Date,Workout Name,Exercise Name\n"), 1)
+	assert.EqualError(t, err, "the file has no title column; is it the right export?")
+}
+
+func TestParseStrongDuration(t *testing.T) {
+	tests := map[string]int{
+		"":       0,
+		"45m":    45,
+		"1h 5m":  65,
+		"1h":     60,
+		"90s":    2,
+		"3600":   60,
+		"1h 30s": 61,
+	}
+
+	for value, want := range tests {
+		got, err := parseStrongDuration(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+
+	_, err := parseStrongDuration("an hour")
+	assert.Error(t, err)
+}
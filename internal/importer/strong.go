@@ -0,0 +1,207 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DavidGudovic/api_exercise/internal/store"
+)
+
+var strongColumns = map[string][]string{
+	"date":           {"date"},
+	"workout":        {"workout name"},
+	"duration":       {"duration"},
+	"exercise":       {"exercise name"},
+	"set_order":      {"set order"},
+	"weight":         {"weight", "weight (kg)"},
+	"weight_lbs":     {"weight (lbs)"},
+	"weight_unit":    {"weight unit"},
+	"reps":           {"reps"},
+	"distance":       {"distance", "distance (km)"},
+	"distance_miles": {"distance (mi)"},
+	"distance_unit":  {"distance unit"},
+	"seconds":        {"seconds"},
+	"notes":          {"notes"},
+	"workout_notes":  {"workout notes"},
+}
+
+var strongTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", time.RFC3339}
+
+// strongSetOrders names the special values of Strong's "Set Order" column.
+// Working sets are numbered.
+var strongSetOrders = map[string]string{
+	"w": "warm-up",
+	"d": "drop set",
+	"f": "failure",
+}
+
+// parseStrong reads a Strong export, which has one row per set and identifies
+// a workout by its date and name.
+func parseStrong(r io.Reader, userID int) (*Result, error) {
+	t, err := readTable(r, strongColumns, "date", "workout", "exercise")
+
+	if err != nil {
+		return nil, err
+	}
+
+	workouts := newWorkoutSet(t.ignored)
+
+	for {
+		row, err := t.next()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if row == nil {
+			return nil, err
+		}
+
+		if err != nil {
+			workouts.fail(row.line, err)
+			continue
+		}
+
+		setOrder := strings.ToLower(row.get("set_order"))
+
+		// Newer exports interleave rest timer rows with the sets.
+		if setOrder == "rest timer" {
+			continue
+		}
+
+		performedAt, err := row.time("date", strongTimeLayouts...)
+
+		if err != nil {
+			workouts.fail(row.line, err)
+			continue
+		}
+
+		durationMinutes, err := parseStrongDuration(row.get("duration"))
+
+		if err != nil {
+			workouts.fail(row.line, err)
+			continue
+		}
+
+		workout := workouts.workout(row.get("date")+"\x00"+row.get("workout"), func() *store.Workout {
+			workout := &store.Workout{
+				UserID:          userID,
+				Title:           row.get("workout"),
+				Description:     row.get("workout_notes"),
+				PerformedAt:     performedAt,
+				StartedAt:       &performedAt,
+				DurationMinutes: durationMinutes,
+			}
+
+			if durationMinutes > 0 {
+				endedAt := performedAt.Add(time.Duration(durationMinutes) * time.Minute)
+				workout.EndedAt = &endedAt
+			}
+
+			return workout
+		})
+
+		s, err := strongSet(row, setOrder)
+
+		if err != nil {
+			workouts.fail(row.line, err)
+			continue
+		}
+
+		workouts.add(workout, s)
+	}
+
+	return workouts.finish(), nil
+}
+
+func strongSet(row *tableRow, setOrder string) (set, error) {
+	s := set{row: row.line, exercise: row.get("exercise"), notes: row.get("notes")}
+
+	if kind, ok := strongSetOrders[setOrder]; ok {
+		s.notes = joinNotes(kind, s.notes)
+	} else if _, err := strconv.Atoi(setOrder); setOrder != "" && err != nil {
+		return s, fmt.Errorf("set order %q is not recognized", setOrder)
+	}
+
+	var err error
+
+	if s.reps, err = row.count("reps"); err != nil {
+		return s, err
+	}
+
+	if s.seconds, err = row.count("seconds"); err != nil {
+		return s, err
+	}
+
+	weightUnit := strings.ToLower(row.get("weight_unit"))
+
+	if _, ok := kilogramsPerUnit[weightUnit]; !ok {
+		return s, fmt.Errorf("weight unit %q is not recognized", weightUnit)
+	}
+
+	if s.weight, err = row.nonZero("weight"); err != nil {
+		return s, err
+	}
+
+	if s.weight == nil {
+		weightUnit = "lbs"
+
+		if s.weight, err = row.nonZero("weight_lbs"); err != nil {
+			return s, err
+		}
+	}
+
+	if s.weight != nil {
+		*s.weight = toKilograms(*s.weight, weightUnit)
+	}
+
+	unit := strings.ToLower(row.get("distance_unit"))
+	meters, ok := metersPerUnit[unit]
+
+	if !ok {
+		return s, fmt.Errorf("distance unit %q is not recognized", unit)
+	}
+
+	if s.distanceMeters, err = row.nonZero("distance"); err != nil {
+		return s, err
+	}
+
+	if s.distanceMeters == nil {
+		meters = metersPerUnit["mi"]
+
+		if s.distanceMeters, err = row.nonZero("distance_miles"); err != nil {
+			return s, err
+		}
+	}
+
+	if s.distanceMeters != nil {
+		*s.distanceMeters *= meters
+	}
+
+	return s, nil
+}
+
+// parseStrongDuration reads durations such as "1h 5m", "45m" or "30s", or a
+// plain number of seconds, and returns whole minutes.
+func parseStrongDuration(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return int((time.Duration(seconds) * time.Second).Round(time.Minute).Minutes()), nil
+	}
+
+	// time.ParseDuration accepts "1h5m30s" once the spaces are removed.
+	duration, err := time.ParseDuration(strings.ReplaceAll(value, " ", ""))
+
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("duration %q is not recognized", value)
+	}
+
+	return int(duration.Round(time.Minute).Minutes()), nil
+}
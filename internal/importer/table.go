@@ -0,0 +1,224 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// table reads a CSV export whose header names are mapped onto canonical
+// column names.
+type table struct {
+	reader  *csv.Reader
+	columns map[string]int
+	ignored []string
+	decimal byte
+}
+
+// readTable reads the header of r. known maps each canonical column name to
+// the normalized header names that the source app uses for it; required
+// columns must be present.
+func readTable(r io.Reader, known map[string][]string, required ...string) (*table, error) {
+	buffered := bufio.NewReader(r)
+	delimiter, err := sniffDelimiter(buffered)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file is empty")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	t := &table{reader: reader, columns: map[string]int{}, ignored: []string{}, decimal: '.'}
+
+	// Semicolon-separated exports come from locales that write decimal commas.
+	if delimiter == ';' {
+		t.decimal = ','
+	}
+
+	aliases := map[string]string{}
+
+	for column, names := range known {
+		for _, name := range names {
+			aliases[name] = column
+		}
+	}
+
+	for i, name := range header {
+		column, ok := aliases[normalizeHeader(name)]
+
+		if _, seen := t.columns[column]; !ok || seen {
+			t.ignored = append(t.ignored, name)
+			continue
+		}
+
+		t.columns[column] = i
+	}
+
+	for _, column := range required {
+		if _, ok := t.columns[column]; !ok {
+			return nil, fmt.Errorf("the file has no %s column; is it the right export?", known[column][0])
+		}
+	}
+
+	return t, nil
+}
+
+// sniffDelimiter picks a comma or a semicolon depending on which one the
+// header line contains.
+func sniffDelimiter(r *bufio.Reader) (rune, error) {
+	line, err := r.Peek(r.Size())
+
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return 0, err
+	}
+
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+
+	if bytes.Count(line, []byte{';'}) > bytes.Count(line, []byte{','}) {
+		return ';', nil
+	}
+
+	return ',', nil
+}
+
+func normalizeHeader(name string) string {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")
+	return strings.ToLower(strings.Trim(name, `"`))
+}
+
+type tableRow struct {
+	table  *table
+	record []string
+	line   int
+}
+
+// next returns the next non-blank row. Rows that are not valid CSV are
+// returned with a nil record and an error.
+func (t *table) next() (*tableRow, error) {
+	for {
+		record, err := t.reader.Read()
+
+		var parseErr *csv.ParseError
+
+		if errors.As(err, &parseErr) {
+			return &tableRow{table: t, line: parseErr.Line}, parseErr.Err
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := t.reader.FieldPos(0)
+		row := &tableRow{table: t, record: record, line: line}
+
+		if !row.blank() {
+			return row, nil
+		}
+	}
+}
+
+func (r *tableRow) blank() bool {
+	for _, value := range r.record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *tableRow) get(column string) string {
+	index, ok := r.table.columns[column]
+
+	if !ok || index >= len(r.record) {
+		return ""
+	}
+
+	return strings.TrimSpace(r.record[index])
+}
+
+// number parses a decimal column. Blank values are nil.
+func (r *tableRow) number(column string) (*float64, error) {
+	value := r.get(column)
+
+	if value == "" {
+		return nil, nil
+	}
+
+	if r.table.decimal == ',' {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("%s must be a number", column)
+	}
+
+	return &f, nil
+}
+
+// count parses a whole-number column that may be exported as a decimal, such
+// as "5.0" reps. Blank and zero values are nil, since the apps export unused
+// columns as zero.
+func (r *tableRow) count(column string) (*int, error) {
+	f, err := r.number(column)
+
+	if err != nil || f == nil || *f == 0 {
+		return nil, err
+	}
+
+	if *f < 0 || *f != math.Trunc(*f) || *f > math.MaxInt32 {
+		return nil, fmt.Errorf("%s must be a whole number", column)
+	}
+
+	i := int(*f)
+	return &i, nil
+}
+
+// nonZero is number with zero treated as blank, as in unweighted sets.
+func (r *tableRow) nonZero(column string) (*float64, error) {
+	f, err := r.number(column)
+
+	if err != nil || f == nil || *f == 0 {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (r *tableRow) time(column string, layouts ...string) (time.Time, error) {
+	value := r.get(column)
+
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, value)
+
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%s %q is not a recognized date", column, value)
+}
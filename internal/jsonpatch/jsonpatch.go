@@ -0,0 +1,392 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON values.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	ErrTestFailed   = errors.New("test operation failed")
+)
+
+// MergePatch applies an RFC 7396 merge patch to doc.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, mergePatch interface{}
+
+	err := json.Unmarshal(doc, &target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(patch, &mergePatch)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(merge(target, mergePatch))
+}
+
+func merge(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+
+		targetObject[key] = merge(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies an RFC 6902 patch to doc. Operations run in order and the
+// whole patch fails if any one of them does.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var operations []operation
+
+	err := json.Unmarshal(patch, &operations)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	var target interface{}
+
+	err = json.Unmarshal(doc, &target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range operations {
+		target, err = op.apply(target)
+
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func (op operation) apply(doc interface{}) (interface{}, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: missing path", ErrInvalidPatch)
+	}
+
+	path, err := parsePointer(*op.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+
+		var value interface{}
+
+		err = json.Unmarshal(op.Value, &value)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			if len(path) == 0 {
+				return value, nil
+			}
+
+			doc, _, err = remove(doc, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return add(doc, path, value)
+		default:
+			current, err := get(doc, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !reflect.DeepEqual(current, value) {
+				return nil, fmt.Errorf("%w: value at %s does not match", ErrTestFailed, *op.Path)
+			}
+
+			return doc, nil
+		}
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: missing from", ErrInvalidPatch)
+		}
+
+		from, err := parsePointer(*op.From)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			value, err := get(doc, from)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return add(doc, path, deepCopy(value))
+		}
+
+		if *op.Path != *op.From && strings.HasPrefix(*op.Path, *op.From+"/") {
+			return nil, fmt.Errorf("%w: cannot move a value into one of its children", ErrInvalidPatch)
+		}
+
+		doc, value, err := remove(doc, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return add(doc, path, value)
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with /", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int) (int, error) {
+	index, err := strconv.Atoi(token)
+
+	if err != nil || index < 0 || index >= length || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+
+	return index, nil
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+
+			if !ok {
+				return nil, fmt.Errorf("%w: member %q not found", ErrInvalidPatch, token)
+			}
+
+			node = child
+		case []interface{}:
+			index, err := arrayIndex(token, len(n))
+
+			if err != nil {
+				return nil, err
+			}
+
+			node = n[index]
+		default:
+			return nil, fmt.Errorf("%w: cannot traverse into a scalar at %q", ErrInvalidPatch, token)
+		}
+	}
+
+	return node, nil
+}
+
+// add returns node with value added at path. Containers are modified in place
+// where possible, but slices may be reallocated so callers must use the result.
+func add(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token := path[0]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			n[token] = value
+			return n, nil
+		}
+
+		child, ok := n[token]
+
+		if !ok {
+			return nil, fmt.Errorf("%w: member %q not found", ErrInvalidPatch, token)
+		}
+
+		child, err := add(child, path[1:], value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		n[token] = child
+		return n, nil
+	case []interface{}:
+		if len(path) == 1 {
+			index := len(n)
+
+			if token != "-" {
+				var err error
+				index, err = arrayIndex(token, len(n)+1)
+
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			n = append(n, nil)
+			copy(n[index+1:], n[index:])
+			n[index] = value
+			return n, nil
+		}
+
+		index, err := arrayIndex(token, len(n))
+
+		if err != nil {
+			return nil, err
+		}
+
+		child, err := add(n[index], path[1:], value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		n[index] = child
+		return n, nil
+	default:
+		return nil, fmt.Errorf("%w: cannot add into a scalar at %q", ErrInvalidPatch, token)
+	}
+}
+
+// remove returns node without the value at path, along with the removed value.
+func remove(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+
+	token := path[0]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: member %q not found", ErrInvalidPatch, token)
+		}
+
+		if len(path) == 1 {
+			delete(n, token)
+			return n, child, nil
+		}
+
+		child, removed, err := remove(child, path[1:])
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		n[token] = child
+		return n, removed, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(n))
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(path) == 1 {
+			removed := n[index]
+			return append(n[:index], n[index+1:]...), removed, nil
+		}
+
+		child, removed, err := remove(n[index], path[1:])
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		n[index] = child
+		return n, removed, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: cannot remove from a scalar at %q", ErrInvalidPatch, token)
+	}
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+
+		for key, child := range v {
+			copied[key] = deepCopy(child)
+		}
+
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+
+		for i, child := range v {
+			copied[i] = deepCopy(child)
+		}
+
+		return copied
+	default:
+		return v
+	}
+}
@@ -0,0 +1,148 @@
+package jsonpatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "replace member",
+			doc:   `{"a":"b"}`,
+			patch: `{"a":"c"}`,
+			want:  `{"a":"c"}`,
+		},
+		{
+			name:  "add member",
+			doc:   `{"a":"b"}`,
+			patch: `{"b":"c"}`,
+			want:  `{"a":"b","b":"c"}`,
+		},
+		{
+			name:  "null removes member",
+			doc:   `{"a":"b","b":"c"}`,
+			patch: `{"a":null}`,
+			want:  `{"b":"c"}`,
+		},
+		{
+			name:  "arrays are replaced whole",
+			doc:   `{"a":[{"b":"c"}]}`,
+			patch: `{"a":[1]}`,
+			want:  `{"a":[1]}`,
+		},
+		{
+			name:  "nested objects merge",
+			doc:   `{"a":{"b":"c","d":"e"}}`,
+			patch: `{"a":{"d":null,"f":"g"}}`,
+			want:  `{"a":{"b":"c","f":"g"}}`,
+		},
+		{
+			name:  "non-object patch replaces document",
+			doc:   `{"a":"b"}`,
+			patch: `["c"]`,
+			want:  `["c"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	doc := `{"title":"push day","entries":[{"id":1,"reps":5},{"id":2,"reps":8}]}`
+
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "replace nested value",
+			patch: `[{"op":"replace","path":"/entries/0/reps","value":6}]`,
+			want:  `{"title":"push day","entries":[{"id":1,"reps":6},{"id":2,"reps":8}]}`,
+		},
+		{
+			name:  "append to array",
+			patch: `[{"op":"add","path":"/entries/-","value":{"reps":10}}]`,
+			want:  `{"title":"push day","entries":[{"id":1,"reps":5},{"id":2,"reps":8},{"reps":10}]}`,
+		},
+		{
+			name:  "insert into array",
+			patch: `[{"op":"add","path":"/entries/0","value":{"reps":10}}]`,
+			want:  `{"title":"push day","entries":[{"reps":10},{"id":1,"reps":5},{"id":2,"reps":8}]}`,
+		},
+		{
+			name:  "remove array element",
+			patch: `[{"op":"remove","path":"/entries/0"}]`,
+			want:  `{"title":"push day","entries":[{"id":2,"reps":8}]}`,
+		},
+		{
+			name:  "move reorders array",
+			patch: `[{"op":"move","from":"/entries/1","path":"/entries/0"}]`,
+			want:  `{"title":"push day","entries":[{"id":2,"reps":8},{"id":1,"reps":5}]}`,
+		},
+		{
+			name:  "copy member",
+			patch: `[{"op":"copy","from":"/title","path":"/description"}]`,
+			want:  `{"title":"push day","description":"push day","entries":[{"id":1,"reps":5},{"id":2,"reps":8}]}`,
+		},
+		{
+			name:  "passing test applies remaining operations",
+			patch: `[{"op":"test","path":"/entries/1/id","value":2},{"op":"remove","path":"/entries/1"}]`,
+			want:  `{"title":"push day","entries":[{"id":1,"reps":5}]}`,
+		},
+		{
+			name:    "failing test aborts patch",
+			patch:   `[{"op":"test","path":"/title","value":"leg day"},{"op":"remove","path":"/title"}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:    "missing path",
+			patch:   `[{"op":"replace","path":"/missing","value":1}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "index out of range",
+			patch:   `[{"op":"remove","path":"/entries/5"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "unknown op",
+			patch:   `[{"op":"explode","path":"/title"}]`,
+			wantErr: ErrInvalidPatch,
+		},
+		{
+			name:    "not an array of operations",
+			patch:   `{"op":"remove","path":"/title"}`,
+			wantErr: ErrInvalidPatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(doc), []byte(tt.patch))
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// LogMailer writes emails to w instead of delivering them. It is meant for
+// local development and tests.
+type LogMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{w: w}
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.w, "To: %s\nSubject: %s\n\n%s\n---\n", to, subject, body)
+	return err
+}
@@ -0,0 +1,6 @@
+package mailer
+
+// Mailer delivers plain-text emails to a single recipient.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
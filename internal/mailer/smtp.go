@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+type SMTPMailer struct {
+	addr   string
+	auth   smtp.Auth
+	sender string
+}
+
+func NewSMTPMailer(host string, port int, username, password, sender string) *SMTPMailer {
+	var auth smtp.Auth
+
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		addr:   net.JoinHostPort(host, strconv.Itoa(port)),
+		auth:   auth,
+		sender: sender,
+	}
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var msg strings.Builder
+
+	msg.WriteString("From: " + m.sender + "\r\n")
+	msg.WriteString("To: " + to + "\r\n")
+	msg.WriteString("Subject: " + subject + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+
+	err := smtp.SendMail(m.addr, m.auth, m.sender, []string{to}, []byte(msg.String()))
+
+	if err != nil {
+		return fmt.Errorf("mailer: smtp: %w", err)
+	}
+
+	return nil
+}
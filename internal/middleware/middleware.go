@@ -17,6 +17,7 @@ type UserMiddleware struct {
 type contextKey string
 
 const UserContextKey = contextKey("user")
+const TokenContextKey = contextKey("token")
 
 func SetUser(r *http.Request, user *store.User) *http.Request {
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
@@ -33,6 +34,18 @@ func GetUser(r *http.Request) *store.User {
 	return user
 }
 
+func SetToken(r *http.Request, plaintext string) *http.Request {
+	ctx := context.WithValue(r.Context(), TokenContextKey, plaintext)
+	return r.WithContext(ctx)
+}
+
+// GetToken returns the bearer token the request was authenticated with, or an
+// empty string for anonymous requests.
+func GetToken(r *http.Request) string {
+	token, _ := r.Context().Value(TokenContextKey).(string)
+	return token
+}
+
 func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -66,11 +79,39 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		r = SetUser(r, user)
+		r = SetToken(r, tokenString)
 		next.ServeHTTP(w, r)
 		return
 	})
 }
 
+// AuthenticateQueryToken authenticates clients that cannot send an
+// Authorization header, such as calendar apps, with a token of the given
+// scope in the "token" query parameter.
+func (um *UserMiddleware) AuthenticateQueryToken(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := r.URL.Query().Get("token")
+
+			if tokenString == "" {
+				_ = utils.WriteJson(w, http.StatusUnauthorized, utils.Envelope{"error": "The token query parameter is required"})
+				return
+			}
+
+			user, err := um.UserStore.GetUserToken(scope, tokenString)
+
+			if err != nil || user == nil {
+				_ = utils.WriteJson(w, http.StatusUnauthorized, utils.Envelope{"error": "Invalid or expired token"})
+				return
+			}
+
+			r = SetUser(r, user)
+			r = SetToken(r, tokenString)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (um *UserMiddleware) RequireAuthenticatedUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := GetUser(r)
@@ -83,3 +124,18 @@ func (um *UserMiddleware) RequireAuthenticatedUser(next http.Handler) http.Handl
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (um *UserMiddleware) RequireActivatedUser(next http.Handler) http.Handler {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+
+		if !user.Activated {
+			_ = utils.WriteJson(w, http.StatusForbidden, utils.Envelope{"error": "Your account must be activated to access this resource"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return um.RequireAuthenticatedUser(fn)
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"github.com/DavidGudovic/api_exercise/internal/app"
+	"github.com/DavidGudovic/api_exercise/internal/tokens"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -9,20 +10,97 @@ func SetupRoutes(application *app.Application) *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Group(func(r chi.Router) {
-		r.Use(
-			application.Middleware.Authenticate,
-			application.Middleware.RequireAuthenticatedUser,
-		)
-
-		r.Get("/workouts", application.WorkoutHandler.HandleGetAllWorkouts)
-		r.Post("/workouts", application.WorkoutHandler.HandleCreateWorkout)
-		r.Get("/workouts/{workoutID}", application.WorkoutHandler.HandleGetWorkoutByID)
-		r.Put("/workouts/{workoutID}", application.WorkoutHandler.HandleUpdateWorkout)
-		r.Delete("/workouts/{workoutID}", application.WorkoutHandler.HandleDeleteWorkout)
+		r.Use(application.Middleware.Authenticate)
+
+		r.Group(func(r chi.Router) {
+			r.Use(application.Middleware.RequireActivatedUser)
+
+			r.Get("/workouts", application.WorkoutHandler.HandleGetAllWorkouts)
+			r.Post("/workouts", application.WorkoutHandler.HandleCreateWorkout)
+			r.Get("/workouts/search", application.WorkoutHandler.HandleSearchWorkouts)
+			r.Get("/workouts/trash", application.WorkoutHandler.HandleGetTrash)
+			r.Get("/workouts/{id}", application.WorkoutHandler.HandleGetWorkoutByID)
+			r.Put("/workouts/{id}", application.WorkoutHandler.HandleUpdateWorkout)
+			r.Patch("/workouts/{id}", application.WorkoutHandler.HandlePatchWorkout)
+			r.Delete("/workouts/{id}", application.WorkoutHandler.HandleDeleteWorkout)
+			r.Get("/workouts/{id}/track", application.WorkoutHandler.HandleGetWorkoutTrack)
+			r.Post("/workouts/{id}/restore", application.WorkoutHandler.HandleRestoreWorkout)
+			r.Post("/workouts/{id}/save-as-template", application.TemplateHandler.HandleSaveWorkoutAsTemplate)
+			r.Get("/workouts/export", application.ImportHandler.HandleExportWorkouts)
+			r.Post("/workouts/import", application.ImportHandler.HandleImportWorkouts)
+			r.Post("/workouts/import/gpx", application.ImportHandler.HandleImportGPX)
+			r.Post("/workouts/import/fit", application.ImportHandler.HandleImportFIT)
+
+			r.Get("/tags", application.TagHandler.HandleGetTags)
+			r.Patch("/tags/{id}", application.TagHandler.HandleRenameTag)
+			r.Delete("/tags/{id}", application.TagHandler.HandleDeleteTag)
+			r.Post("/tags/{id}/merge", application.TagHandler.HandleMergeTag)
+
+			r.Get("/templates", application.TemplateHandler.HandleGetTemplates)
+			r.Post("/templates", application.TemplateHandler.HandleCreateTemplate)
+			r.Get("/templates/{id}", application.TemplateHandler.HandleGetTemplateByID)
+			r.Put("/templates/{id}", application.TemplateHandler.HandleUpdateTemplate)
+			r.Delete("/templates/{id}", application.TemplateHandler.HandleDeleteTemplate)
+			r.Post("/templates/{id}/start", application.TemplateHandler.HandleStartTemplate)
+
+			r.Get("/exercises", application.ExerciseHandler.HandleSearchExercises)
+			r.Post("/exercises", application.ExerciseHandler.HandleCreateExercise)
+			r.Get("/exercises/{id}", application.ExerciseHandler.HandleGetExerciseByID)
+			r.Put("/exercises/{id}", application.ExerciseHandler.HandleUpdateExercise)
+			r.Delete("/exercises/{id}", application.ExerciseHandler.HandleDeleteExercise)
+			r.Get("/exercises/{id}/records", application.RecordHandler.HandleGetExerciseRecords)
+
+			r.Get("/users/me/records", application.RecordHandler.HandleGetCurrentUserRecords)
+
+			r.Get("/analytics/summary", application.AnalyticsHandler.HandleGetSummary)
+			r.Get("/analytics/exercises/{id}", application.AnalyticsHandler.HandleGetExerciseAnalytics)
+
+			r.Get("/programs", application.ProgramHandler.HandleGetPrograms)
+			r.Post("/programs", application.ProgramHandler.HandleCreateProgram)
+			r.Get("/programs/{id}", application.ProgramHandler.HandleGetProgramByID)
+			r.Put("/programs/{id}", application.ProgramHandler.HandleUpdateProgram)
+			r.Delete("/programs/{id}", application.ProgramHandler.HandleDeleteProgram)
+			r.Post("/programs/{id}/enrollments", application.ProgramHandler.HandleEnroll)
+
+			r.Get("/users/me/enrollments", application.ProgramHandler.HandleGetEnrollments)
+			r.Delete("/users/me/enrollments/{id}", application.ProgramHandler.HandleDeleteEnrollment)
+			r.Post("/users/me/enrollments/{id}/sessions/{sessionID}/start", application.ProgramHandler.HandleStartSession)
+			r.Get("/users/me/schedule", application.ProgramHandler.HandleGetSchedule)
+
+			r.Post("/users/me/calendar-token", application.CalendarHandler.HandleCreateFeedToken)
+			r.Delete("/users/me/calendar-token", application.CalendarHandler.HandleRevokeFeedToken)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(application.Middleware.RequireAuthenticatedUser)
+
+			r.Get("/tokens/sessions", application.TokenHandler.HandleGetSessions)
+			r.Delete("/tokens/current", application.TokenHandler.HandleDeleteCurrentToken)
+			r.Delete("/tokens", application.TokenHandler.HandleDeleteAllTokens)
+
+			r.Get("/users/me", application.UserHandler.HandleGetCurrentUser)
+			r.Patch("/users/me", application.UserHandler.HandleUpdateCurrentUser)
+			r.Delete("/users/me", application.UserHandler.HandleDeleteCurrentUser)
+			r.Put("/users/me/password", application.UserHandler.HandleChangePassword)
+		})
+	})
+
+	// Calendar apps cannot send an Authorization header, so the feed is
+	// authenticated with a token in its URL instead.
+	r.Group(func(r chi.Router) {
+		r.Use(application.Middleware.AuthenticateQueryToken(tokens.ScopeCalendar))
+		r.Use(application.Middleware.RequireActivatedUser)
+
+		r.Get("/users/me/calendar.ics", application.CalendarHandler.HandleGetCalendar)
 	})
 
 	r.Post("/tokens/authentication", application.TokenHandler.HandleCreateToken)
+	r.Post("/tokens/refresh", application.TokenHandler.HandleRefreshToken)
 	r.Post("/users/register", application.UserHandler.HandleRegisterUser)
+	r.Post("/users/password-reset", application.UserHandler.HandleRequestPasswordReset)
+	r.Put("/users/password", application.UserHandler.HandleResetPassword)
+	r.Put("/users/activated", application.UserHandler.HandleActivateUser)
+	r.Post("/users/activation", application.UserHandler.HandleResendActivation)
 	r.Get("/health", application.HealthCheck)
 
 	return r
@@ -0,0 +1,336 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+)
+
+var (
+	ErrDuplicateExercise = errors.New("an exercise with this name already exists")
+	ErrExerciseNotFound  = errors.New("exercise_id does not match a known exercise")
+	ErrExerciseInUse     = errors.New("exercise is used by other users")
+)
+
+// Exercise is an entry of the catalog shared by all users. CreatedBy is the
+// user who added it and is nil for the seeded catalog; only the creator can
+// change or delete an exercise, and only the creator's entry names resolve
+// to it.
+type Exercise struct {
+	ID                    int       `json:"id"`
+	Name                  string    `json:"name"`
+	Aliases               []string  `json:"aliases"`
+	Category              string    `json:"category"`
+	PrimaryMuscleGroups   []string  `json:"primary_muscle_groups"`
+	SecondaryMuscleGroups []string  `json:"secondary_muscle_groups"`
+	Equipment             string    `json:"equipment"`
+	CreatedBy             *int      `json:"created_by"`
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+type ExerciseFilter struct {
+	Query    string
+	Category string
+	Muscle   string
+	Limit    int
+}
+
+type ExerciseStore interface {
+	CreateExercise(*Exercise) error
+	GetExerciseByID(id int) (*Exercise, error)
+	UpdateExercise(*Exercise) error
+	DeleteExercise(id, userID int) error
+	SearchExercises(filter ExerciseFilter) ([]*Exercise, error)
+}
+
+type PostgresExerciseStore struct {
+	db *sql.DB
+}
+
+func NewPostgresExerciseStore(db *sql.DB) *PostgresExerciseStore {
+	return &PostgresExerciseStore{db: db}
+}
+
+const exerciseColumns = `id, name, aliases, category, primary_muscle_groups, secondary_muscle_groups, equipment, created_by, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanExercise reads a row selected with exerciseColumns. database/sql cannot
+// scan arrays into slices directly, so they go through pgtype first.
+func scanExercise(row rowScanner) (*Exercise, error) {
+	exercise := &Exercise{}
+	var aliases, primary, secondary pgtype.TextArray
+
+	err := row.Scan(
+		&exercise.ID,
+		&exercise.Name,
+		&aliases,
+		&exercise.Category,
+		&primary,
+		&secondary,
+		&exercise.Equipment,
+		&exercise.CreatedBy,
+		&exercise.CreatedAt,
+		&exercise.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pair := range []struct {
+		src *pgtype.TextArray
+		dst *[]string
+	}{
+		{&aliases, &exercise.Aliases},
+		{&primary, &exercise.PrimaryMuscleGroups},
+		{&secondary, &exercise.SecondaryMuscleGroups},
+	} {
+		if err = pair.src.AssignTo(pair.dst); err != nil {
+			return nil, err
+		}
+
+		if *pair.dst == nil {
+			*pair.dst = []string{}
+		}
+	}
+
+	return exercise, nil
+}
+
+func (s *PostgresExerciseStore) CreateExercise(exercise *Exercise) error {
+	query := `
+		INSERT INTO exercises (name, aliases, category, primary_muscle_groups, secondary_muscle_groups, equipment, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := s.db.QueryRow(
+		query,
+		exercise.Name,
+		textArray(exercise.Aliases),
+		exercise.Category,
+		textArray(exercise.PrimaryMuscleGroups),
+		textArray(exercise.SecondaryMuscleGroups),
+		exercise.Equipment,
+		exercise.CreatedBy,
+	).Scan(&exercise.ID, &exercise.CreatedAt, &exercise.UpdatedAt)
+
+	if err != nil {
+		return duplicateExerciseError(err)
+	}
+
+	return nil
+}
+
+func (s *PostgresExerciseStore) GetExerciseByID(id int) (*Exercise, error) {
+	query := `SELECT ` + exerciseColumns + ` FROM exercises WHERE id = $1`
+
+	exercise, err := scanExercise(s.db.QueryRow(query, id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return exercise, nil
+}
+
+// UpdateExercise changes an exercise created by exercise.CreatedBy. It
+// returns sql.ErrNoRows when that user did not create it and ErrExerciseInUse
+// when other users' workouts or templates reference it.
+func (s *PostgresExerciseStore) UpdateExercise(exercise *Exercise) error {
+	if exercise.CreatedBy == nil {
+		return sql.ErrNoRows
+	}
+
+	transaction, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	err = lockOwnedExercise(transaction, exercise.ID, *exercise.CreatedBy)
+
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE exercises
+		SET name = $1, aliases = $2, category = $3, primary_muscle_groups = $4, secondary_muscle_groups = $5,
+			equipment = $6, updated_at = NOW()
+		WHERE id = $7
+		RETURNING created_at, updated_at
+	`
+
+	err = transaction.QueryRow(
+		query,
+		exercise.Name,
+		textArray(exercise.Aliases),
+		exercise.Category,
+		textArray(exercise.PrimaryMuscleGroups),
+		textArray(exercise.SecondaryMuscleGroups),
+		exercise.Equipment,
+		exercise.ID,
+	).Scan(&exercise.CreatedAt, &exercise.UpdatedAt)
+
+	if err != nil {
+		return duplicateExerciseError(err)
+	}
+
+	return transaction.Commit()
+}
+
+// DeleteExercise removes an exercise that userID created. The creator's
+// workout entries that referenced it keep their exercise_name and have
+// exercise_id cleared. Like UpdateExercise it refuses exercises that other
+// users reference, since deleting them would drop those users' records.
+func (s *PostgresExerciseStore) DeleteExercise(id, userID int) error {
+	transaction, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	err = lockOwnedExercise(transaction, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = transaction.Exec(`DELETE FROM exercises WHERE id = $1`, id)
+
+	if err != nil {
+		return err
+	}
+
+	return transaction.Commit()
+}
+
+// lockOwnedExercise locks the exercise against new references and checks
+// that userID created it and is the only user referencing it.
+func lockOwnedExercise(transaction *sql.Tx, id, userID int) error {
+	var inUse bool
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM workout_entries we
+			INNER JOIN workouts w ON w.id = we.workout_id
+			WHERE we.exercise_id = e.id AND w.user_id <> $2
+		) OR EXISTS (
+			SELECT 1 FROM template_entries te
+			INNER JOIN workout_templates t ON t.id = te.template_id
+			WHERE te.exercise_id = e.id AND t.user_id <> $2
+		)
+		FROM exercises e
+		WHERE e.id = $1 AND e.created_by = $2
+		FOR UPDATE OF e
+	`
+
+	err := transaction.QueryRow(query, id, userID).Scan(&inUse)
+
+	if err != nil {
+		return err
+	}
+
+	if inUse {
+		return ErrExerciseInUse
+	}
+
+	return nil
+}
+
+// SearchExercises matches the query against names and aliases, tolerating
+// typos through trigram similarity. Exact and prefix matches rank first.
+func (s *PostgresExerciseStore) SearchExercises(filter ExerciseFilter) ([]*Exercise, error) {
+	exercises := []*Exercise{}
+
+	query := `
+		SELECT ` + exerciseColumns + `
+		FROM exercises
+		WHERE ($1 = '' OR name ILIKE '%' || $1 || '%'
+			OR EXISTS (SELECT 1 FROM unnest(aliases) alias WHERE alias ILIKE '%' || $1 || '%')
+			OR similarity(name, $1) > 0.3)
+		AND ($2 = '' OR LOWER(category) = LOWER($2))
+		AND ($3 = '' OR LOWER($3) = ANY(primary_muscle_groups) OR LOWER($3) = ANY(secondary_muscle_groups))
+		ORDER BY
+			LOWER(name) = LOWER($1) DESC,
+			EXISTS (SELECT 1 FROM unnest(aliases) alias WHERE LOWER(alias) = LOWER($1)) DESC,
+			name ILIKE $1 || '%' DESC,
+			similarity(name, $1) DESC,
+			name ASC
+		LIMIT $4
+	`
+
+	rows, err := s.db.Query(query, filter.Query, filter.Category, filter.Muscle, filter.Limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		exercise, err := scanExercise(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		exercises = append(exercises, exercise)
+	}
+
+	return exercises, rows.Err()
+}
+
+func textArray(values []string) *pgtype.TextArray {
+	array := &pgtype.TextArray{}
+
+	if values == nil {
+		values = []string{}
+	}
+
+	_ = array.Set(values)
+	return array
+}
+
+func duplicateExerciseError(err error) error {
+	var pgErr *pgconn.PgError
+
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_exercises_name" {
+		return ErrDuplicateExercise
+	}
+
+	return err
+}
+
+// exerciseReferenceError reports a workout or template entry pointing at a
+// missing exercise as ErrExerciseNotFound.
+func exerciseReferenceError(err error) error {
+	var pgErr *pgconn.PgError
+
+	if !errors.As(err, &pgErr) || pgErr.Code != "23503" {
+		return err
+	}
+
+	switch pgErr.ConstraintName {
+	case "workout_entries_exercise_id_fkey", "template_entries_exercise_id_fkey":
+		return ErrExerciseNotFound
+	default:
+		return err
+	}
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExerciseStore(t *testing.T) {
+	db := setupTestDB(t)
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	exercises := NewPostgresExerciseStore(db)
+	users := NewPostgresUserStore(db)
+
+	creator := &User{Username: "creator", Email: "creator@example.com", Activated: true}
+	require.NoError(t, creator.PasswordHash.Set("password"))
+	require.NoError(t, users.CreateUser(creator))
+
+	other := &User{Username: "other", Email: "other@example.com", Activated: true}
+	require.NoError(t, other.PasswordHash.Set("password"))
+	require.NoError(t, users.CreateUser(other))
+
+	exercise := &Exercise{
+		Name:                "Zercher Squat",
+		Aliases:             []string{"Zercher"},
+		Category:            "strength",
+		PrimaryMuscleGroups: []string{"quadriceps"},
+		Equipment:           "barbell",
+		CreatedBy:           &creator.ID,
+	}
+	require.NoError(t, exercises.CreateExercise(exercise))
+
+	defer func() { _ = exercises.DeleteExercise(exercise.ID, creator.ID) }()
+
+	err := exercises.CreateExercise(&Exercise{Name: "zercher squat", Category: "strength"})
+	assert.ErrorIs(t, err, ErrDuplicateExercise)
+
+	found, err := exercises.GetExerciseByID(exercise.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Zercher"}, found.Aliases)
+	assert.Equal(t, []string{}, found.SecondaryMuscleGroups)
+
+	results, err := exercises.SearchExercises(ExerciseFilter{Query: "bp", Limit: 5})
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	assert.Equal(t, "Bench Press", results[0].Name)
+
+	results, err = exercises.SearchExercises(ExerciseFilter{Query: "Zerchr Squat", Limit: 5})
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	assert.Equal(t, exercise.ID, results[0].ID)
+
+	assert.ErrorIs(t, exercises.DeleteExercise(exercise.ID, other.ID), sql.ErrNoRows)
+
+	// Entry names only resolve to the seeded catalog and the owner's own
+	// exercises, which win over seeded ones with the same alias.
+	floorPress := &Exercise{Name: "Floor Press", Aliases: []string{"BP"}, Category: "strength", CreatedBy: &creator.ID}
+	require.NoError(t, exercises.CreateExercise(floorPress))
+
+	defer func() { _ = exercises.DeleteExercise(floorPress.ID, creator.ID) }()
+
+	var benchID int
+	require.NoError(t, db.QueryRow(`SELECT id FROM exercises WHERE name = 'Bench Press'`).Scan(&benchID))
+
+	workouts := NewPostgresWorkoutStore(db)
+	entries := []WorkoutEntry{{ExerciseName: "zercher", Sets: 1, Reps: IntPtr(5)}, {ExerciseName: "bp", Sets: 1, Reps: IntPtr(5)}}
+
+	mine, err := workouts.CreateWorkout(&Workout{Title: "mine", UserID: creator.ID, Entries: entries})
+	require.NoError(t, err)
+	assert.Equal(t, exercise.ID, *mine.Entries[0].ExerciseID)
+	assert.Equal(t, floorPress.ID, *mine.Entries[1].ExerciseID)
+
+	theirs, err := workouts.CreateWorkout(&Workout{Title: "theirs", UserID: other.ID, Entries: entries})
+	require.NoError(t, err)
+	assert.Nil(t, theirs.Entries[0].ExerciseID)
+	assert.Equal(t, benchID, *theirs.Entries[1].ExerciseID)
+
+	// Once another user logs the exercise, its creator can no longer change it.
+	_, err = workouts.CreateWorkout(&Workout{
+		Title:   "zerchers",
+		UserID:  other.ID,
+		Entries: []WorkoutEntry{{ExerciseID: &exercise.ID, ExerciseName: "zercher", Sets: 1, Reps: IntPtr(5), OrderIndex: 1}},
+	})
+	require.NoError(t, err)
+
+	found.Equipment = "safety bar"
+	assert.ErrorIs(t, exercises.UpdateExercise(found), ErrExerciseInUse)
+	assert.ErrorIs(t, exercises.DeleteExercise(exercise.ID, creator.ID), ErrExerciseInUse)
+}
+
+func TestWorkoutEntriesResolveExercises(t *testing.T) {
+	db := setupTestDB(t)
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	user := &User{Username: "lifter", Email: "lifter@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("password"))
+	require.NoError(t, NewPostgresUserStore(db).CreateUser(user))
+
+	var benchID int
+	require.NoError(t, db.QueryRow(`SELECT id FROM exercises WHERE name = 'Bench Press'`).Scan(&benchID))
+
+	workouts := NewPostgresWorkoutStore(db)
+
+	created, err := workouts.CreateWorkout(&Workout{
+		Title:  "push day",
+		UserID: user.ID,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "bench", Sets: 3, Reps: IntPtr(5)},
+			{ExerciseName: "something made up", Sets: 1, Reps: IntPtr(1)},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, created.Entries[0].ExerciseID)
+	assert.Equal(t, benchID, *created.Entries[0].ExerciseID)
+	assert.Nil(t, created.Entries[1].ExerciseID)
+
+	_, err = workouts.CreateWorkout(&Workout{
+		Title:   "bad reference",
+		UserID:  user.ID,
+		Entries: []WorkoutEntry{{ExerciseID: IntPtr(999999), ExerciseName: "Ghost", Sets: 1, Reps: IntPtr(1)}},
+	})
+	assert.ErrorIs(t, err, ErrExerciseNotFound)
+}
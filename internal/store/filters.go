@@ -0,0 +1,204 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("cursor is invalid or was issued for another sort")
+
+// WorkoutSortSafelist holds every value accepted by WorkoutFilter.Sort. A
+// leading "-" sorts in descending order.
+var WorkoutSortSafelist = []string{
+	"id", "title", "duration_minutes", "calories_burned", "performed_at", "created_at", "updated_at",
+	"-id", "-title", "-duration_minutes", "-calories_burned", "-performed_at", "-created_at", "-updated_at",
+}
+
+// sortColumnTypes holds the SQL type of each sortable column, which cursor
+// values are cast to.
+var sortColumnTypes = map[string]string{
+	"id":               "int",
+	"title":            "text",
+	"duration_minutes": "int",
+	"calories_burned":  "int",
+	"performed_at":     "timestamptz",
+	"created_at":       "timestamptz",
+	"updated_at":       "timestamptz",
+}
+
+// WorkoutFilter selects a page of workouts. A page is either numbered or,
+// when After is set, starts after the workout the cursor points to.
+type WorkoutFilter struct {
+	Page        int
+	PageSize    int
+	Sort        string
+	Title       string
+	From        *time.Time
+	To          *time.Time
+	MinDuration *int
+	MaxDuration *int
+	MinCalories *int
+	MaxCalories *int
+	// Tags keeps workouts with any of the tag names, or with all of them
+	// when TagMatchAll is set.
+	Tags        []string
+	TagMatchAll bool
+	After       *Cursor
+}
+
+// Metadata describes a page. The page numbers are omitted for pages read
+// with a cursor, and NextCursor is empty on the last page.
+type Metadata struct {
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+}
+
+// Cursor points at the last workout of a page: the next page starts after the
+// workout whose sort column holds Value and whose ID is ID.
+type Cursor struct {
+	Sort  string `json:"sort"`
+	Value string `json:"value"`
+	ID    int    `json:"id"`
+}
+
+// NewCursor returns the cursor pointing at workout under the given sort.
+func NewCursor(workout *Workout, sort string) Cursor {
+	cursor := Cursor{Sort: sort, ID: workout.ID}
+
+	switch strings.TrimPrefix(sort, "-") {
+	case "id":
+		cursor.Value = strconv.Itoa(workout.ID)
+	case "title":
+		cursor.Value = workout.Title
+	case "duration_minutes":
+		cursor.Value = strconv.Itoa(workout.DurationMinutes)
+	case "calories_burned":
+		cursor.Value = strconv.Itoa(workout.CaloriesBurned)
+	case "performed_at":
+		cursor.Value = workout.PerformedAt.Format(time.RFC3339Nano)
+	case "created_at":
+		cursor.Value = workout.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		cursor.Value = workout.UpdatedAt.Format(time.RFC3339Nano)
+	}
+
+	return cursor
+}
+
+// Encode returns the cursor as an opaque, URL safe string.
+func (c Cursor) Encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// DecodeCursor reads an encoded cursor, which must have been issued for sort.
+func DecodeCursor(encoded, sort string) (*Cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := &Cursor{}
+
+	if err = json.Unmarshal(js, cursor); err != nil || cursor.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	switch sortColumnTypes[strings.TrimPrefix(sort, "-")] {
+	case "int":
+		_, err = strconv.Atoi(cursor.Value)
+	case "timestamptz":
+		_, err = time.Parse(time.RFC3339Nano, cursor.Value)
+	}
+
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// sortColumn returns the column to order by. It panics on values outside the
+// safelist so that an unvalidated filter can never reach the SQL string.
+func (f WorkoutFilter) sortColumn() string {
+	for _, safeValue := range WorkoutSortSafelist {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+func (f WorkoutFilter) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+func (f WorkoutFilter) limit() int {
+	return f.PageSize
+}
+
+func (f WorkoutFilter) offset() int {
+	if f.After != nil {
+		return 0
+	}
+
+	return (f.Page - 1) * f.PageSize
+}
+
+// afterCursor returns the condition that keeps the rows sorted after
+// f.After. The cursor's value and ID are bound to $n and $n+1, which are NULL
+// without a cursor.
+func (f WorkoutFilter) afterCursor(n int) string {
+	column := f.sortColumn()
+	value := fmt.Sprintf("$%d::text::%s", n, sortColumnTypes[column])
+	operator := ">"
+
+	if f.sortDirection() == "DESC" {
+		operator = "<"
+	}
+
+	return fmt.Sprintf("($%d::text IS NULL OR %s %s %s OR (%s = %s AND id > $%d::int))", n, column, operator, value, column, value, n+1)
+}
+
+// cursorArgs returns the values bound by afterCursor.
+func (f WorkoutFilter) cursorArgs() []interface{} {
+	if f.After == nil {
+		return []interface{}{nil, nil}
+	}
+
+	return []interface{}{f.After.Value, f.After.ID}
+}
+
+func calculateMetadata(totalRecords int, filter WorkoutFilter) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	if filter.After != nil {
+		return Metadata{PageSize: filter.PageSize, TotalRecords: totalRecords}
+	}
+
+	return Metadata{
+		CurrentPage:  filter.Page,
+		PageSize:     filter.PageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(filter.PageSize))),
+		TotalRecords: totalRecords,
+	}
+}
@@ -0,0 +1,608 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("template_id does not match one of your templates")
+	ErrSessionNotFound  = errors.New("program session does not belong to this program")
+	ErrTemplateInUse    = errors.New("template is used by a program")
+	ErrSessionCompleted = errors.New("planned session has already been completed")
+)
+
+// Program is a multi-week plan of template sessions. Weights in a session's
+// template grow by WeightIncrement for every week after the first. Programs
+// are private to their author until they are published.
+type Program struct {
+	ID              int              `json:"id"`
+	UserID          int              `json:"user_id"`
+	Name            string           `json:"name"`
+	Description     string           `json:"description"`
+	Weeks           int              `json:"weeks"`
+	WeightIncrement float64          `json:"weight_increment"`
+	Published       bool             `json:"published"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+	Sessions        []ProgramSession `json:"sessions"`
+}
+
+// ProgramSession schedules a template on a day (1-7) of a program week.
+type ProgramSession struct {
+	ID           int    `json:"id"`
+	Week         int    `json:"week"`
+	Day          int    `json:"day"`
+	TemplateID   int    `json:"template_id"`
+	TemplateName string `json:"template_name"`
+	OrderIndex   int    `json:"order_index"`
+}
+
+type Enrollment struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"user_id"`
+	ProgramID   int       `json:"program_id"`
+	ProgramName string    `json:"program_name"`
+	StartDate   time.Time `json:"start_date"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PlannedSession is a program session placed on the calendar of an enrollment.
+// Available reports whether it may be started, which requires its program to
+// be published or to belong to the enrolled user.
+type PlannedSession struct {
+	EnrollmentID int       `json:"enrollment_id"`
+	ProgramID    int       `json:"program_id"`
+	ProgramName  string    `json:"program_name"`
+	SessionID    int       `json:"session_id"`
+	Week         int       `json:"week"`
+	Day          int       `json:"day"`
+	Date         time.Time `json:"date"`
+	TemplateID   int       `json:"template_id"`
+	TemplateName string    `json:"template_name"`
+	WeightOffset float64   `json:"weight_offset"`
+	Completed    bool      `json:"completed"`
+	WorkoutID    *int      `json:"workout_id"`
+	UserID       int       `json:"-"`
+	Available    bool      `json:"-"`
+}
+
+// ApplyProgression adds the session's weight offset to every weighted entry of
+// a workout started from it.
+func (s *PlannedSession) ApplyProgression(workout *Workout) {
+	if s.WeightOffset == 0 {
+		return
+	}
+
+	for i := range workout.Entries {
+		weight := workout.Entries[i].Weight
+
+		if weight == nil || *weight <= 0 {
+			continue
+		}
+
+		progressed := math.Min(*weight+s.WeightOffset, 999.99)
+		workout.Entries[i].Weight = &progressed
+	}
+}
+
+type ProgramStore interface {
+	CreateProgram(*Program) error
+	GetProgramByID(id int) (*Program, error)
+	GetPrograms(userID int) ([]*Program, error)
+	UpdateProgram(*Program) error
+	DeleteProgram(id, userID int) error
+	Enroll(*Enrollment) error
+	GetEnrollmentsForUser(userID int) ([]*Enrollment, error)
+	DeleteEnrollment(id, userID int) error
+	GetSchedule(userID int, from, to time.Time) ([]*PlannedSession, error)
+	GetPlannedSession(enrollmentID, sessionID int) (*PlannedSession, error)
+	StartSession(session *PlannedSession, workout *Workout) error
+}
+
+type PostgresProgramStore struct {
+	db *sql.DB
+}
+
+func NewPostgresProgramStore(db *sql.DB) *PostgresProgramStore {
+	return &PostgresProgramStore{db: db}
+}
+
+const programColumns = `id, user_id, name, description, weeks, weight_increment, published, created_at, updated_at`
+
+func programFields(program *Program) []interface{} {
+	return []interface{}{
+		&program.ID,
+		&program.UserID,
+		&program.Name,
+		&program.Description,
+		&program.Weeks,
+		&program.WeightIncrement,
+		&program.Published,
+		&program.CreatedAt,
+		&program.UpdatedAt,
+	}
+}
+
+func (s *PostgresProgramStore) CreateProgram(program *Program) error {
+	transaction, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	query := `
+		INSERT INTO programs (user_id, name, description, weeks, weight_increment, published)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at
+	`
+
+	err = transaction.QueryRow(query, program.UserID, program.Name, program.Description, program.Weeks, program.WeightIncrement, program.Published).
+		Scan(&program.ID, &program.CreatedAt, &program.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	for index := range program.Sessions {
+		err = insertProgramSession(transaction, program, index)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return transaction.Commit()
+}
+
+func (s *PostgresProgramStore) GetProgramByID(id int) (*Program, error) {
+	program := &Program{}
+
+	err := s.db.QueryRow(`SELECT `+programColumns+` FROM programs WHERE id = $1`, id).Scan(programFields(program)...)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.populateSessions([]*Program{program})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return program, nil
+}
+
+// GetPrograms lists the published programs and the user's own.
+func (s *PostgresProgramStore) GetPrograms(userID int) ([]*Program, error) {
+	programs := []*Program{}
+
+	rows, err := s.db.Query(`SELECT `+programColumns+` FROM programs WHERE published OR user_id = $1 ORDER BY name, id`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		program := &Program{}
+
+		if err = rows.Scan(programFields(program)...); err != nil {
+			return nil, err
+		}
+
+		programs = append(programs, program)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.populateSessions(programs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return programs, nil
+}
+
+// UpdateProgram replaces the program and its sessions. Sessions keep their ID
+// (and with it their completions) when it is sent back; sessions without an ID
+// are inserted and stored sessions missing from the slice are deleted.
+func (s *PostgresProgramStore) UpdateProgram(program *Program) error {
+	transaction, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	query := `
+		UPDATE programs
+		SET name = $1, description = $2, weeks = $3, weight_increment = $4, published = $5, updated_at = NOW()
+		WHERE id = $6 AND user_id = $7
+		RETURNING created_at, updated_at
+	`
+
+	err = transaction.QueryRow(query, program.Name, program.Description, program.Weeks, program.WeightIncrement, program.Published, program.ID, program.UserID).
+		Scan(&program.CreatedAt, &program.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	keptIDs := []int{}
+
+	for _, session := range program.Sessions {
+		if session.ID != 0 {
+			keptIDs = append(keptIDs, session.ID)
+		}
+	}
+
+	_, err = transaction.Exec(`DELETE FROM program_sessions WHERE program_id = $1 AND NOT (id = ANY($2))`, program.ID, keptIDs)
+
+	if err != nil {
+		return err
+	}
+
+	updateQuery := `
+		UPDATE program_sessions ps
+		SET week = $1, day = $2, template_id = t.id, order_index = $3
+		FROM workout_templates t
+		WHERE ps.id = $4 AND ps.program_id = $5 AND t.id = $6 AND t.user_id = $7
+		RETURNING t.name
+	`
+
+	for index := range program.Sessions {
+		session := &program.Sessions[index]
+
+		if session.ID == 0 {
+			err = insertProgramSession(transaction, program, index)
+
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		session.OrderIndex = index + 1
+
+		err = transaction.QueryRow(updateQuery, session.Week, session.Day, session.OrderIndex, session.ID, program.ID, session.TemplateID, program.UserID).
+			Scan(&session.TemplateName)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return sessionUpdateError(transaction, program.ID, session.ID)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return transaction.Commit()
+}
+
+func (s *PostgresProgramStore) DeleteProgram(id, userID int) error {
+	result, err := s.db.Exec(`DELETE FROM programs WHERE id = $1 AND user_id = $2`, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *PostgresProgramStore) Enroll(enrollment *Enrollment) error {
+	query := `
+		INSERT INTO program_enrollments (user_id, program_id, start_date)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	return s.db.QueryRow(query, enrollment.UserID, enrollment.ProgramID, enrollment.StartDate).Scan(&enrollment.ID, &enrollment.CreatedAt)
+}
+
+func (s *PostgresProgramStore) GetEnrollmentsForUser(userID int) ([]*Enrollment, error) {
+	enrollments := []*Enrollment{}
+
+	query := `
+		SELECT e.id, e.user_id, e.program_id, p.name, e.start_date, e.created_at
+		FROM program_enrollments e
+		INNER JOIN programs p ON p.id = e.program_id
+		WHERE e.user_id = $1
+		ORDER BY e.start_date DESC, e.id DESC
+	`
+
+	rows, err := s.db.Query(query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		enrollment := &Enrollment{}
+		err = rows.Scan(&enrollment.ID, &enrollment.UserID, &enrollment.ProgramID, &enrollment.ProgramName, &enrollment.StartDate, &enrollment.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		enrollments = append(enrollments, enrollment)
+	}
+
+	return enrollments, rows.Err()
+}
+
+func (s *PostgresProgramStore) DeleteEnrollment(id, userID int) error {
+	result, err := s.db.Exec(`DELETE FROM program_enrollments WHERE id = $1 AND user_id = $2`, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// plannedSessionQuery expands enrollments into dated sessions. Day 1 of week 1
+// falls on the enrollment's start date. Sessions completed by a trashed
+// workout count as open again.
+const plannedSessionQuery = `
+	SELECT e.id, p.id, p.name, ps.id, ps.week, ps.day, e.start_date + (ps.week - 1) * 7 + (ps.day - 1) AS date,
+		t.id, t.name, (ps.week - 1) * p.weight_increment, c.workout_id, e.user_id, p.published OR p.user_id = e.user_id
+	FROM program_enrollments e
+	INNER JOIN programs p ON p.id = e.program_id
+	INNER JOIN program_sessions ps ON ps.program_id = p.id AND ps.week <= p.weeks
+	INNER JOIN workout_templates t ON t.id = ps.template_id
+	LEFT JOIN session_completions c ON c.enrollment_id = e.id AND c.program_session_id = ps.id
+		AND c.workout_id IN (SELECT id FROM workouts WHERE deleted_at IS NULL)
+`
+
+func scanPlannedSession(row rowScanner) (*PlannedSession, error) {
+	session := &PlannedSession{}
+
+	err := row.Scan(
+		&session.EnrollmentID,
+		&session.ProgramID,
+		&session.ProgramName,
+		&session.SessionID,
+		&session.Week,
+		&session.Day,
+		&session.Date,
+		&session.TemplateID,
+		&session.TemplateName,
+		&session.WeightOffset,
+		&session.WorkoutID,
+		&session.UserID,
+		&session.Available,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	session.Completed = session.WorkoutID != nil
+	return session, nil
+}
+
+// GetSchedule lists the user's planned sessions dated between from and to, inclusive.
+func (s *PostgresProgramStore) GetSchedule(userID int, from, to time.Time) ([]*PlannedSession, error) {
+	sessions := []*PlannedSession{}
+
+	query := plannedSessionQuery + `
+		WHERE e.user_id = $1
+		AND e.start_date + (ps.week - 1) * 7 + (ps.day - 1) BETWEEN $2::date AND $3::date
+		ORDER BY date, e.id, ps.order_index
+	`
+
+	rows, err := s.db.Query(query, userID, from, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		session, err := scanPlannedSession(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *PostgresProgramStore) GetPlannedSession(enrollmentID, sessionID int) (*PlannedSession, error) {
+	session, err := scanPlannedSession(s.db.QueryRow(plannedSessionQuery+` WHERE e.id = $1 AND ps.id = $2`, enrollmentID, sessionID))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// StartSession stores the workout started from the planned session and marks
+// the session as completed by it, in one transaction. It fails with
+// ErrSessionCompleted, storing nothing, if a workout that is not in the trash
+// already completes the session.
+func (s *PostgresProgramStore) StartSession(session *PlannedSession, workout *Workout) error {
+	transaction, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	err = insertWorkout(transaction, workout)
+
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO session_completions (enrollment_id, program_session_id, workout_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (enrollment_id, program_session_id) DO UPDATE SET workout_id = EXCLUDED.workout_id, completed_at = NOW()
+		WHERE session_completions.workout_id IN (SELECT id FROM workouts WHERE deleted_at IS NOT NULL)
+	`
+
+	result, err := transaction.Exec(query, session.EnrollmentID, session.SessionID, workout.ID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrSessionCompleted
+	}
+
+	return transaction.Commit()
+}
+
+// insertProgramSession stores program.Sessions[index], which must reference one
+// of the program author's templates.
+func insertProgramSession(transaction *sql.Tx, program *Program, index int) error {
+	session := &program.Sessions[index]
+	session.OrderIndex = index + 1
+
+	query := `
+		INSERT INTO program_sessions (program_id, week, day, template_id, order_index)
+		SELECT $1, $2, $3, t.id, $4 FROM workout_templates t WHERE t.id = $5 AND t.user_id = $6
+		RETURNING id, (SELECT name FROM workout_templates WHERE id = $5)
+	`
+
+	err := transaction.QueryRow(query, program.ID, session.Week, session.Day, session.OrderIndex, session.TemplateID, program.UserID).
+		Scan(&session.ID, &session.TemplateName)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTemplateNotFound
+	}
+
+	return err
+}
+
+// sessionUpdateError explains why updating a session matched no rows.
+func sessionUpdateError(transaction *sql.Tx, programID, sessionID int) error {
+	var exists bool
+
+	err := transaction.QueryRow(`SELECT EXISTS(SELECT 1 FROM program_sessions WHERE id = $1 AND program_id = $2)`, sessionID, programID).Scan(&exists)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrSessionNotFound
+	}
+
+	return ErrTemplateNotFound
+}
+
+func (s *PostgresProgramStore) populateSessions(programs []*Program) error {
+	if len(programs) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(programs))
+	programsByID := make(map[int]*Program, len(programs))
+
+	for i, program := range programs {
+		ids[i] = program.ID
+		programsByID[program.ID] = program
+		program.Sessions = []ProgramSession{}
+	}
+
+	query := `
+		SELECT ps.program_id, ps.id, ps.week, ps.day, ps.template_id, t.name, ps.order_index
+		FROM program_sessions ps
+		INNER JOIN workout_templates t ON t.id = ps.template_id
+		WHERE ps.program_id = ANY($1)
+		ORDER BY ps.program_id, ps.week, ps.day, ps.order_index
+	`
+
+	rows, err := s.db.Query(query, ids)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var programID int
+		session := ProgramSession{}
+		err = rows.Scan(&programID, &session.ID, &session.Week, &session.Day, &session.TemplateID, &session.TemplateName, &session.OrderIndex)
+
+		if err != nil {
+			return err
+		}
+
+		program := programsByID[programID]
+		program.Sessions = append(program.Sessions, session)
+	}
+
+	return rows.Err()
+}
+
+// templateInUseError reports a template that program sessions still
+// reference as ErrTemplateInUse.
+func templateInUseError(err error) error {
+	var pgErr *pgconn.PgError
+
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" && pgErr.ConstraintName == "program_sessions_template_id_fkey" {
+		return ErrTemplateInUse
+	}
+
+	return err
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	RecordMaxWeight       = "max_weight"
+	RecordMaxReps         = "max_reps"
+	RecordBestE1RM        = "best_e1rm"
+	RecordLongestDuration = "longest_duration"
+)
+
+// PersonalRecord is the best result a user has logged for an exercise. For
+// max_reps there is one record per weight, which is stored in Weight.
+type PersonalRecord struct {
+	ID             int       `json:"id"`
+	ExerciseID     int       `json:"exercise_id"`
+	ExerciseName   string    `json:"exercise_name"`
+	RecordType     string    `json:"record_type"`
+	Weight         *float64  `json:"weight,omitempty"`
+	Value          float64   `json:"value"`
+	WorkoutID      int       `json:"workout_id"`
+	WorkoutEntryID int       `json:"workout_entry_id"`
+	AchievedAt     time.Time `json:"achieved_at"`
+}
+
+type PersonalRecordStore interface {
+	GetRecordsForUser(userID int) ([]*PersonalRecord, error)
+	GetRecordsForExercise(userID, exerciseID int) ([]*PersonalRecord, error)
+}
+
+type PostgresPersonalRecordStore struct {
+	db *sql.DB
+}
+
+func NewPostgresPersonalRecordStore(db *sql.DB) *PostgresPersonalRecordStore {
+	return &PostgresPersonalRecordStore{db: db}
+}
+
+const recordColumns = `pr.id, pr.exercise_id, e.name, pr.record_type, pr.weight, pr.value, pr.workout_id, pr.workout_entry_id, pr.achieved_at`
+
+type rowsQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (s *PostgresPersonalRecordStore) GetRecordsForUser(userID int) ([]*PersonalRecord, error) {
+	return queryRecords(s.db, `
+		SELECT `+recordColumns+`
+		FROM personal_records pr
+		INNER JOIN exercises e ON e.id = pr.exercise_id
+		WHERE pr.user_id = $1
+		ORDER BY e.name, pr.record_type, pr.weight
+	`, userID)
+}
+
+func (s *PostgresPersonalRecordStore) GetRecordsForExercise(userID, exerciseID int) ([]*PersonalRecord, error) {
+	return queryRecords(s.db, `
+		SELECT `+recordColumns+`
+		FROM personal_records pr
+		INNER JOIN exercises e ON e.id = pr.exercise_id
+		WHERE pr.user_id = $1 AND pr.exercise_id = $2
+		ORDER BY pr.record_type, pr.weight
+	`, userID, exerciseID)
+}
+
+func queryRecords(db rowsQuerier, query string, args ...interface{}) ([]*PersonalRecord, error) {
+	records := []*PersonalRecord{}
+
+	rows, err := db.Query(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		record := &PersonalRecord{}
+		err = rows.Scan(
+			&record.ID,
+			&record.ExerciseID,
+			&record.ExerciseName,
+			&record.RecordType,
+			&record.Weight,
+			&record.Value,
+			&record.WorkoutID,
+			&record.WorkoutEntryID,
+			&record.AchievedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// recomputeRecordsQuery rebuilds the records of user $1 for the exercises in
+// $2 from every logged entry outside the trash. Ties go to the earliest workout, so repeating a
+// previous best does not count as a new record. e1RM uses the Epley formula.
+const recomputeRecordsQuery = `
+	WITH entries AS (
+		SELECT we.id AS entry_id, we.workout_id, we.exercise_id, we.reps, we.weight, we.duration_seconds, w.performed_at
+		FROM workout_entries we
+		INNER JOIN workouts w ON w.id = we.workout_id
+		WHERE w.user_id = $1 AND w.deleted_at IS NULL AND we.exercise_id = ANY($2)
+	),
+	candidates AS (
+		SELECT 'max_weight' AS record_type, exercise_id, NULL::DECIMAL AS weight, weight AS value, workout_id, entry_id, performed_at
+		FROM entries WHERE weight > 0
+		UNION ALL
+		SELECT 'max_reps', exercise_id, COALESCE(weight, 0), reps, workout_id, entry_id, performed_at
+		FROM entries WHERE reps > 0
+		UNION ALL
+		SELECT 'best_e1rm', exercise_id, NULL, ROUND(CASE WHEN reps = 1 THEN weight ELSE weight * (1 + reps / 30.0) END, 2), workout_id, entry_id, performed_at
+		FROM entries WHERE weight > 0 AND reps > 0
+		UNION ALL
+		SELECT 'longest_duration', exercise_id, NULL, duration_seconds, workout_id, entry_id, performed_at
+		FROM entries WHERE duration_seconds > 0
+	)
+	INSERT INTO personal_records (user_id, exercise_id, record_type, weight, value, workout_id, workout_entry_id, achieved_at)
+	SELECT DISTINCT ON (record_type, exercise_id, weight) $1, exercise_id, record_type, weight, value, workout_id, entry_id, performed_at
+	FROM candidates
+	ORDER BY record_type, exercise_id, weight, value DESC, performed_at, entry_id
+`
+
+type recordKey struct {
+	exerciseID int
+	recordType string
+	weight     float64
+}
+
+func (r *PersonalRecord) key() recordKey {
+	key := recordKey{exerciseID: r.ExerciseID, recordType: r.RecordType}
+
+	if r.Weight != nil {
+		key.weight = *r.Weight
+	}
+
+	return key
+}
+
+// recomputePersonalRecords rebuilds the user's records for the given exercises
+// inside transaction and returns the records that workoutID newly set or
+// improved.
+func recomputePersonalRecords(transaction *sql.Tx, userID, workoutID int, exerciseIDs []int) ([]*PersonalRecord, error) {
+	newRecords := []*PersonalRecord{}
+
+	if len(exerciseIDs) == 0 {
+		return newRecords, nil
+	}
+
+	selectQuery := `
+		SELECT ` + recordColumns + `
+		FROM personal_records pr
+		INNER JOIN exercises e ON e.id = pr.exercise_id
+		WHERE pr.user_id = $1 AND pr.exercise_id = ANY($2)
+	`
+
+	previous, err := queryRecords(transaction, selectQuery, userID, exerciseIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = transaction.Exec(`DELETE FROM personal_records WHERE user_id = $1 AND exercise_id = ANY($2)`, userID, exerciseIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = transaction.Exec(recomputeRecordsQuery, userID, exerciseIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := queryRecords(transaction, selectQuery+` AND pr.workout_id = $3 ORDER BY e.name, pr.record_type, pr.weight`, userID, exerciseIDs, workoutID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	previousValues := make(map[recordKey]float64, len(previous))
+
+	for _, record := range previous {
+		previousValues[record.key()] = record.Value
+	}
+
+	for _, record := range current {
+		if value, ok := previousValues[record.key()]; !ok || record.Value > value {
+			newRecords = append(newRecords, record)
+		}
+	}
+
+	return newRecords, nil
+}
+
+// workoutExerciseIDs lists the catalog exercises referenced by a workout's entries.
+func workoutExerciseIDs(transaction *sql.Tx, workoutID int) ([]int, error) {
+	exerciseIDs := []int{}
+
+	rows, err := transaction.Query(`SELECT DISTINCT exercise_id FROM workout_entries WHERE workout_id = $1 AND exercise_id IS NOT NULL`, workoutID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var exerciseID int
+
+		if err = rows.Scan(&exerciseID); err != nil {
+			return nil, err
+		}
+
+		exerciseIDs = append(exerciseIDs, exerciseID)
+	}
+
+	return exerciseIDs, rows.Err()
+}
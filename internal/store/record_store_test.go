@@ -0,0 +1,91 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func recordTypes(records []*PersonalRecord) []string {
+	types := []string{}
+
+	for _, record := range records {
+		types = append(types, record.RecordType)
+	}
+
+	return types
+}
+
+func TestPersonalRecords(t *testing.T) {
+	db := setupTestDB(t)
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	user := &User{Username: "recordholder", Email: "records@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("password"))
+	require.NoError(t, NewPostgresUserStore(db).CreateUser(user))
+
+	workouts := NewPostgresWorkoutStore(db)
+	records := NewPostgresPersonalRecordStore(db)
+	day := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	first, err := workouts.CreateWorkout(&Workout{
+		Title:       "squat day",
+		UserID:      user.ID,
+		PerformedAt: day,
+		Entries:     []WorkoutEntry{{ExerciseName: "Back Squat", Sets: 3, Reps: IntPtr(5), Weight: FloatPtr(100)}},
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{RecordMaxWeight, RecordMaxReps, RecordBestE1RM}, recordTypes(first.NewRecords))
+
+	repeat, err := workouts.CreateWorkout(&Workout{
+		Title:       "squat day again",
+		UserID:      user.ID,
+		PerformedAt: day.AddDate(0, 0, 2),
+		Entries:     []WorkoutEntry{{ExerciseName: "Back Squat", Sets: 3, Reps: IntPtr(5), Weight: FloatPtr(100)}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, repeat.NewRecords)
+
+	heavier, err := workouts.CreateWorkout(&Workout{
+		Title:       "heavy single",
+		UserID:      user.ID,
+		PerformedAt: day.AddDate(0, 0, 4),
+		Entries:     []WorkoutEntry{{ExerciseName: "squat", Sets: 1, Reps: IntPtr(1), Weight: FloatPtr(120)}},
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{RecordMaxWeight, RecordMaxReps, RecordBestE1RM}, recordTypes(heavier.NewRecords))
+
+	exerciseID := *first.Entries[0].ExerciseID
+	stored, err := records.GetRecordsForExercise(user.ID, exerciseID)
+	require.NoError(t, err)
+
+	for _, record := range stored {
+		if record.RecordType == RecordMaxWeight {
+			assert.Equal(t, 120.0, record.Value)
+			assert.Equal(t, heavier.ID, record.WorkoutID)
+		}
+	}
+
+	require.NoError(t, workouts.DeleteWorkout(heavier.ID, user.ID, heavier.Version))
+
+	stored, err = records.GetRecordsForExercise(user.ID, exerciseID)
+	require.NoError(t, err)
+
+	for _, record := range stored {
+		if record.RecordType == RecordMaxWeight {
+			assert.Equal(t, 100.0, record.Value)
+			assert.Equal(t, first.ID, record.WorkoutID)
+		}
+	}
+
+	// Restoring the workout from the trash sets its records again.
+	restored, err := workouts.RestoreWorkout(heavier.ID, user.ID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{RecordMaxWeight, RecordMaxReps, RecordBestE1RM}, recordTypes(restored.NewRecords))
+}
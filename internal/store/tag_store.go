@@ -0,0 +1,221 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+var ErrDuplicateTag = errors.New("a tag with this name already exists")
+
+// Tag is a user's label for workouts. WorkoutCount is the number of workouts
+// that carry it.
+type Tag struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	Name         string    `json:"name"`
+	WorkoutCount int       `json:"workout_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type TagStore interface {
+	GetTagsForUser(userID int) ([]*Tag, error)
+	GetTagByID(id int) (*Tag, error)
+	RenameTag(id, userID int, name string) error
+	MergeTags(sourceID, targetID, userID int) error
+	DeleteTag(id, userID int) error
+}
+
+type PostgresTagStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTagStore(db *sql.DB) *PostgresTagStore {
+	return &PostgresTagStore{db: db}
+}
+
+// tagQuery does not count trashed workouts.
+const tagQuery = `
+	SELECT t.id, t.user_id, t.name, t.created_at, COUNT(w.id)
+	FROM tags t
+	LEFT JOIN workout_tags wt ON wt.tag_id = t.id
+	LEFT JOIN workouts w ON w.id = wt.workout_id AND w.deleted_at IS NULL
+`
+
+// GetTagsForUser returns the user's tags, most used first.
+func (s *PostgresTagStore) GetTagsForUser(userID int) ([]*Tag, error) {
+	tags := []*Tag{}
+
+	rows, err := s.db.Query(tagQuery+` WHERE t.user_id = $1 GROUP BY t.id ORDER BY COUNT(w.id) DESC, t.name`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		tag := &Tag{}
+		err = rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.CreatedAt, &tag.WorkoutCount)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+func (s *PostgresTagStore) GetTagByID(id int) (*Tag, error) {
+	tag := &Tag{}
+
+	err := s.db.QueryRow(tagQuery+` WHERE t.id = $1 GROUP BY t.id`, id).
+		Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.CreatedAt, &tag.WorkoutCount)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// RenameTag renames the tag on every workout that carries it. Renaming to the
+// name of another of the user's tags fails with ErrDuplicateTag; use
+// MergeTags to combine them instead.
+func (s *PostgresTagStore) RenameTag(id, userID int, name string) error {
+	transaction, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	result, err := transaction.Exec(`UPDATE tags SET name = $1 WHERE id = $2 AND user_id = $3`, name, id, userID)
+
+	if err != nil {
+		return duplicateTagError(err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = touchTaggedWorkouts(transaction, id)
+
+	if err != nil {
+		return err
+	}
+
+	return transaction.Commit()
+}
+
+// MergeTags moves the source tag onto the workouts that carry it and deletes
+// it. Both tags must belong to the user; otherwise sql.ErrNoRows is returned.
+func (s *PostgresTagStore) MergeTags(sourceID, targetID, userID int) error {
+	transaction, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	var owned int
+
+	err = transaction.QueryRow(`SELECT COUNT(*) FROM tags WHERE id IN ($1, $2) AND user_id = $3`, sourceID, targetID, userID).Scan(&owned)
+
+	if err != nil {
+		return err
+	}
+
+	if sourceID == targetID || owned != 2 {
+		return sql.ErrNoRows
+	}
+
+	err = touchTaggedWorkouts(transaction, sourceID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = transaction.Exec(`
+		INSERT INTO workout_tags (workout_id, tag_id)
+		SELECT workout_id, $2 FROM workout_tags WHERE tag_id = $1
+		ON CONFLICT DO NOTHING
+	`, sourceID, targetID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = transaction.Exec(`DELETE FROM tags WHERE id = $1`, sourceID)
+
+	if err != nil {
+		return err
+	}
+
+	return transaction.Commit()
+}
+
+// DeleteTag removes the tag from every workout that carries it.
+func (s *PostgresTagStore) DeleteTag(id, userID int) error {
+	transaction, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	err = touchTaggedWorkouts(transaction, id)
+
+	if err != nil {
+		return err
+	}
+
+	result, err := transaction.Exec(`DELETE FROM tags WHERE id = $1 AND user_id = $2`, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return transaction.Commit()
+}
+
+// touchTaggedWorkouts bumps the version of the workouts carrying the tag, so
+// that their ETags change along with their tag names.
+func touchTaggedWorkouts(transaction *sql.Tx, tagID int) error {
+	_, err := transaction.Exec(`
+		UPDATE workouts SET version = version + 1
+		WHERE id IN (SELECT workout_id FROM workout_tags WHERE tag_id = $1)
+	`, tagID)
+
+	return err
+}
+
+func duplicateTagError(err error) error {
+	var pgErr *pgconn.PgError
+
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "tags_user_id_name_key" {
+		return ErrDuplicateTag
+	}
+
+	return err
+}
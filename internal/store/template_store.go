@@ -0,0 +1,306 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// WorkoutTemplate is a reusable routine that can be started as a new workout.
+// Its entries use the same shape as workout entries.
+type WorkoutTemplate struct {
+	ID          int            `json:"id"`
+	UserID      int            `json:"user_id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	Entries     []WorkoutEntry `json:"entries"`
+}
+
+// NewWorkout builds an unsaved workout pre-filled from the template.
+func (t *WorkoutTemplate) NewWorkout() *Workout {
+	workout := &Workout{
+		Title:       t.Name,
+		Description: t.Description,
+		UserID:      t.UserID,
+		Entries:     make([]WorkoutEntry, len(t.Entries)),
+	}
+
+	for i, entry := range t.Entries {
+		entry.ID = 0
+		entry.OrderIndex = i + 1
+		workout.Entries[i] = entry
+	}
+
+	return workout
+}
+
+// TemplateFromWorkout builds an unsaved template from a logged workout.
+func TemplateFromWorkout(workout *Workout, name string) *WorkoutTemplate {
+	template := &WorkoutTemplate{
+		UserID:      workout.UserID,
+		Name:        name,
+		Description: workout.Description,
+		Entries:     make([]WorkoutEntry, len(workout.Entries)),
+	}
+
+	for i, entry := range workout.Entries {
+		entry.ID = 0
+		entry.OrderIndex = i + 1
+		template.Entries[i] = entry
+	}
+
+	return template
+}
+
+type TemplateStore interface {
+	CreateTemplate(*WorkoutTemplate) error
+	GetTemplateByID(id int) (*WorkoutTemplate, error)
+	GetTemplatesForUser(userID int) ([]*WorkoutTemplate, error)
+	UpdateTemplate(*WorkoutTemplate) error
+	DeleteTemplate(id, userID int) error
+}
+
+type PostgresTemplateStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTemplateStore(db *sql.DB) *PostgresTemplateStore {
+	return &PostgresTemplateStore{db: db}
+}
+
+func (s *PostgresTemplateStore) CreateTemplate(template *WorkoutTemplate) error {
+	transaction, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	query := `
+		INSERT INTO workout_templates (user_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+	`
+
+	err = transaction.QueryRow(query, template.UserID, template.Name, template.Description).Scan(&template.ID, &template.CreatedAt, &template.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	err = insertTemplateEntries(transaction, template)
+
+	if err != nil {
+		return err
+	}
+
+	return transaction.Commit()
+}
+
+func (s *PostgresTemplateStore) GetTemplateByID(id int) (*WorkoutTemplate, error) {
+	template := &WorkoutTemplate{}
+
+	query := `SELECT id, user_id, name, description, created_at, updated_at FROM workout_templates WHERE id = $1`
+
+	err := s.db.QueryRow(query, id).Scan(&template.ID, &template.UserID, &template.Name, &template.Description, &template.CreatedAt, &template.UpdatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.populateTemplateEntries([]*WorkoutTemplate{template})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (s *PostgresTemplateStore) GetTemplatesForUser(userID int) ([]*WorkoutTemplate, error) {
+	templates := []*WorkoutTemplate{}
+
+	query := `
+		SELECT id, user_id, name, description, created_at, updated_at
+		FROM workout_templates
+		WHERE user_id = $1
+		ORDER BY name, id
+	`
+
+	rows, err := s.db.Query(query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		template := &WorkoutTemplate{}
+		err = rows.Scan(&template.ID, &template.UserID, &template.Name, &template.Description, &template.CreatedAt, &template.UpdatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, template)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.populateTemplateEntries(templates)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// UpdateTemplate replaces the template and all of its entries.
+func (s *PostgresTemplateStore) UpdateTemplate(template *WorkoutTemplate) error {
+	transaction, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	query := `
+		UPDATE workout_templates
+		SET name = $1, description = $2, updated_at = NOW()
+		WHERE id = $3 AND user_id = $4
+		RETURNING created_at, updated_at
+	`
+
+	err = transaction.QueryRow(query, template.Name, template.Description, template.ID, template.UserID).Scan(&template.CreatedAt, &template.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = transaction.Exec(`DELETE FROM template_entries WHERE template_id = $1`, template.ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = insertTemplateEntries(transaction, template)
+
+	if err != nil {
+		return err
+	}
+
+	return transaction.Commit()
+}
+
+// DeleteTemplate returns ErrTemplateInUse while a program still schedules the template.
+func (s *PostgresTemplateStore) DeleteTemplate(id, userID int) error {
+	result, err := s.db.Exec(`DELETE FROM workout_templates WHERE id = $1 AND user_id = $2`, id, userID)
+
+	if err != nil {
+		return templateInUseError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// insertTemplateEntries stores the template's entries in slice order,
+// resolving exercise_id from the name among the seeded exercises and the
+// template owner's when it is not given.
+func insertTemplateEntries(transaction *sql.Tx, template *WorkoutTemplate) error {
+	query := `
+		INSERT INTO template_entries (template_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index, exercise_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9, resolve_exercise_id($2, (SELECT user_id FROM workout_templates WHERE id = $1))))
+		RETURNING id, exercise_id
+	`
+
+	for index := range template.Entries {
+		entry := &template.Entries[index]
+		entry.OrderIndex = index + 1
+
+		err := transaction.QueryRow(
+			query,
+			template.ID,
+			entry.ExerciseName,
+			entry.Sets,
+			entry.Reps,
+			entry.DurationSeconds,
+			entry.Weight,
+			entry.Notes,
+			entry.OrderIndex,
+			entry.ExerciseID,
+		).Scan(&entry.ID, &entry.ExerciseID)
+
+		if err != nil {
+			return exerciseReferenceError(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *PostgresTemplateStore) populateTemplateEntries(templates []*WorkoutTemplate) error {
+	if len(templates) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(templates))
+	templatesByID := make(map[int]*WorkoutTemplate, len(templates))
+
+	for i, template := range templates {
+		ids[i] = template.ID
+		templatesByID[template.ID] = template
+		template.Entries = []WorkoutEntry{}
+	}
+
+	query := `
+		SELECT template_id, id, exercise_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
+		FROM template_entries
+		WHERE template_id = ANY($1)
+		ORDER BY template_id, order_index
+	`
+
+	rows, err := s.db.Query(query, ids)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var templateID int
+		entry := WorkoutEntry{}
+		err = rows.Scan(&templateID, &entry.ID, &entry.ExerciseID, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Notes, &entry.OrderIndex)
+
+		if err != nil {
+			return err
+		}
+
+		template := templatesByID[templateID]
+		template.Entries = append(template.Entries, entry)
+	}
+
+	return rows.Err()
+}
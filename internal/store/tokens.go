@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/DavidGudovic/api_exercise/internal/tokens"
@@ -15,22 +16,38 @@ func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
 	return &PostgresTokenStore{db: db}
 }
 
+// Session is a login on one device: the auth and refresh tokens that share a
+// session ID. LastUsedAt is accurate to about a minute.
+type Session struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	Current    bool       `json:"current"`
+}
+
 type TokenStore interface {
 	Insert(token *tokens.Token) error
-	CreateNewToken(userID int, tokenType string, ttlMinutes time.Duration) (*tokens.Token, error)
+	CreateNewToken(userID int, tokenType string, ttl time.Duration) (*tokens.Token, error)
 	DeleteAllTokensForUser(userID int, tokenType string) error
+	DeleteOtherSessionsForUser(userID int, keepHash []byte) error
+	GetTokenByHash(hash []byte) (*tokens.Token, error)
+	MarkTokenRotated(hash []byte) (bool, error)
+	DeleteSession(hash []byte, userID int) error
+	GetSessionsForUser(userID int, currentHash []byte) ([]*Session, error)
 }
 
 func (s *PostgresTokenStore) Insert(token *tokens.Token) error {
-	query := `INSERT INTO tokens (hash, user_id, expiry, scope)
-			  VALUES ($1, $2, $3, $4)`
+	query := `INSERT INTO tokens (hash, user_id, expiry, scope, user_agent, ip, session_id)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
-	_, err := s.db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	_, err := s.db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope, token.UserAgent, token.IP, token.SessionID)
 	return err
 }
 
-func (s *PostgresTokenStore) CreateNewToken(userID int, tokenType string, ttlMinutes time.Duration) (*tokens.Token, error) {
-	ttl := ttlMinutes * time.Minute
+func (s *PostgresTokenStore) CreateNewToken(userID int, tokenType string, ttl time.Duration) (*tokens.Token, error) {
 	token, err := tokens.GenerateToken(userID, ttl, tokenType)
 	if err != nil {
 		return nil, err
@@ -50,3 +67,141 @@ func (s *PostgresTokenStore) DeleteAllTokensForUser(userID int, tokenType string
 	_, err := s.db.Exec(query, userID, tokenType)
 	return err
 }
+
+// DeleteOtherSessionsForUser deletes the auth and refresh tokens of every
+// session except the one the token stored under keepHash belongs to.
+func (s *PostgresTokenStore) DeleteOtherSessionsForUser(userID int, keepHash []byte) error {
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND scope IN ($2, $3)
+		  AND session_id IS DISTINCT FROM (SELECT session_id FROM tokens WHERE hash = $4)
+	`
+
+	_, err := s.db.Exec(query, userID, tokens.ScopeAuth, tokens.ScopeRefresh, keepHash)
+	return err
+}
+
+// GetTokenByHash returns the unexpired token stored under hash, or nil if there is none.
+func (s *PostgresTokenStore) GetTokenByHash(hash []byte) (*tokens.Token, error) {
+	token := &tokens.Token{}
+
+	query := `
+		SELECT hash, user_id, expiry, scope, rotated_at, created_at, last_used_at, user_agent, ip, session_id
+		FROM tokens
+		WHERE hash = $1 AND expiry > NOW()
+	`
+
+	err := s.db.QueryRow(query, hash).Scan(
+		&token.Hash,
+		&token.UserID,
+		&token.Expiry,
+		&token.Scope,
+		&token.RotatedAt,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+		&token.UserAgent,
+		&token.IP,
+		&token.SessionID,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// MarkTokenRotated flags a token as exchanged. It reports false when the token
+// had already been rotated, which means it is being replayed.
+func (s *PostgresTokenStore) MarkTokenRotated(hash []byte) (bool, error) {
+	query := `UPDATE tokens SET rotated_at = NOW() WHERE hash = $1 AND rotated_at IS NULL`
+
+	result, err := s.db.Exec(query, hash)
+
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// DeleteSession deletes the auth and refresh tokens of the session the token
+// stored under hash belongs to.
+func (s *PostgresTokenStore) DeleteSession(hash []byte, userID int) error {
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $2 AND scope IN ($3, $4)
+		  AND session_id = (SELECT session_id FROM tokens WHERE hash = $1 AND user_id = $2)
+	`
+
+	result, err := s.db.Exec(query, hash, userID, tokens.ScopeAuth, tokens.ScopeRefresh)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetSessionsForUser lists the user's sessions that still have an unexpired
+// auth token, flagging the one the token stored under currentHash belongs to.
+// Sessions outlive refreshes, so each one reports the device it was last
+// refreshed from.
+func (s *PostgresTokenStore) GetSessionsForUser(userID int, currentHash []byte) ([]*Session, error) {
+	sessions := []*Session{}
+
+	query := `
+		SELECT session_id,
+		       MIN(created_at),
+		       MAX(last_used_at),
+		       MAX(expiry),
+		       (ARRAY_AGG(user_agent ORDER BY created_at DESC))[1],
+		       (ARRAY_AGG(ip ORDER BY created_at DESC))[1],
+		       BOOL_OR(hash = $3)
+		FROM tokens
+		WHERE user_id = $1 AND scope = $2 AND expiry > NOW()
+		GROUP BY session_id
+		ORDER BY COALESCE(MAX(last_used_at), MIN(created_at)) DESC
+	`
+
+	rows, err := s.db.Query(query, userID, tokens.ScopeAuth, currentHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		session := &Session{}
+		err = rows.Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt, &session.Expiry, &session.UserAgent, &session.IP, &session.Current)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
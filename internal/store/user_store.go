@@ -6,9 +6,15 @@ import (
 	"errors"
 	"time"
 
+	"github.com/jackc/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrDuplicateUsername = errors.New("a user with this username already exists")
+	ErrDuplicateEmail    = errors.New("a user with this email already exists")
+)
+
 type password struct {
 	hash      []byte
 	plaintext *string
@@ -45,6 +51,7 @@ type User struct {
 	Email        string    `json:"email"`
 	PasswordHash password  `json:"-"`
 	Bio          string    `json:"bio"`
+	Activated    bool      `json:"activated"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -61,7 +68,9 @@ type UserStore interface {
 	UpdateUser(*User) error
 	DeleteUser(id int) error
 	GetUserByUsername(username string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
 	GetUserToken(scope, plaintextPassword string) (*User, error)
+	ConsumeUserToken(scope, plaintextPassword string) (*User, error)
 }
 
 type PostgresUserStore struct {
@@ -76,15 +85,15 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 
 func (s *PostgresUserStore) CreateUser(user *User) error {
 	query := `
-			INSERT INTO users (username, email, password_hash, bio, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, NOW(), NOW())
+			INSERT INTO users (username, email, password_hash, bio, activated, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
 			RETURNING id, created_at, updated_at
 			`
 
-	err := s.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err := s.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.Activated).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
-		return err
+		return uniqueViolationError(err)
 	}
 
 	return nil
@@ -96,7 +105,7 @@ func (s *PostgresUserStore) GetUserByID(id int) (*User, error) {
 	}
 
 	query := `
-			SELECT id, username, email, password_hash, bio, created_at, updated_at
+			SELECT id, username, email, password_hash, bio, activated, created_at, updated_at
 			FROM users
 			WHERE id = $1
 			`
@@ -107,6 +116,7 @@ func (s *PostgresUserStore) GetUserByID(id int) (*User, error) {
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.Activated,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -124,25 +134,15 @@ func (s *PostgresUserStore) GetUserByID(id int) (*User, error) {
 func (s *PostgresUserStore) UpdateUser(user *User) error {
 	query := `
 			UPDATE users
-			SET username = $1, email = $2, password_hash = $3, bio = $4, updated_at = NOW()
-			WHERE id = $5
+			SET username = $1, email = $2, password_hash = $3, bio = $4, activated = $5, updated_at = NOW()
+			WHERE id = $6
 			RETURNING updated_at
 			`
 
-	result, err := s.db.Exec(query, user.Username, user.Email, user.PasswordHash, user.Bio, user.ID)
-
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
+	err := s.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.Activated, user.ID).Scan(&user.UpdatedAt)
 
 	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return uniqueViolationError(err)
 	}
 
 	return nil
@@ -179,7 +179,7 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 	}
 
 	query := `
-			SELECT id, username, email, password_hash, bio, created_at, updated_at
+			SELECT id, username, email, password_hash, bio, activated, created_at, updated_at
 			FROM users
 			WHERE username = $1
 			`
@@ -190,6 +190,7 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.Activated,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -205,24 +206,92 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 	return user, nil
 }
 
+func (s *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
+	user := &User{
+		PasswordHash: password{},
+	}
+
+	query := `
+			SELECT id, username, email, password_hash, bio, activated, created_at, updated_at
+			FROM users
+			WHERE LOWER(email) = LOWER($1)
+			`
+
+	err := s.db.QueryRow(query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash.hash,
+		&user.Bio,
+		&user.Activated,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetUserToken returns the user of an unexpired token. It runs on every
+// authenticated request, so last_used_at is only written when it is more
+// than a minute old.
 func (s *PostgresUserStore) GetUserToken(scope, plaintextPassword string) (*User, error) {
-	user := &User{}
+	query := `
+		WITH t AS (
+			SELECT user_id FROM tokens
+			WHERE hash = $1 AND scope = $2 AND expiry > NOW()
+		), touched AS (
+			UPDATE tokens SET last_used_at = NOW()
+			WHERE hash = $1 AND scope = $2 AND expiry > NOW()
+			  AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+		)
+		SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.activated, u.created_at, u.updated_at
+		FROM users u
+		INNER JOIN t ON u.id = t.user_id
+	`
 
-	tokenHash := sha256.Sum256([]byte(plaintextPassword))
+	return s.queryUserByToken(query, scope, plaintextPassword)
+}
 
+// ConsumeUserToken deletes an unexpired token and returns its user, so that
+// of two requests racing with the same single-use token only one gets the
+// user.
+func (s *PostgresUserStore) ConsumeUserToken(scope, plaintextPassword string) (*User, error) {
 	query := `
-		SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.created_at, u.updated_at
+		WITH t AS (
+			DELETE FROM tokens
+			WHERE hash = $1 AND scope = $2 AND expiry > NOW()
+			RETURNING user_id
+		)
+		SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.activated, u.created_at, u.updated_at
 		FROM users u
-		INNER JOIN tokens t ON u.id = t.user_id
-		WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > NOW()
+		INNER JOIN t ON u.id = t.user_id
 	`
 
+	return s.queryUserByToken(query, scope, plaintextPassword)
+}
+
+// queryUserByToken runs a query that finds a user by the token hash $1 and
+// scope $2, returning nil when no token matches.
+func (s *PostgresUserStore) queryUserByToken(query, scope, plaintextPassword string) (*User, error) {
+	user := &User{}
+
+	tokenHash := sha256.Sum256([]byte(plaintextPassword))
+
 	err := s.db.QueryRow(query, tokenHash[:], scope).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.Activated,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -237,3 +306,22 @@ func (s *PostgresUserStore) GetUserToken(scope, plaintextPassword string) (*User
 
 	return user, nil
 }
+
+// uniqueViolationError translates a unique constraint violation on users into
+// ErrDuplicateUsername or ErrDuplicateEmail and returns other errors unchanged.
+func uniqueViolationError(err error) error {
+	var pgErr *pgconn.PgError
+
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return err
+	}
+
+	switch pgErr.ConstraintName {
+	case "users_username_key":
+		return ErrDuplicateUsername
+	case "users_email_lower_key":
+		return ErrDuplicateEmail
+	default:
+		return err
+	}
+}
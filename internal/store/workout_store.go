@@ -3,6 +3,19 @@ package store
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"html"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+var (
+	ErrEntryNotFound = errors.New("workout entry does not belong to this workout")
+	ErrEditConflict  = errors.New("workout was modified by another request")
 )
 
 type Workout struct {
@@ -12,11 +25,101 @@ type Workout struct {
 	UserID          int            `json:"user_id"`
 	DurationMinutes int            `json:"duration_minutes"`
 	CaloriesBurned  int            `json:"calories_burned"`
+	Version         int            `json:"version"`
+	PerformedAt     time.Time      `json:"performed_at"`
+	StartedAt       *time.Time     `json:"started_at"`
+	EndedAt         *time.Time     `json:"ended_at"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       *time.Time     `json:"deleted_at,omitempty"`
 	Entries         []WorkoutEntry `json:"entries"`
+	// Tags holds the names of the workout's tags in alphabetical order.
+	Tags []string `json:"tags"`
+	// NewRecords is only set on the workout returned by CreateWorkout and
+	// UpdateWorkout and lists the personal records that the write set.
+	NewRecords []*PersonalRecord `json:"new_records,omitempty"`
+}
+
+// insertEntryQuery resolves exercise_id from the exercise name when it is not
+// given, among the seeded exercises and those of the workout's owner.
+const insertEntryQuery = `
+	INSERT INTO workout_entries(workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index, exercise_id,
+		distance_meters, elevation_gain_meters, avg_heart_rate, max_heart_rate)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9, resolve_exercise_id($2, (SELECT user_id FROM workouts WHERE id = $1))),
+		$10, $11, $12, $13)
+	RETURNING id, exercise_id
+`
+
+// workoutColumns lists the workouts columns in the order scanned by workoutFields.
+const workoutColumns = `id, title, description, duration_minutes, calories_burned, user_id, version, performed_at, started_at, ended_at, created_at, updated_at, deleted_at`
+
+func workoutFields(workout *Workout) []interface{} {
+	return []interface{}{
+		&workout.ID,
+		&workout.Title,
+		&workout.Description,
+		&workout.DurationMinutes,
+		&workout.CaloriesBurned,
+		&workout.UserID,
+		&workout.Version,
+		&workout.PerformedAt,
+		&workout.StartedAt,
+		&workout.EndedAt,
+		&workout.CreatedAt,
+		&workout.UpdatedAt,
+		&workout.DeletedAt,
+	}
+}
+
+// normalizeTimes defaults performed_at to the start time (or now) and derives
+// duration_minutes from the start and end times when it was not given.
+func (w *Workout) normalizeTimes() {
+	if w.PerformedAt.IsZero() {
+		if w.StartedAt != nil {
+			w.PerformedAt = *w.StartedAt
+		} else {
+			w.PerformedAt = time.Now()
+		}
+	}
+
+	if w.DurationMinutes == 0 && w.StartedAt != nil && w.EndedAt != nil {
+		w.DurationMinutes = w.derivedDurationMinutes()
+	}
+}
+
+func (w *Workout) derivedDurationMinutes() int {
+	return int(w.EndedAt.Sub(*w.StartedAt).Round(time.Minute).Minutes())
+}
+
+// InheritTimes fills in what an update of the stored workout leaves out.
+// performed_at keeps its stored value, and when started_at or ended_at moved
+// while duration_minutes was left as stored, the duration is derived from the
+// new times again.
+func (w *Workout) InheritTimes(stored *Workout) {
+	if w.PerformedAt.IsZero() {
+		w.PerformedAt = stored.PerformedAt
+	}
+
+	if w.StartedAt == nil || w.EndedAt == nil || w.DurationMinutes != stored.DurationMinutes {
+		return
+	}
+
+	if !sameTime(w.StartedAt, stored.StartedAt) || !sameTime(w.EndedAt, stored.EndedAt) {
+		w.DurationMinutes = w.derivedDurationMinutes()
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
 }
 
 type WorkoutEntry struct {
 	ID              int      `json:"id"`
+	ExerciseID      *int     `json:"exercise_id"`
 	ExerciseName    string   `json:"exercise_name"`
 	Sets            int      `json:"sets"`
 	Reps            *int     `json:"reps"`
@@ -24,15 +127,63 @@ type WorkoutEntry struct {
 	Weight          *float64 `json:"weight"`
 	Notes           string   `json:"notes"`
 	OrderIndex      int      `json:"order_index"`
+	// The cardio fields are set for entries that cover a distance.
+	DistanceMeters      *float64 `json:"distance_meters"`
+	ElevationGainMeters *float64 `json:"elevation_gain_meters"`
+	AvgHeartRate        *int     `json:"avg_heart_rate"`
+	MaxHeartRate        *int     `json:"max_heart_rate"`
+	// PaceSecondsPerKm is derived from the distance and duration on read.
+	PaceSecondsPerKm *float64 `json:"pace_seconds_per_km,omitempty"`
+	// TrackPoints are only stored when the entry is inserted and are never
+	// loaded with the workout; see GetTrackPoints.
+	TrackPoints []TrackPoint `json:"-"`
+}
+
+// derivePace sets PaceSecondsPerKm for timed entries with a distance.
+func (e *WorkoutEntry) derivePace() {
+	e.PaceSecondsPerKm = nil
+
+	if e.DistanceMeters == nil || *e.DistanceMeters <= 0 || e.DurationSeconds == nil {
+		return
+	}
+
+	pace := math.Round(float64(*e.DurationSeconds)/(*e.DistanceMeters/1000)*10) / 10
+	e.PaceSecondsPerKm = &pace
+}
+
+// TrackPoint is one recorded point of a cardio entry's route.
+type TrackPoint struct {
+	EntryID         int        `json:"entry_id"`
+	RecordedAt      *time.Time `json:"recorded_at"`
+	Latitude        *float64   `json:"latitude"`
+	Longitude       *float64   `json:"longitude"`
+	ElevationMeters *float64   `json:"elevation_meters"`
+	HeartRate       *int       `json:"heart_rate"`
+}
+
+// WorkoutSearchResult is a workout matching a full-text search. Snippet is an
+// HTML-escaped excerpt in which the matching words are wrapped in <b> tags,
+// so it is safe to render as HTML.
+type WorkoutSearchResult struct {
+	Workout *Workout `json:"workout"`
+	Rank    float64  `json:"rank"`
+	Snippet string   `json:"snippet"`
 }
 
 type WorkoutStore interface {
 	CreateWorkout(*Workout) (*Workout, error)
+	CreateWorkouts([]*Workout) error
 	GetWorkoutByID(id int) (*Workout, error)
-	UpdateWorkout(*Workout) error
-	DeleteWorkout(id int) error
-	GetAllWorkouts() ([]*Workout, error)
+	UpdateWorkout(*Workout) (*Workout, error)
+	DeleteWorkout(id, userID, version int) error
+	RestoreWorkout(id, userID int) (*Workout, error)
+	GetDeletedWorkouts(userID int, filter WorkoutFilter) ([]*Workout, Metadata, error)
+	PurgeDeletedWorkouts(deletedBefore time.Time) (int, error)
+	GetAllWorkouts(userID int, filter WorkoutFilter) ([]*Workout, Metadata, error)
+	SearchWorkouts(userID int, query string, filter WorkoutFilter) ([]*WorkoutSearchResult, Metadata, error)
+	ExportWorkouts(userID int, visit func(*Workout) error) error
 	GetWorkoutOwnerID(workoutID int) (int, error)
+	GetTrackPoints(workoutID int) ([]TrackPoint, error)
 }
 
 type PostgresWorkoutStore struct {
@@ -43,26 +194,250 @@ func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
 	return &PostgresWorkoutStore{db: db}
 }
 
-func (pg *PostgresWorkoutStore) GetAllWorkouts() ([]*Workout, error) {
-	var workouts []*Workout
+// workoutFilterClause selects the workouts of GetAllWorkouts, with the
+// filter's values bound to $1 to $10. The title is matched as literal text,
+// which ILIKE would not do for % and _.
+const workoutFilterClause = `
+	FROM workouts
+	WHERE user_id = $1 AND deleted_at IS NULL
+	AND ($2 = '' OR position(lower($2) in lower(title)) > 0)
+	AND ($3::timestamptz IS NULL OR performed_at >= $3)
+	AND ($4::timestamptz IS NULL OR performed_at <= $4)
+	AND ($5::int IS NULL OR duration_minutes >= $5)
+	AND ($6::int IS NULL OR duration_minutes <= $6)
+	AND ($7::int IS NULL OR calories_burned >= $7)
+	AND ($8::int IS NULL OR calories_burned <= $8)
+	AND (cardinality($9::text[]) = 0 OR (
+		SELECT COUNT(*)
+		FROM workout_tags wt
+		JOIN tags t ON t.id = wt.tag_id
+		WHERE wt.workout_id = workouts.id AND t.name = ANY($9)
+	) >= CASE WHEN $10 THEN cardinality($9::text[]) ELSE 1 END)
+`
+
+// GetAllWorkouts returns a page of the user's workouts. The metadata carries
+// a cursor to the next page when there is one.
+func (pg *PostgresWorkoutStore) GetAllWorkouts(userID int, filter WorkoutFilter) ([]*Workout, Metadata, error) {
+	args := []interface{}{
+		userID,
+		filter.Title,
+		filter.From,
+		filter.To,
+		filter.MinDuration,
+		filter.MaxDuration,
+		filter.MinCalories,
+		filter.MaxCalories,
+		textArray(filter.Tags),
+		filter.TagMatchAll,
+	}
 
-	rows, err := pg.db.Query(`SELECT id, title, description, duration_minutes, calories_burned FROM workouts`)
+	totalRecords, err := pg.countWorkouts(workoutFilterClause, args...)
 
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
+	}
+
+	// One row more than the page holds tells whether there is a next page.
+	query := fmt.Sprintf(`
+		SELECT %s
+		%s
+		AND %s
+		ORDER BY %s %s, id ASC
+		LIMIT $11 OFFSET $12
+	`, workoutColumns, workoutFilterClause, filter.afterCursor(13), filter.sortColumn(), filter.sortDirection())
+
+	args = append(args, filter.limit()+1, filter.offset())
+	args = append(args, filter.cursorArgs()...)
+
+	workouts, err := pg.queryWorkouts(query, args...)
+
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filter)
+
+	if len(workouts) > filter.limit() {
+		workouts = workouts[:filter.limit()]
+		metadata.NextCursor = NewCursor(workouts[len(workouts)-1], filter.Sort).Encode()
+	}
+
+	err = pg.populateEntriesForWorkouts(workouts)
+
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return workouts, metadata, nil
+}
+
+// countWorkouts counts the workouts that a listing's FROM and WHERE clause
+// selects. Listings count separately from reading their page, which would
+// find no rows to count on a page past the end.
+func (pg *PostgresWorkoutStore) countWorkouts(clause string, args ...interface{}) (int, error) {
+	var totalRecords int
+
+	err := pg.db.QueryRow(`SELECT COUNT(*) `+clause, args...).Scan(&totalRecords)
+	return totalRecords, err
+}
+
+// searchClause selects the workouts matching the search query $2, with the
+// user and date range bound to $1, $3 and $4.
+const searchClause = `
+	FROM workouts w
+	WHERE w.user_id = $1 AND w.deleted_at IS NULL
+	AND w.search_vector @@ websearch_to_tsquery('english', $2)
+	AND ($3::timestamptz IS NULL OR w.performed_at >= $3)
+	AND ($4::timestamptz IS NULL OR w.performed_at <= $4)
+`
+
+// SearchWorkouts ranks the user's workouts against query, which uses web
+// search syntax such as quoted phrases and -excluded words. Only the date
+// range and the pagination of filter apply. Snippets are only computed for
+// the requested page since ts_headline has to re-parse each document.
+func (pg *PostgresWorkoutStore) SearchWorkouts(userID int, query string, filter WorkoutFilter) ([]*WorkoutSearchResult, Metadata, error) {
+	results := []*WorkoutSearchResult{}
+
+	totalRecords, err := pg.countWorkouts(searchClause, userID, query, filter.From, filter.To)
+
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	searchQuery := fmt.Sprintf(`
+		WITH matches AS (
+			SELECT w.id AS workout_id, ts_rank(w.search_vector, websearch_to_tsquery('english', $2)) AS rank
+			%s
+			ORDER BY rank DESC, w.performed_at DESC, w.id DESC
+			LIMIT $5 OFFSET $6
+		)
+		SELECT m.rank, ts_headline(
+			'english',
+			translate(concat_ws(' ', title, description, (
+				SELECT string_agg(concat_ws(' ', e.exercise_name, e.notes), ' ' ORDER BY e.order_index)
+				FROM workout_entries e
+				WHERE e.workout_id = m.workout_id
+			)), E'\x01\x02', ''),
+			websearch_to_tsquery('english', $2),
+			E'MaxFragments=2, MinWords=5, MaxWords=20, StartSel=\x01, StopSel=\x02'
+		), %s
+		FROM matches m
+		JOIN workouts ON id = m.workout_id
+		ORDER BY m.rank DESC, performed_at DESC, id DESC
+	`, searchClause, workoutColumns)
+
+	rows, err := pg.db.Query(searchQuery, userID, query, filter.From, filter.To, filter.limit(), filter.offset())
+
+	if err != nil {
+		return nil, Metadata{}, err
 	}
 
 	defer func() { _ = rows.Close() }()
 
+	workouts := []*Workout{}
+
 	for rows.Next() {
-		workout := &Workout{}
-		err = rows.Scan(&workout.ID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned)
+		result := &WorkoutSearchResult{Workout: &Workout{}}
+		err = rows.Scan(append([]interface{}{&result.Rank, &result.Snippet}, workoutFields(result.Workout)...)...)
 
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 
-		err = pg.populateEntriesForWorkout(workout)
+		result.Snippet = highlightSnippet(result.Snippet)
+		results = append(results, result)
+		workouts = append(workouts, result.Workout)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = pg.populateEntriesForWorkouts(workouts)
+
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return results, calculateMetadata(totalRecords, filter), nil
+}
+
+// snippetStart and snippetStop are the markers ts_headline puts around the
+// matching words. Both are removed from the source text beforehand, so
+// unlike tags they can only come from ts_headline.
+const (
+	snippetStart = "\x01"
+	snippetStop  = "\x02"
+)
+
+// highlightSnippet HTML-escapes a ts_headline excerpt and only then turns
+// its markers into <b> tags, so the workout's own text cannot inject markup.
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer(snippetStart, "<b>", snippetStop, "</b>").Replace(html.EscapeString(snippet))
+}
+
+// exportPageSize is the number of workouts ExportWorkouts loads per query.
+const exportPageSize = 500
+
+// ExportWorkouts calls visit with each of the user's workouts, oldest first,
+// without loading all of them into memory at once.
+func (pg *PostgresWorkoutStore) ExportWorkouts(userID int, visit func(*Workout) error) error {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM workouts
+		WHERE user_id = $1 AND deleted_at IS NULL AND (performed_at, id) > ($2, $3)
+		ORDER BY performed_at, id
+		LIMIT $4
+	`, workoutColumns)
+
+	var afterPerformedAt time.Time
+	afterID := 0
+
+	for {
+		workouts, err := pg.queryWorkouts(query, userID, afterPerformedAt, afterID, exportPageSize)
+
+		if err != nil {
+			return err
+		}
+
+		err = pg.populateEntriesForWorkouts(workouts)
+
+		if err != nil {
+			return err
+		}
+
+		for _, workout := range workouts {
+			err = visit(workout)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(workouts) < exportPageSize {
+			return nil
+		}
+
+		last := workouts[len(workouts)-1]
+		afterPerformedAt, afterID = last.PerformedAt, last.ID
+	}
+}
+
+// queryWorkouts scans rows of workoutColumns.
+func (pg *PostgresWorkoutStore) queryWorkouts(query string, args ...interface{}) ([]*Workout, error) {
+	workouts := []*Workout{}
+
+	rows, err := pg.db.Query(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		workout := &Workout{}
+		err = rows.Scan(workoutFields(workout)...)
 
 		if err != nil {
 			return nil, err
@@ -71,7 +446,7 @@ func (pg *PostgresWorkoutStore) GetAllWorkouts() ([]*Workout, error) {
 		workouts = append(workouts, workout)
 	}
 
-	return workouts, nil
+	return workouts, rows.Err()
 }
 
 func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
@@ -83,61 +458,126 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 
 	defer func() { _ = transaction.Rollback() }()
 
+	err = insertWorkout(transaction, workout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = transaction.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+// CreateWorkouts inserts all workouts in a single transaction, so either all
+// of them are stored or none are.
+func (pg *PostgresWorkoutStore) CreateWorkouts(workouts []*Workout) error {
+	transaction, err := pg.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	for _, workout := range workouts {
+		err = insertWorkout(transaction, workout)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return transaction.Commit()
+}
+
+// insertWorkout stores the workout and its entries and recomputes the
+// personal records that they touch.
+func insertWorkout(transaction *sql.Tx, workout *Workout) error {
 	query := `
-			INSERT INTO workouts(user_id, title, description, duration_minutes, calories_burned)
-			VALUES ($1, $2, $3, $4, $5)
-			RETURNING id
+			INSERT INTO workouts(user_id, title, description, duration_minutes, calories_burned, performed_at, started_at, ended_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id, version, performed_at, created_at, updated_at
 		`
 
-	err = transaction.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.ID)
+	workout.normalizeTimes()
+
+	err := transaction.QueryRow(
+		query,
+		workout.UserID,
+		workout.Title,
+		workout.Description,
+		workout.DurationMinutes,
+		workout.CaloriesBurned,
+		workout.PerformedAt,
+		workout.StartedAt,
+		workout.EndedAt,
+	).Scan(&workout.ID, &workout.Version, &workout.PerformedAt, &workout.CreatedAt, &workout.UpdatedAt)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	for index := range workout.Entries {
-		entryQuery := `
-				INSERT INTO workout_entries(workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-				RETURNING id
-			`
+		entry := &workout.Entries[index]
 
 		err = transaction.QueryRow(
-			entryQuery,
+			insertEntryQuery,
 			workout.ID,
-			workout.Entries[index].ExerciseName,
-			workout.Entries[index].Sets,
-			workout.Entries[index].Reps,
-			workout.Entries[index].DurationSeconds,
-			workout.Entries[index].Weight,
-			workout.Entries[index].Notes,
-			workout.Entries[index].OrderIndex,
-		).Scan(&workout.Entries[index].ID)
+			entry.ExerciseName,
+			entry.Sets,
+			entry.Reps,
+			entry.DurationSeconds,
+			entry.Weight,
+			entry.Notes,
+			entry.OrderIndex,
+			entry.ExerciseID,
+			entry.DistanceMeters,
+			entry.ElevationGainMeters,
+			entry.AvgHeartRate,
+			entry.MaxHeartRate,
+		).Scan(&entry.ID, &entry.ExerciseID)
 
 		if err != nil {
-			return nil, err
+			return exerciseReferenceError(err)
+		}
+
+		entry.derivePace()
+
+		err = insertTrackPoints(transaction, entry)
+
+		if err != nil {
+			return err
 		}
 	}
 
-	err = transaction.Commit()
+	err = setWorkoutTags(transaction, workout)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return workout, nil
+	exerciseIDs, err := workoutExerciseIDs(transaction, workout.ID)
+
+	if err != nil {
+		return err
+	}
+
+	workout.NewRecords, err = recomputePersonalRecords(transaction, workout.UserID, workout.ID, exerciseIDs)
+
+	return err
 }
 
 func (pg *PostgresWorkoutStore) GetWorkoutByID(id int) (*Workout, error) {
 	workout := &Workout{}
 
-	query := `
-		SELECT id, title, description, duration_minutes, calories_burned, user_id
-		FROM workouts
-		WHERE id = $1
-	`
+	query := `SELECT ` + workoutColumns + ` FROM workouts WHERE id = $1 AND deleted_at IS NULL`
 
-	err := pg.db.QueryRow(query, id).Scan(&workout.ID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.UserID)
+	err := pg.db.QueryRow(query, id).Scan(workoutFields(workout)...)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
@@ -147,7 +587,7 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int) (*Workout, error) {
 		return nil, err
 	}
 
-	err = pg.populateEntriesForWorkout(workout)
+	err = pg.populateEntriesForWorkouts([]*Workout{workout})
 
 	if err != nil {
 		return nil, err
@@ -156,62 +596,374 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int) (*Workout, error) {
 	return workout, nil
 }
 
-func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
+// UpdateWorkout replaces the workout and its entries with the given ones.
+// Entries without an ID are inserted, stored entries missing from the slice are
+// deleted, and order_index is renumbered to follow the slice order. The update
+// only succeeds while the stored version still equals workout.Version;
+// otherwise ErrEditConflict is returned.
+func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) (*Workout, error) {
 	transaction, err := pg.db.Begin()
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer func() { _ = transaction.Rollback() }()
 
-	updateQuery := `UPDATE workouts SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4 WHERE id = $5`
+	updateQuery := `
+		UPDATE workouts
+		SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4,
+			performed_at = $5, started_at = $6, ended_at = $7, version = version + 1, updated_at = NOW()
+		WHERE id = $8 AND user_id = $9 AND version = $10 AND deleted_at IS NULL
+	`
 
-	result, err := transaction.Exec(updateQuery, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
+	workout.normalizeTimes()
+
+	result, err := transaction.Exec(
+		updateQuery,
+		workout.Title,
+		workout.Description,
+		workout.DurationMinutes,
+		workout.CaloriesBurned,
+		workout.PerformedAt,
+		workout.StartedAt,
+		workout.EndedAt,
+		workout.ID,
+		workout.UserID,
+		workout.Version,
+	)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 
 	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return nil, pg.missingOrConflict(workout.ID, workout.UserID)
 	}
 
-	updateEntryQuery := `UPDATE workout_entries SET exercise_name = $1, sets = $2, reps = $3, duration_seconds = $4, weight = $5, notes = $6, order_index = $7 WHERE id = $8 AND workout_id = $9`
+	previousExerciseIDs, err := workoutExerciseIDs(transaction, workout.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keptIDs := []int{}
 
 	for _, entry := range workout.Entries {
-		_, err = transaction.Exec(updateEntryQuery, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex, entry.ID, workout.ID)
+		if entry.ID != 0 {
+			keptIDs = append(keptIDs, entry.ID)
+		}
+	}
+
+	_, err = transaction.Exec(`DELETE FROM workout_entries WHERE workout_id = $1 AND NOT (id = ANY($2))`, workout.ID, keptIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	updateEntryQuery := `
+		UPDATE workout_entries
+		SET exercise_name = $1, sets = $2, reps = $3, duration_seconds = $4, weight = $5, notes = $6, order_index = $7,
+			exercise_id = COALESCE($10, resolve_exercise_id($1, (SELECT user_id FROM workouts WHERE id = $9))), distance_meters = $11, elevation_gain_meters = $12,
+			avg_heart_rate = $13, max_heart_rate = $14, updated_at = NOW()
+		WHERE id = $8 AND workout_id = $9
+	`
+
+	for index := range workout.Entries {
+		entry := &workout.Entries[index]
+		entry.OrderIndex = index + 1
+
+		if entry.ID == 0 {
+			err = transaction.QueryRow(
+				insertEntryQuery, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex, entry.ExerciseID,
+				entry.DistanceMeters, entry.ElevationGainMeters, entry.AvgHeartRate, entry.MaxHeartRate,
+			).Scan(&entry.ID, &entry.ExerciseID)
+
+			if err != nil {
+				return nil, exerciseReferenceError(err)
+			}
+
+			err = insertTrackPoints(transaction, entry)
+
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		result, err = transaction.Exec(
+			updateEntryQuery, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex, entry.ID, workout.ID, entry.ExerciseID,
+			entry.DistanceMeters, entry.ElevationGainMeters, entry.AvgHeartRate, entry.MaxHeartRate,
+		)
 
 		if err != nil {
-			return err
+			return nil, exerciseReferenceError(err)
+		}
+
+		rowsAffected, _ = result.RowsAffected()
+
+		if rowsAffected == 0 {
+			return nil, ErrEntryNotFound
+		}
+	}
+
+	exerciseIDs, err := workoutExerciseIDs(transaction, workout.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, exerciseID := range previousExerciseIDs {
+		if !slices.Contains(exerciseIDs, exerciseID) {
+			exerciseIDs = append(exerciseIDs, exerciseID)
 		}
 	}
 
+	newRecords, err := recomputePersonalRecords(transaction, workout.UserID, workout.ID, exerciseIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = setWorkoutTags(transaction, workout)
+
+	if err != nil {
+		return nil, err
+	}
+
 	err = transaction.Commit()
 
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := pg.GetWorkoutByID(workout.ID)
+
+	if err != nil || updated == nil {
+		return updated, err
+	}
+
+	updated.NewRecords = newRecords
+	return updated, nil
+}
+
+// DeleteWorkout moves the workout to the trash and recomputes the personal
+// records it held from the user's remaining workouts. Trashed workouts are
+// left out of every read except GetDeletedWorkouts until they are restored
+// or purged.
+func (pg *PostgresWorkoutStore) DeleteWorkout(id, userID, version int) error {
+	transaction, err := pg.db.Begin()
+
 	if err != nil {
 		return err
 	}
 
-	return nil
+	defer func() { _ = transaction.Rollback() }()
+
+	deleteQuery := `
+		UPDATE workouts
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND user_id = $2 AND version = $3 AND deleted_at IS NULL
+	`
+
+	result, err := transaction.Exec(deleteQuery, id, userID, version)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return pg.missingOrConflict(id, userID)
+	}
+
+	exerciseIDs, err := workoutExerciseIDs(transaction, id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = recomputePersonalRecords(transaction, userID, id, exerciseIDs)
+
+	if err != nil {
+		return err
+	}
+
+	return transaction.Commit()
+}
+
+// RestoreWorkout takes the user's workout out of the trash and returns it
+// with the personal records that it sets again. It returns sql.ErrNoRows
+// when the user has no such workout in the trash, and a nil workout when it
+// was deleted again before it could be read back.
+func (pg *PostgresWorkoutStore) RestoreWorkout(id, userID int) (*Workout, error) {
+	transaction, err := pg.db.Begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = transaction.Rollback() }()
+
+	restoreQuery := `
+		UPDATE workouts
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+	`
+
+	result, err := transaction.Exec(restoreQuery, id, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	exerciseIDs, err := workoutExerciseIDs(transaction, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	newRecords, err := recomputePersonalRecords(transaction, userID, id, exerciseIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = transaction.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := pg.GetWorkoutByID(id)
+
+	if err != nil || restored == nil {
+		return restored, err
+	}
+
+	restored.NewRecords = newRecords
+	return restored, nil
+}
+
+// GetDeletedWorkouts lists the user's trashed workouts, most recently deleted
+// first. Only the pagination of filter applies.
+func (pg *PostgresWorkoutStore) GetDeletedWorkouts(userID int, filter WorkoutFilter) ([]*Workout, Metadata, error) {
+	clause := `FROM workouts WHERE user_id = $1 AND deleted_at IS NOT NULL`
+
+	totalRecords, err := pg.countWorkouts(clause, userID)
+
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		%s
+		ORDER BY deleted_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, workoutColumns, clause)
+
+	workouts, err := pg.queryWorkouts(query, userID, filter.limit(), filter.offset())
+
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = pg.populateEntriesForWorkouts(workouts)
+
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return workouts, calculateMetadata(totalRecords, filter), nil
 }
 
-func (pg *PostgresWorkoutStore) DeleteWorkout(id int) error {
-	deleteQuery := `DELETE FROM workouts WHERE id = $1`
+// PurgeDeletedWorkouts permanently deletes the workouts that were moved to
+// the trash before deletedBefore, along with their entries, and returns how
+// many were deleted. Trashed workouts no longer hold personal records, so
+// none need to be recomputed.
+func (pg *PostgresWorkoutStore) PurgeDeletedWorkouts(deletedBefore time.Time) (int, error) {
+	result, err := pg.db.Exec(`DELETE FROM workouts WHERE deleted_at < $1`, deletedBefore)
+
+	if err != nil {
+		return 0, err
+	}
 
-	_, err := pg.db.Exec(deleteQuery, id)
+	purged, err := result.RowsAffected()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int(purged), nil
+}
+
+// missingOrConflict explains why a versioned write matched no rows: the
+// workout is gone or in the trash (sql.ErrNoRows) or its version moved on (ErrEditConflict).
+func (pg *PostgresWorkoutStore) missingOrConflict(id, userID int) error {
+	var exists bool
+
+	err := pg.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM workouts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`, id, userID).Scan(&exists)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	return ErrEditConflict
 }
 
-func (pg *PostgresWorkoutStore) populateEntriesForWorkout(workout *Workout) error {
-	rows, err := pg.db.Query(`SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index FROM workout_entries WHERE workout_id = $1 ORDER BY order_index`, workout.ID)
+// populateEntriesForWorkouts loads the entries and tags of every given
+// workout in one query each and attaches the entries in order_index order.
+func (pg *PostgresWorkoutStore) populateEntriesForWorkouts(workouts []*Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	err := pg.populateTagsForWorkouts(workouts)
+
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, len(workouts))
+	workoutsByID := make(map[int]*Workout, len(workouts))
+
+	for i, workout := range workouts {
+		ids[i] = workout.ID
+		workoutsByID[workout.ID] = workout
+	}
+
+	query := `
+		SELECT workout_id, id, exercise_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index,
+			distance_meters, elevation_gain_meters, avg_heart_rate, max_heart_rate
+		FROM workout_entries
+		WHERE workout_id = ANY($1)
+		ORDER BY workout_id, order_index
+	`
+
+	rows, err := pg.db.Query(query, ids)
 
 	if err != nil {
 		return err
@@ -220,21 +972,110 @@ func (pg *PostgresWorkoutStore) populateEntriesForWorkout(workout *Workout) erro
 	defer func() { _ = rows.Close() }()
 
 	for rows.Next() {
+		var workoutID int
 		entry := WorkoutEntry{}
-		err = rows.Scan(&entry.ID, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Notes, &entry.OrderIndex)
+		err = rows.Scan(
+			&workoutID, &entry.ID, &entry.ExerciseID, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Notes, &entry.OrderIndex,
+			&entry.DistanceMeters, &entry.ElevationGainMeters, &entry.AvgHeartRate, &entry.MaxHeartRate,
+		)
 
 		if err != nil {
 			return err
 		}
 
+		entry.derivePace()
+		workout := workoutsByID[workoutID]
 		workout.Entries = append(workout.Entries, entry)
 	}
 
+	return rows.Err()
+}
+
+// populateTagsForWorkouts sets the tag names of every given workout, leaving
+// an empty slice on workouts without tags.
+func (pg *PostgresWorkoutStore) populateTagsForWorkouts(workouts []*Workout) error {
+	ids := make([]int, len(workouts))
+	workoutsByID := make(map[int]*Workout, len(workouts))
+
+	for i, workout := range workouts {
+		workout.Tags = []string{}
+		ids[i] = workout.ID
+		workoutsByID[workout.ID] = workout
+	}
+
+	query := `
+		SELECT wt.workout_id, t.name
+		FROM workout_tags wt
+		JOIN tags t ON t.id = wt.tag_id
+		WHERE wt.workout_id = ANY($1)
+		ORDER BY t.name
+	`
+
+	rows, err := pg.db.Query(query, ids)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var workoutID int
+		var name string
+		err = rows.Scan(&workoutID, &name)
+
+		if err != nil {
+			return err
+		}
+
+		workout := workoutsByID[workoutID]
+		workout.Tags = append(workout.Tags, name)
+	}
+
+	return rows.Err()
+}
+
+// setWorkoutTags replaces the workout's tags with workout.Tags, creating the
+// user's tags that do not exist yet. Tags left without workouts are kept so
+// that they can still be renamed or reused.
+func setWorkoutTags(transaction *sql.Tx, workout *Workout) error {
+	if workout.Tags == nil {
+		workout.Tags = []string{}
+	}
+
+	names := textArray(workout.Tags)
+
+	_, err := transaction.Exec(`
+		INSERT INTO tags (user_id, name)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (user_id, name) DO NOTHING
+	`, workout.UserID, names)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = transaction.Exec(`DELETE FROM workout_tags WHERE workout_id = $1`, workout.ID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = transaction.Exec(`
+		INSERT INTO workout_tags (workout_id, tag_id)
+		SELECT $1, id FROM tags WHERE user_id = $2 AND name = ANY($3)
+	`, workout.ID, workout.UserID, names)
+
+	if err != nil {
+		return err
+	}
+
+	slices.Sort(workout.Tags)
 	return nil
 }
 
 func (pg *PostgresWorkoutStore) GetWorkoutOwnerID(workoutID int) (int, error) {
-	query := `SELECT user_id FROM workouts WHERE id = $1`
+	query := `SELECT user_id FROM workouts WHERE id = $1 AND deleted_at IS NULL`
 
 	var userID int
 	err := pg.db.QueryRow(query, workoutID).Scan(&userID)
@@ -245,3 +1086,84 @@ func (pg *PostgresWorkoutStore) GetWorkoutOwnerID(workoutID int) (int, error) {
 
 	return userID, nil
 }
+
+// insertTrackPoints stores the entry's route with one statement, since
+// recordings typically hold thousands of points.
+func insertTrackPoints(transaction *sql.Tx, entry *WorkoutEntry) error {
+	if len(entry.TrackPoints) == 0 {
+		return nil
+	}
+
+	recordedAt := make([]*time.Time, len(entry.TrackPoints))
+	latitudes := make([]*float64, len(entry.TrackPoints))
+	longitudes := make([]*float64, len(entry.TrackPoints))
+	elevations := make([]*float64, len(entry.TrackPoints))
+	heartRates := make([]*int32, len(entry.TrackPoints))
+
+	for i, point := range entry.TrackPoints {
+		recordedAt[i] = point.RecordedAt
+		latitudes[i] = point.Latitude
+		longitudes[i] = point.Longitude
+		elevations[i] = point.ElevationMeters
+
+		if point.HeartRate != nil {
+			heartRate := int32(*point.HeartRate)
+			heartRates[i] = &heartRate
+		}
+	}
+
+	arrays := []pgtype.ValueTranscoder{&pgtype.TimestamptzArray{}, &pgtype.Float8Array{}, &pgtype.Float8Array{}, &pgtype.Float8Array{}, &pgtype.Int4Array{}}
+
+	for i, values := range []interface{}{recordedAt, latitudes, longitudes, elevations, heartRates} {
+		err := arrays[i].Set(values)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO track_points (workout_entry_id, sequence, recorded_at, latitude, longitude, elevation_meters, heart_rate)
+		SELECT $1, point.ordinality, point.recorded_at, point.latitude, point.longitude, point.elevation_meters, point.heart_rate
+		FROM unnest($2::timestamptz[], $3::float8[], $4::float8[], $5::float8[], $6::int[])
+			WITH ORDINALITY AS point (recorded_at, latitude, longitude, elevation_meters, heart_rate, ordinality)
+	`
+
+	_, err := transaction.Exec(query, entry.ID, arrays[0], arrays[1], arrays[2], arrays[3], arrays[4])
+	return err
+}
+
+// GetTrackPoints returns the routes of all of the workout's entries in
+// recording order.
+func (pg *PostgresWorkoutStore) GetTrackPoints(workoutID int) ([]TrackPoint, error) {
+	points := []TrackPoint{}
+
+	query := `
+		SELECT tp.workout_entry_id, tp.recorded_at, tp.latitude, tp.longitude, tp.elevation_meters, tp.heart_rate
+		FROM track_points tp
+		INNER JOIN workout_entries we ON we.id = tp.workout_entry_id
+		WHERE we.workout_id = $1
+		ORDER BY we.order_index, tp.sequence
+	`
+
+	rows, err := pg.db.Query(query, workoutID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		point := TrackPoint{}
+		err = rows.Scan(&point.EntryID, &point.RecordedAt, &point.Latitude, &point.Longitude, &point.ElevationMeters, &point.HeartRate)
+
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
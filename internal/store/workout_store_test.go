@@ -2,29 +2,40 @@ package store
 
 import (
 	"database/sql"
+	"fmt"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func setupTestDB(t *testing.T) *sql.DB {
+func setupTestDB(t testing.TB) *sql.DB {
 	db, err := sql.Open("pgx", "host=localhost port=5433 user=postgres password=postgres dbname=postgres sslmode=disable")
 
 	if err != nil {
 		t.Fatalf("failed to connect to database: %v", err)
 	}
-	_, err = db.Exec("TRUNCATE TABLE workout_entries, workouts, users RESTART IDENTITY CASCADE")
+
+	err = Migrate(db, "./../../migrations")
 
 	if err != nil {
-		t.Fatalf("failed to truncate tables: %v", err)
+		t.Fatalf("failed to run migrations: %v", err)
 	}
 
-	err = Migrate(db, "./../../migrations")
+	// Truncating users would cascade into exercises through created_by and
+	// wipe the seeded catalog, which goose does not seed again. Every other
+	// table referencing users is truncated, and users are deleted instead.
+	_, err = db.Exec(`
+		TRUNCATE TABLE workout_entries, workouts, tokens, personal_records, workout_templates, programs, tags RESTART IDENTITY CASCADE;
+		DELETE FROM exercises WHERE created_by IS NOT NULL;
+		DELETE FROM users;
+		ALTER SEQUENCE users_id_seq RESTART;
+	`)
 
 	if err != nil {
-		t.Fatalf("failed to run migrations: %v", err)
+		t.Fatalf("failed to truncate tables: %v", err)
 	}
 
 	return db
@@ -130,6 +141,214 @@ func TestCreateWorkout(t *testing.T) {
 	}
 }
 
+func TestWorkoutInheritTimes(t *testing.T) {
+	performedAt := time.Date(2025, 3, 3, 18, 0, 0, 0, time.UTC)
+	startedAt := performedAt
+	endedAt := performedAt.Add(time.Hour)
+	laterEnd := endedAt.Add(15 * time.Minute)
+
+	stored := &Workout{PerformedAt: performedAt, StartedAt: &startedAt, EndedAt: &endedAt, DurationMinutes: 60}
+
+	tests := []struct {
+		name         string
+		update       Workout
+		wantDuration int
+	}{
+		{"unchanged times keep the duration", Workout{StartedAt: &startedAt, EndedAt: &endedAt, DurationMinutes: 60}, 60},
+		{"moved end derives the duration", Workout{StartedAt: &startedAt, EndedAt: &laterEnd, DurationMinutes: 60}, 75},
+		{"explicit duration is kept", Workout{StartedAt: &startedAt, EndedAt: &laterEnd, DurationMinutes: 70}, 70},
+		{"removed times keep the duration", Workout{DurationMinutes: 60}, 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update := tt.update
+			update.InheritTimes(stored)
+
+			assert.Equal(t, performedAt, update.PerformedAt)
+			assert.Equal(t, tt.wantDuration, update.DurationMinutes)
+		})
+	}
+
+	moved := Workout{PerformedAt: performedAt.AddDate(0, 0, -1)}
+	moved.InheritTimes(stored)
+	assert.Equal(t, performedAt.AddDate(0, 0, -1), moved.PerformedAt)
+}
+
+func TestUpdateWorkoutReplacesEntries(t *testing.T) {
+	db := setupTestDB(t)
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	user := &User{Username: "updater", Email: "updater@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("password"))
+	require.NoError(t, NewPostgresUserStore(db).CreateUser(user))
+
+	store := NewPostgresWorkoutStore(db)
+
+	created, err := store.CreateWorkout(&Workout{
+		Title:           "pull day",
+		UserID:          user.ID,
+		DurationMinutes: 45,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Deadlift", Sets: 3, Reps: IntPtr(5), OrderIndex: 1},
+			{ExerciseName: "Row", Sets: 3, Reps: IntPtr(10), OrderIndex: 2},
+		},
+	})
+	require.NoError(t, err)
+
+	deadlift := created.Entries[0]
+	deadlift.Sets = 5
+
+	updated, err := store.UpdateWorkout(&Workout{
+		ID:              created.ID,
+		Title:           "pull day",
+		UserID:          user.ID,
+		DurationMinutes: 50,
+		Version:         created.Version,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Pull Up", Sets: 3, Reps: IntPtr(8)},
+			deadlift,
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, updated.Entries, 2)
+
+	assert.Equal(t, "Pull Up", updated.Entries[0].ExerciseName)
+	assert.NotZero(t, updated.Entries[0].ID)
+	assert.Equal(t, 1, updated.Entries[0].OrderIndex)
+	assert.Equal(t, deadlift.ID, updated.Entries[1].ID)
+	assert.Equal(t, 5, updated.Entries[1].Sets)
+	assert.Equal(t, 2, updated.Entries[1].OrderIndex)
+	assert.Equal(t, created.Version+1, updated.Version)
+
+	_, err = store.UpdateWorkout(&Workout{
+		ID:              created.ID,
+		Title:           "pull day",
+		UserID:          user.ID,
+		DurationMinutes: 50,
+		Version:         created.Version,
+	})
+	assert.ErrorIs(t, err, ErrEditConflict)
+
+	_, err = store.UpdateWorkout(&Workout{
+		ID:              created.ID,
+		Title:           "pull day",
+		UserID:          user.ID,
+		DurationMinutes: 50,
+		Version:         updated.Version,
+		Entries:         []WorkoutEntry{{ID: 999999, ExerciseName: "Ghost", Sets: 1, Reps: IntPtr(1)}},
+	})
+	assert.ErrorIs(t, err, ErrEntryNotFound)
+}
+
+func TestCreateWorkoutsAndExport(t *testing.T) {
+	db := setupTestDB(t)
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	user := &User{Username: "exporter", Email: "exporter@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("password"))
+	require.NoError(t, NewPostgresUserStore(db).CreateUser(user))
+
+	store := NewPostgresWorkoutStore(db)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	workouts := make([]*Workout, exportPageSize+1)
+
+	for i := range workouts {
+		workouts[i] = &Workout{
+			Title:       fmt.Sprintf("workout %d", i),
+			UserID:      user.ID,
+			PerformedAt: start.AddDate(0, 0, len(workouts)-i),
+			Entries:     []WorkoutEntry{{ExerciseName: "Bench Press", Sets: 1, Reps: IntPtr(i + 1), OrderIndex: 1}},
+		}
+	}
+
+	require.NoError(t, store.CreateWorkouts(workouts))
+
+	// A failing workout rolls back the whole batch.
+	err := store.CreateWorkouts([]*Workout{
+		{Title: "kept?", UserID: user.ID},
+		{Title: "broken", UserID: user.ID, Entries: []WorkoutEntry{{ExerciseName: "Plank", Sets: 1}}},
+	})
+	require.Error(t, err)
+
+	exported := []*Workout{}
+	err = store.ExportWorkouts(user.ID, func(workout *Workout) error {
+		exported = append(exported, workout)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, exported, len(workouts))
+
+	assert.Equal(t, workouts[len(workouts)-1].ID, exported[0].ID)
+	assert.Equal(t, workouts[0].ID, exported[len(exported)-1].ID)
+	require.Len(t, exported[0].Entries, 1)
+	assert.Equal(t, len(workouts), *exported[0].Entries[0].Reps)
+}
+
+func TestCardioEntryAndTrackPoints(t *testing.T) {
+	db := setupTestDB(t)
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	user := &User{Username: "runner", Email: "runner@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("password"))
+	require.NoError(t, NewPostgresUserStore(db).CreateUser(user))
+
+	store := NewPostgresWorkoutStore(db)
+	start := time.Date(2025, 6, 1, 6, 0, 0, 0, time.UTC)
+	later := start.Add(10 * time.Second)
+
+	workout, err := store.CreateWorkout(&Workout{
+		Title:       "Morning Run",
+		UserID:      user.ID,
+		PerformedAt: start,
+		Entries: []WorkoutEntry{{
+			ExerciseName:        "Running",
+			Sets:                1,
+			DurationSeconds:     IntPtr(1500),
+			DistanceMeters:      FloatPtr(5000),
+			ElevationGainMeters: FloatPtr(42.5),
+			AvgHeartRate:        IntPtr(150),
+			MaxHeartRate:        IntPtr(175),
+			OrderIndex:          1,
+			TrackPoints: []TrackPoint{
+				{RecordedAt: &start, Latitude: FloatPtr(45), Longitude: FloatPtr(19), HeartRate: IntPtr(120)},
+				{RecordedAt: &later, ElevationMeters: FloatPtr(80)},
+			},
+		}},
+	})
+	require.NoError(t, err)
+
+	fetched, err := store.GetWorkoutByID(workout.ID)
+	require.NoError(t, err)
+	require.Len(t, fetched.Entries, 1)
+
+	entry := fetched.Entries[0]
+	assert.Equal(t, 5000.0, *entry.DistanceMeters)
+	assert.Equal(t, 42.5, *entry.ElevationGainMeters)
+	assert.Equal(t, 175, *entry.MaxHeartRate)
+	assert.Equal(t, 300.0, *entry.PaceSecondsPerKm)
+	assert.Empty(t, entry.TrackPoints)
+
+	points, err := store.GetTrackPoints(workout.ID)
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, entry.ID, points[0].EntryID)
+	assert.Equal(t, 45.0, *points[0].Latitude)
+	assert.Nil(t, points[0].ElevationMeters)
+	assert.True(t, later.Equal(*points[1].RecordedAt))
+	assert.Nil(t, points[1].Latitude)
+	assert.Equal(t, 80.0, *points[1].ElevationMeters)
+}
+
 func IntPtr(i int) *int {
 	return &i
 }
@@ -137,3 +356,387 @@ func IntPtr(i int) *int {
 func FloatPtr(f float64) *float64 {
 	return &f
 }
+
+func seedBenchmarkWorkouts(b *testing.B, db *sql.DB, workouts, entriesPerWorkout int) int {
+	user := &User{Username: "bench", Email: "bench@example.com", Activated: true}
+	require.NoError(b, user.PasswordHash.Set("bench-password"))
+	require.NoError(b, NewPostgresUserStore(db).CreateUser(user))
+
+	_, err := db.Exec(`
+		INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
+		SELECT $1, 'workout ' || g, 'benchmark', 60, 300
+		FROM generate_series(1, $2) g
+	`, user.ID, workouts)
+	require.NoError(b, err)
+
+	_, err = db.Exec(`
+		INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, weight, notes, order_index)
+		SELECT w.id, 'exercise ' || e, 3, 10, 100, '', e
+		FROM workouts w CROSS JOIN generate_series(1, $1) e
+	`, entriesPerWorkout)
+	require.NoError(b, err)
+
+	return user.ID
+}
+
+// getAllWorkoutsNPlusOne loads workouts the way GetAllWorkouts used to: one
+// extra entries query per workout while the outer cursor is still open.
+func getAllWorkoutsNPlusOne(db *sql.DB, userID int) ([]*Workout, error) {
+	var workouts []*Workout
+
+	rows, err := db.Query(`SELECT id, title, description, duration_minutes, calories_burned, user_id FROM workouts WHERE user_id = $1 ORDER BY id`, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		workout := &Workout{}
+		err = rows.Scan(&workout.ID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.UserID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entryRows, err := db.Query(`SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index FROM workout_entries WHERE workout_id = $1 ORDER BY order_index`, workout.ID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for entryRows.Next() {
+			entry := WorkoutEntry{}
+			err = entryRows.Scan(&entry.ID, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Notes, &entry.OrderIndex)
+
+			if err != nil {
+				_ = entryRows.Close()
+				return nil, err
+			}
+
+			workout.Entries = append(workout.Entries, entry)
+		}
+
+		_ = entryRows.Close()
+		workouts = append(workouts, workout)
+	}
+
+	return workouts, rows.Err()
+}
+
+func BenchmarkGetAllWorkouts(b *testing.B) {
+	for _, size := range []int{1_000, 10_000} {
+		db := setupTestDB(b)
+		userID := seedBenchmarkWorkouts(b, db, size, 5)
+		store := NewPostgresWorkoutStore(db)
+		filter := WorkoutFilter{Page: 1, PageSize: size, Sort: "id"}
+
+		b.Run(fmt.Sprintf("n+1/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				workouts, err := getAllWorkoutsNPlusOne(db, userID)
+				require.NoError(b, err)
+				require.Len(b, workouts, size)
+			}
+		})
+
+		b.Run(fmt.Sprintf("batched/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				workouts, _, err := store.GetAllWorkouts(userID, filter)
+				require.NoError(b, err)
+				require.Len(b, workouts, size)
+			}
+		})
+
+		_ = db.Close()
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	snippet := highlightSnippet("my " + snippetStart + "shoulder" + snippetStop + ` <script>alert("x")</script> & more`)
+	assert.Equal(t, `my <b>shoulder</b> &lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; more`, snippet)
+}
+
+func TestSearchWorkouts(t *testing.T) {
+	db := setupTestDB(t)
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	user := &User{Username: "searcher", Email: "searcher@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("password"))
+	require.NoError(t, NewPostgresUserStore(db).CreateUser(user))
+
+	store := NewPostgresWorkoutStore(db)
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	push, err := store.CreateWorkout(&Workout{
+		Title:       "Push",
+		UserID:      user.ID,
+		PerformedAt: start,
+		Entries:     []WorkoutEntry{{ExerciseName: "Bench Press", Sets: 1, Reps: IntPtr(5), Notes: "my shoulder hurt on the last set", OrderIndex: 1}},
+	})
+	require.NoError(t, err)
+
+	_, err = store.CreateWorkout(&Workout{Title: "Shoulder day", UserID: user.ID, PerformedAt: start.AddDate(0, 0, 1)})
+	require.NoError(t, err)
+
+	_, err = store.CreateWorkout(&Workout{Title: "Pull", Description: "back and biceps", UserID: user.ID, PerformedAt: start.AddDate(0, 0, 2)})
+	require.NoError(t, err)
+
+	filter := WorkoutFilter{Page: 1, PageSize: 20}
+	results, metadata, err := store.SearchWorkouts(user.ID, "shoulders hurting", filter)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, push.ID, results[0].Workout.ID)
+	assert.Contains(t, results[0].Snippet, "<b>shoulder</b> <b>hurt</b>")
+	require.Len(t, results[0].Workout.Entries, 1)
+	assert.Equal(t, 1, metadata.TotalRecords)
+
+	_, err = store.CreateWorkout(&Workout{Title: `Legs <img src=x onerror="alert(1)">`, UserID: user.ID, PerformedAt: start})
+	require.NoError(t, err)
+
+	results, _, err = store.SearchWorkouts(user.ID, "legs", filter)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Contains(t, results[0].Snippet, "<b>Legs</b> &lt;img")
+	assert.NotContains(t, results[0].Snippet, "<img")
+
+	// Title matches outrank note matches.
+	results, _, err = store.SearchWorkouts(user.ID, "shoulder", filter)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "Shoulder day", results[0].Workout.Title)
+	assert.Greater(t, results[0].Rank, results[1].Rank)
+
+	// Entry changes are picked up by the trigger.
+	push.Entries[0].Notes = "felt fine"
+	_, err = store.UpdateWorkout(push)
+	require.NoError(t, err)
+
+	results, _, err = store.SearchWorkouts(user.ID, `"shoulder hurt"`, filter)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	results, _, err = store.SearchWorkouts(user.ID, "bench -biceps", filter)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, push.ID, results[0].Workout.ID)
+}
+
+func TestTagsAndFiltering(t *testing.T) {
+	db := setupTestDB(t)
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	user := &User{Username: "tagger", Email: "tagger@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("password"))
+	require.NoError(t, NewPostgresUserStore(db).CreateUser(user))
+
+	store := NewPostgresWorkoutStore(db)
+	tagStore := NewPostgresTagStore(db)
+
+	squats, err := store.CreateWorkout(&Workout{Title: "squats", UserID: user.ID, Tags: []string{"deload", "competition prep"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"competition prep", "deload"}, squats.Tags)
+
+	_, err = store.CreateWorkout(&Workout{Title: "bench", UserID: user.ID, Tags: []string{"competition prep"}})
+	require.NoError(t, err)
+
+	_, err = store.CreateWorkout(&Workout{Title: "hotel gym", UserID: user.ID, Tags: []string{"travel"}})
+	require.NoError(t, err)
+
+	titles := func(filter WorkoutFilter) []string {
+		filter.Page, filter.PageSize, filter.Sort = 1, 20, "id"
+		workouts, _, err := store.GetAllWorkouts(user.ID, filter)
+		require.NoError(t, err)
+
+		names := []string{}
+
+		for _, workout := range workouts {
+			names = append(names, workout.Title)
+		}
+
+		return names
+	}
+
+	assert.Equal(t, []string{"squats", "bench", "hotel gym"}, titles(WorkoutFilter{}))
+	assert.Equal(t, []string{"hotel gym"}, titles(WorkoutFilter{Title: "L G"}))
+	assert.Empty(t, titles(WorkoutFilter{Title: "s%s"}))
+	assert.Empty(t, titles(WorkoutFilter{Title: "b_nch"}))
+	assert.Equal(t, []string{"squats", "hotel gym"}, titles(WorkoutFilter{Tags: []string{"deload", "travel"}}))
+	assert.Equal(t, []string{"squats"}, titles(WorkoutFilter{Tags: []string{"deload", "competition prep"}, TagMatchAll: true}))
+
+	tags, err := tagStore.GetTagsForUser(user.ID)
+	require.NoError(t, err)
+	require.Len(t, tags, 3)
+	assert.Equal(t, "competition prep", tags[0].Name)
+	assert.Equal(t, 2, tags[0].WorkoutCount)
+
+	ids := map[string]int{}
+
+	for _, tag := range tags {
+		ids[tag.Name] = tag.ID
+	}
+
+	assert.ErrorIs(t, tagStore.RenameTag(ids["travel"], user.ID, "deload"), ErrDuplicateTag)
+	require.NoError(t, tagStore.RenameTag(ids["travel"], user.ID, "on the road"))
+	assert.Equal(t, []string{"hotel gym"}, titles(WorkoutFilter{Tags: []string{"on the road"}}))
+
+	// Merging bumps the version of the affected workouts so their ETags change.
+	require.NoError(t, tagStore.MergeTags(ids["deload"], ids["competition prep"], user.ID))
+
+	merged, err := store.GetWorkoutByID(squats.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"competition prep"}, merged.Tags)
+	assert.Equal(t, squats.Version+1, merged.Version)
+
+	tag, err := tagStore.GetTagByID(ids["deload"])
+	require.NoError(t, err)
+	assert.Nil(t, tag)
+
+	// Updating a workout replaces its tags.
+	merged.Tags = []string{"travel"}
+	updated, err := store.UpdateWorkout(merged)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"travel"}, updated.Tags)
+
+	require.NoError(t, tagStore.DeleteTag(ids["competition prep"], user.ID))
+	assert.Empty(t, titles(WorkoutFilter{Tags: []string{"competition prep"}}))
+	assert.Len(t, titles(WorkoutFilter{}), 3)
+}
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	db := setupTestDB(t)
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	user := &User{Username: "trasher", Email: "trasher@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("password"))
+	require.NoError(t, NewPostgresUserStore(db).CreateUser(user))
+
+	store := NewPostgresWorkoutStore(db)
+	filter := WorkoutFilter{Page: 1, PageSize: 20, Sort: "id"}
+
+	kept, err := store.CreateWorkout(&Workout{Title: "kept", UserID: user.ID, Tags: []string{"travel"}})
+	require.NoError(t, err)
+
+	trashed, err := store.CreateWorkout(&Workout{
+		Title:   "trashed",
+		UserID:  user.ID,
+		Tags:    []string{"travel"},
+		Entries: []WorkoutEntry{{ExerciseName: "Bench Press", Sets: 1, Reps: IntPtr(5), OrderIndex: 1}},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, store.DeleteWorkout(trashed.ID, user.ID, trashed.Version))
+	assert.ErrorIs(t, store.DeleteWorkout(trashed.ID, user.ID, trashed.Version+1), sql.ErrNoRows)
+
+	workout, err := store.GetWorkoutByID(trashed.ID)
+	require.NoError(t, err)
+	assert.Nil(t, workout)
+
+	workouts, metadata, err := store.GetAllWorkouts(user.ID, filter)
+	require.NoError(t, err)
+	require.Len(t, workouts, 1)
+	assert.Equal(t, kept.ID, workouts[0].ID)
+	assert.Equal(t, 1, metadata.TotalRecords)
+
+	results, _, err := store.SearchWorkouts(user.ID, "trashed", filter)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	tags, err := NewPostgresTagStore(db).GetTagsForUser(user.ID)
+	require.NoError(t, err)
+	require.Len(t, tags, 1)
+	assert.Equal(t, 1, tags[0].WorkoutCount)
+
+	deleted, _, err := store.GetDeletedWorkouts(user.ID, filter)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, trashed.ID, deleted[0].ID)
+	assert.NotNil(t, deleted[0].DeletedAt)
+	assert.Len(t, deleted[0].Entries, 1)
+
+	restored, err := store.RestoreWorkout(trashed.ID, user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, trashed.Version+2, restored.Version)
+
+	_, err = store.RestoreWorkout(trashed.ID, user.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Only workouts trashed before the cutoff are purged.
+	require.NoError(t, store.DeleteWorkout(restored.ID, user.ID, restored.Version))
+
+	purged, err := store.PurgeDeletedWorkouts(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged)
+
+	purged, err = store.PurgeDeletedWorkouts(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	deleted, _, err = store.GetDeletedWorkouts(user.ID, filter)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	_, err = store.RestoreWorkout(trashed.ID, user.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestGetAllWorkoutsPagesAndCursors(t *testing.T) {
+	db := setupTestDB(t)
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	user := &User{Username: "pager", Email: "pager@example.com", Activated: true}
+	require.NoError(t, user.PasswordHash.Set("password"))
+	require.NoError(t, NewPostgresUserStore(db).CreateUser(user))
+
+	store := NewPostgresWorkoutStore(db)
+
+	for _, title := range []string{"bench", "squats", "deadlift", "squats", "rows"} {
+		_, err := store.CreateWorkout(&Workout{Title: title, UserID: user.ID})
+		require.NoError(t, err)
+	}
+
+	// A page past the end still reports how many workouts there are.
+	workouts, metadata, err := store.GetAllWorkouts(user.ID, WorkoutFilter{Page: 9, PageSize: 2, Sort: "title"})
+	require.NoError(t, err)
+	assert.Empty(t, workouts)
+	assert.Equal(t, 5, metadata.TotalRecords)
+	assert.Equal(t, 3, metadata.LastPage)
+
+	filter := WorkoutFilter{Page: 1, PageSize: 2, Sort: "-title"}
+	titles := []string{}
+
+	for {
+		workouts, metadata, err = store.GetAllWorkouts(user.ID, filter)
+		require.NoError(t, err)
+		assert.Equal(t, 5, metadata.TotalRecords)
+
+		for _, workout := range workouts {
+			titles = append(titles, workout.Title)
+		}
+
+		if metadata.NextCursor == "" {
+			break
+		}
+
+		filter.After, err = DecodeCursor(metadata.NextCursor, filter.Sort)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"squats", "squats", "rows", "deadlift", "bench"}, titles)
+
+	_, err = DecodeCursor(NewCursor(workouts[0], "-title").Encode(), "title")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
@@ -4,26 +4,53 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
+	"encoding/hex"
 	"time"
 )
 
 const (
-	ScopeAuth = "auth"
+	ScopeAuth          = "auth"
+	ScopeRefresh       = "refresh"
+	ScopePasswordReset = "password-reset"
+	ScopeActivation    = "activation"
+	ScopeCalendar      = "calendar"
 )
 
+const (
+	AuthTTL          = 24 * time.Hour
+	RefreshTTL       = 30 * 24 * time.Hour
+	PasswordResetTTL = 45 * time.Minute
+	ActivationTTL    = 3 * 24 * time.Hour
+	// CalendarTTL is long because calendar apps poll a feed URL for as long
+	// as the subscription exists; feed tokens are meant to be revoked instead.
+	CalendarTTL = 10 * 365 * 24 * time.Hour
+)
+
+// Token is a credential stored under the hash of its plaintext. SessionID is
+// shared by an auth token and the refresh token issued with it, and carried
+// over when the refresh token is rotated.
 type Token struct {
-	Plaintext string    `json:"token"`
-	Hash      []byte    `json:"-"`
-	UserID    int       `json:"-"`
-	Expiry    time.Time `json:"expiry"`
-	Scope     string    `json:"scope"`
+	Plaintext  string     `json:"token"`
+	Hash       []byte     `json:"-"`
+	UserID     int        `json:"-"`
+	Expiry     time.Time  `json:"expiry"`
+	Scope      string     `json:"scope"`
+	RotatedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"-"`
+	LastUsedAt *time.Time `json:"-"`
+	UserAgent  string     `json:"-"`
+	IP         string     `json:"-"`
+	SessionID  string     `json:"-"`
 }
 
 func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
+	now := time.Now()
+
 	token := &Token{
-		UserID: userID,
-		Expiry: time.Now().Add(ttl),
-		Scope:  scope,
+		UserID:    userID,
+		Expiry:    now.Add(ttl),
+		Scope:     scope,
+		CreatedAt: now,
 	}
 
 	emptyBytes := make([]byte, 32)
@@ -35,9 +62,23 @@ func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error)
 	}
 
 	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(emptyBytes)
-	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = Hash(token.Plaintext)
+
+	sessionBytes := make([]byte, 16)
+
+	_, err = rand.Read(sessionBytes)
 
-	token.Hash = hash[:]
+	if err != nil {
+		return nil, err
+	}
+
+	token.SessionID = hex.EncodeToString(sessionBytes)
 
 	return token, nil
 }
+
+// Hash returns the SHA-256 digest under which a plaintext token is stored.
+func Hash(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
@@ -2,9 +2,11 @@ package utils
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -29,17 +31,99 @@ func WriteJson(w http.ResponseWriter, status int, data Envelope) error {
 }
 
 func ReadIDParam(r *http.Request) (int, error) {
-	idParam := chi.URLParam(r, "id")
+	return ReadIntParam(r, "id")
+}
+
+// ReadIntParam reads a positive integer URL parameter such as {sessionID}.
+func ReadIntParam(r *http.Request, name string) (int, error) {
+	param := chi.URLParam(r, name)
 
-	if idParam == "" {
-		return 0, errors.New("missing id parameter")
+	if param == "" {
+		return 0, fmt.Errorf("missing %s parameter", name)
 	}
 
-	id, err := strconv.Atoi(idParam)
+	id, err := strconv.Atoi(param)
 
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
 }
+
+func ReadString(qs url.Values, key string, defaultValue string) string {
+	value := qs.Get(key)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
+func ReadInt(qs url.Values, key string, defaultValue int) (int, error) {
+	value := qs.Get(key)
+
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", key)
+	}
+
+	return i, nil
+}
+
+func ReadBool(qs url.Values, key string, defaultValue bool) (bool, error) {
+	value := qs.Get(key)
+
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", key)
+	}
+
+	return b, nil
+}
+
+// ReadOptionalInt returns nil when key is absent from the query string.
+func ReadOptionalInt(qs url.Values, key string) (*int, error) {
+	if qs.Get(key) == "" {
+		return nil, nil
+	}
+
+	i, err := ReadInt(qs, key, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+// ReadOptionalTime accepts either an RFC 3339 timestamp or a YYYY-MM-DD date
+// and returns nil when key is absent from the query string.
+func ReadOptionalTime(qs url.Values, key string) (*time.Time, error) {
+	value := qs.Get(key)
+
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		t, err := time.Parse(layout, value)
+
+		if err == nil {
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD) or an RFC 3339 timestamp", key)
+}
@@ -23,7 +23,7 @@ func main() {
 
 	r := routes.SetupRoutes(application)
 
-	defer func() { _ = application.DB.Close() }()
+	defer func() { _ = application.Close() }()
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
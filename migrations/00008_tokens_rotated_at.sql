@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tokens ADD COLUMN rotated_at TIMESTAMP(0) WITH TIME ZONE;
+CREATE INDEX idx_tokens_user_id_scope ON tokens(user_id, scope);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_tokens_user_id_scope;
+ALTER TABLE tokens DROP COLUMN rotated_at;
+-- +goose StatementEnd
\ No newline at end of file
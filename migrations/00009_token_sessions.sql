@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tokens ADD COLUMN created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE tokens ADD COLUMN last_used_at TIMESTAMP(0) WITH TIME ZONE;
+ALTER TABLE tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tokens DROP COLUMN ip;
+ALTER TABLE tokens DROP COLUMN user_agent;
+ALTER TABLE tokens DROP COLUMN last_used_at;
+ALTER TABLE tokens DROP COLUMN created_at;
+-- +goose StatementEnd
\ No newline at end of file
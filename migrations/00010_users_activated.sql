@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN activated BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET activated = TRUE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN activated;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN performed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE workouts ADD COLUMN started_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE workouts ADD COLUMN ended_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE workouts ADD CONSTRAINT valid_workout_times CHECK (started_at IS NULL OR ended_at IS NULL OR ended_at >= started_at);
+UPDATE workouts SET performed_at = created_at WHERE created_at IS NOT NULL;
+CREATE INDEX idx_workouts_user_id_performed_at ON workouts(user_id, performed_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_workouts_user_id_performed_at;
+ALTER TABLE workouts DROP CONSTRAINT valid_workout_times;
+ALTER TABLE workouts DROP COLUMN ended_at;
+ALTER TABLE workouts DROP COLUMN started_at;
+ALTER TABLE workouts DROP COLUMN performed_at;
+-- +goose StatementEnd
\ No newline at end of file
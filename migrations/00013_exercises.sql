@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE TABLE IF NOT EXISTS exercises
+(
+    id                      SERIAL PRIMARY KEY,
+    name                    VARCHAR NOT NULL,
+    aliases                 TEXT[]  NOT NULL DEFAULT '{}',
+    category                VARCHAR NOT NULL,
+    primary_muscle_groups   TEXT[]  NOT NULL DEFAULT '{}',
+    secondary_muscle_groups TEXT[]  NOT NULL DEFAULT '{}',
+    equipment               VARCHAR NOT NULL DEFAULT '',
+    created_at              TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at              TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_exercises_name ON exercises (LOWER(name));
+CREATE INDEX idx_exercises_name_trgm ON exercises USING GIN (name gin_trgm_ops);
+
+-- resolve_exercise_id maps a free-text exercise name onto the catalog by
+-- case-insensitive name or alias match, returning NULL when nothing matches.
+CREATE OR REPLACE FUNCTION resolve_exercise_id(exercise_name VARCHAR) RETURNS INT AS $$
+    SELECT id
+    FROM exercises
+    WHERE LOWER(name) = LOWER(TRIM(exercise_name))
+       OR EXISTS (SELECT 1 FROM unnest(aliases) alias WHERE LOWER(alias) = LOWER(TRIM(exercise_name)))
+    ORDER BY LOWER(name) = LOWER(TRIM(exercise_name)) DESC, id
+    LIMIT 1
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS resolve_exercise_id(VARCHAR);
+DROP TABLE IF EXISTS exercises;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO exercises (name, aliases, category, primary_muscle_groups, secondary_muscle_groups, equipment)
+VALUES
+    ('Bench Press', '{"Bench","BP","Barbell Bench Press","Flat Bench","Flat Bench Press"}', 'strength', '{"chest"}', '{"triceps","shoulders"}', 'barbell'),
+    ('Incline Bench Press', '{"Incline BP","Incline Barbell Press"}', 'strength', '{"chest"}', '{"shoulders","triceps"}', 'barbell'),
+    ('Dumbbell Bench Press', '{"DB Bench","DB Bench Press"}', 'strength', '{"chest"}', '{"triceps","shoulders"}', 'dumbbell'),
+    ('Overhead Press', '{"OHP","Military Press","Shoulder Press","Standing Press"}', 'strength', '{"shoulders"}', '{"triceps"}', 'barbell'),
+    ('Back Squat', '{"Squat","Squats","Barbell Squat","High Bar Squat","Low Bar Squat"}', 'strength', '{"quadriceps","glutes"}', '{"hamstrings","lower back"}', 'barbell'),
+    ('Front Squat', '{"Front Squats"}', 'strength', '{"quadriceps"}', '{"glutes","upper back"}', 'barbell'),
+    ('Deadlift', '{"DL","Conventional Deadlift","Deadlifts"}', 'strength', '{"hamstrings","glutes","lower back"}', '{"forearms","upper back"}', 'barbell'),
+    ('Romanian Deadlift', '{"RDL","Stiff Leg Deadlift"}', 'strength', '{"hamstrings"}', '{"glutes","lower back"}', 'barbell'),
+    ('Sumo Deadlift', '{"Sumo DL"}', 'strength', '{"glutes","hamstrings"}', '{"quadriceps","adductors"}', 'barbell'),
+    ('Barbell Row', '{"Bent Over Row","BB Row","Pendlay Row"}', 'strength', '{"upper back","lats"}', '{"biceps","lower back"}', 'barbell'),
+    ('Dumbbell Row', '{"DB Row","One Arm Row"}', 'strength', '{"lats","upper back"}', '{"biceps"}', 'dumbbell'),
+    ('Pull Up', '{"Pull-Up","Pullup","Pull Ups","Pull-Ups"}', 'strength', '{"lats"}', '{"biceps","upper back"}', 'bodyweight'),
+    ('Chin Up', '{"Chin-Up","Chinup","Chin Ups"}', 'strength', '{"lats","biceps"}', '{"upper back"}', 'bodyweight'),
+    ('Lat Pulldown', '{"Pulldown","Lat Pull Down"}', 'strength', '{"lats"}', '{"biceps"}', 'cable'),
+    ('Dip', '{"Dips","Parallel Bar Dip"}', 'strength', '{"chest","triceps"}', '{"shoulders"}', 'bodyweight'),
+    ('Push Up', '{"Push-Up","Pushup","Push Ups","Push-Ups"}', 'strength', '{"chest"}', '{"triceps","shoulders"}', 'bodyweight'),
+    ('Barbell Curl', '{"Curl","Bicep Curl","BB Curl"}', 'strength', '{"biceps"}', '{"forearms"}', 'barbell'),
+    ('Dumbbell Curl', '{"DB Curl","Hammer Curl"}', 'strength', '{"biceps"}', '{"forearms"}', 'dumbbell'),
+    ('Triceps Pushdown', '{"Tricep Pushdown","Cable Pushdown"}', 'strength', '{"triceps"}', '{}', 'cable'),
+    ('Skull Crusher', '{"Skullcrusher","Lying Triceps Extension"}', 'strength', '{"triceps"}', '{}', 'barbell'),
+    ('Lateral Raise', '{"Side Raise","Lateral Raises"}', 'strength', '{"shoulders"}', '{}', 'dumbbell'),
+    ('Leg Press', '{}', 'strength', '{"quadriceps","glutes"}', '{"hamstrings"}', 'machine'),
+    ('Leg Curl', '{"Hamstring Curl","Lying Leg Curl"}', 'strength', '{"hamstrings"}', '{}', 'machine'),
+    ('Leg Extension', '{"Leg Extensions"}', 'strength', '{"quadriceps"}', '{}', 'machine'),
+    ('Lunge', '{"Lunges","Walking Lunge"}', 'strength', '{"quadriceps","glutes"}', '{"hamstrings"}', 'dumbbell'),
+    ('Hip Thrust', '{"Barbell Hip Thrust","Glute Bridge"}', 'strength', '{"glutes"}', '{"hamstrings"}', 'barbell'),
+    ('Calf Raise', '{"Standing Calf Raise","Calf Raises"}', 'strength', '{"calves"}', '{}', 'machine'),
+    ('Plank', '{"Planks","Front Plank"}', 'core', '{"abs"}', '{"lower back","shoulders"}', 'bodyweight'),
+    ('Hanging Leg Raise', '{"Leg Raise","Hanging Knee Raise"}', 'core', '{"abs"}', '{"hip flexors"}', 'bodyweight'),
+    ('Running', '{"Run","Jog","Jogging","Treadmill"}', 'cardio', '{"legs"}', '{}', 'none'),
+    ('Cycling', '{"Bike","Biking","Stationary Bike","Spin"}', 'cardio', '{"legs"}', '{}', 'bike'),
+    ('Rowing', '{"Rower","Erg","Rowing Machine"}', 'cardio', '{"back","legs"}', '{"arms"}', 'machine'),
+    ('Jump Rope', '{"Skipping","Skipping Rope"}', 'cardio', '{"calves"}', '{"shoulders"}', 'rope')
+ON CONFLICT (LOWER(name)) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM exercises
+WHERE name IN (
+    'Bench Press', 'Incline Bench Press', 'Dumbbell Bench Press', 'Overhead Press', 'Back Squat', 'Front Squat',
+    'Deadlift', 'Romanian Deadlift', 'Sumo Deadlift', 'Barbell Row', 'Dumbbell Row', 'Pull Up', 'Chin Up',
+    'Lat Pulldown', 'Dip', 'Push Up', 'Barbell Curl', 'Dumbbell Curl', 'Triceps Pushdown', 'Skull Crusher',
+    'Lateral Raise', 'Leg Press', 'Leg Curl', 'Leg Extension', 'Lunge', 'Hip Thrust', 'Calf Raise', 'Plank',
+    'Hanging Leg Raise', 'Running', 'Cycling', 'Rowing', 'Jump Rope'
+);
+-- +goose StatementEnd
\ No newline at end of file
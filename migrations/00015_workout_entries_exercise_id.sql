@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entries ADD COLUMN exercise_id INT REFERENCES exercises (id) ON DELETE SET NULL;
+CREATE INDEX idx_workout_entries_exercise_id ON workout_entries (exercise_id);
+
+-- Exact name or alias matches win; otherwise take the closest trigram match
+-- above the threshold so that typos like "Bench Pres" still resolve.
+WITH candidates AS (
+    SELECT we.id AS entry_id,
+           e.id  AS exercise_id,
+           GREATEST(
+               similarity(LOWER(TRIM(we.exercise_name)), LOWER(e.name)),
+               COALESCE((SELECT MAX(similarity(LOWER(TRIM(we.exercise_name)), LOWER(alias))) FROM unnest(e.aliases) alias), 0)
+           ) AS score
+    FROM workout_entries we
+    CROSS JOIN exercises e
+),
+best AS (
+    SELECT DISTINCT ON (entry_id) entry_id, exercise_id, score
+    FROM candidates
+    ORDER BY entry_id, score DESC, exercise_id
+)
+UPDATE workout_entries we
+SET exercise_id = best.exercise_id
+FROM best
+WHERE we.id = best.entry_id AND best.score >= 0.5;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workout_entries_exercise_id;
+ALTER TABLE workout_entries DROP COLUMN exercise_id;
+-- +goose StatementEnd
\ No newline at end of file
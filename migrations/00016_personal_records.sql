@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS personal_records
+(
+    id               SERIAL PRIMARY KEY,
+    user_id          INT            NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    exercise_id      INT            NOT NULL REFERENCES exercises (id) ON DELETE CASCADE,
+    record_type      VARCHAR        NOT NULL,
+    weight           DECIMAL(5, 2),
+    value            DECIMAL(10, 2) NOT NULL,
+    workout_id       INT            NOT NULL REFERENCES workouts (id) ON DELETE CASCADE,
+    workout_entry_id INT            NOT NULL REFERENCES workout_entries (id) ON DELETE CASCADE,
+    achieved_at      TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    CONSTRAINT valid_record_type CHECK (record_type IN ('max_weight', 'max_reps', 'best_e1rm', 'longest_duration')),
+    CONSTRAINT weight_only_for_max_reps CHECK ((record_type = 'max_reps') = (weight IS NOT NULL))
+);
+
+CREATE UNIQUE INDEX idx_personal_records_unique ON personal_records (user_id, exercise_id, record_type, COALESCE(weight, -1));
+CREATE INDEX idx_personal_records_workout_id ON personal_records (workout_id);
+
+-- Backfill from existing entries. Ties go to the earliest workout; e1RM uses the Epley formula.
+WITH entries AS (
+    SELECT w.user_id, we.id AS entry_id, we.workout_id, we.exercise_id, we.reps, we.weight, we.duration_seconds, w.performed_at
+    FROM workout_entries we
+    INNER JOIN workouts w ON w.id = we.workout_id
+    WHERE we.exercise_id IS NOT NULL
+),
+candidates AS (
+    SELECT user_id, 'max_weight' AS record_type, exercise_id, NULL::DECIMAL AS weight, weight AS value, workout_id, entry_id, performed_at
+    FROM entries WHERE weight > 0
+    UNION ALL
+    SELECT user_id, 'max_reps', exercise_id, COALESCE(weight, 0), reps, workout_id, entry_id, performed_at
+    FROM entries WHERE reps > 0
+    UNION ALL
+    SELECT user_id, 'best_e1rm', exercise_id, NULL, ROUND(CASE WHEN reps = 1 THEN weight ELSE weight * (1 + reps / 30.0) END, 2), workout_id, entry_id, performed_at
+    FROM entries WHERE weight > 0 AND reps > 0
+    UNION ALL
+    SELECT user_id, 'longest_duration', exercise_id, NULL, duration_seconds, workout_id, entry_id, performed_at
+    FROM entries WHERE duration_seconds > 0
+)
+INSERT INTO personal_records (user_id, exercise_id, record_type, weight, value, workout_id, workout_entry_id, achieved_at)
+SELECT DISTINCT ON (user_id, record_type, exercise_id, weight) user_id, exercise_id, record_type, weight, value, workout_id, entry_id, performed_at
+FROM candidates
+ORDER BY user_id, record_type, exercise_id, weight, value DESC, performed_at, entry_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS personal_records;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_templates
+(
+    id          SERIAL PRIMARY KEY,
+    user_id     INT     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name        VARCHAR NOT NULL,
+    description TEXT    NOT NULL DEFAULT '',
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_workout_templates_user_id ON workout_templates (user_id);
+
+CREATE TABLE IF NOT EXISTS template_entries
+(
+    id               SERIAL PRIMARY KEY,
+    template_id      INT     NOT NULL REFERENCES workout_templates (id) ON DELETE CASCADE,
+    exercise_id      INT REFERENCES exercises (id) ON DELETE SET NULL,
+    exercise_name    VARCHAR NOT NULL,
+    sets             INT     NOT NULL,
+    reps             INT,
+    duration_seconds INT,
+    weight           DECIMAL(5, 2),
+    notes            TEXT    NOT NULL DEFAULT '',
+    order_index      INT     NOT NULL,
+
+    CONSTRAINT valid_template_entry CHECK (
+        (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+        (reps IS NULL OR duration_seconds IS NULL)
+        )
+);
+
+CREATE INDEX idx_template_entries_template_id ON template_entries (template_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS template_entries;
+DROP TABLE IF EXISTS workout_templates;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,59 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS programs
+(
+    id               SERIAL PRIMARY KEY,
+    user_id          INT           NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name             VARCHAR       NOT NULL,
+    description      TEXT          NOT NULL DEFAULT '',
+    weeks            INT           NOT NULL CHECK (weeks BETWEEN 1 AND 52),
+    weight_increment DECIMAL(5, 2) NOT NULL DEFAULT 0,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Sessions reference the author's templates. Templates that are still used by
+-- a program cannot be deleted.
+CREATE TABLE IF NOT EXISTS program_sessions
+(
+    id          SERIAL PRIMARY KEY,
+    program_id  INT NOT NULL REFERENCES programs (id) ON DELETE CASCADE,
+    week        INT NOT NULL CHECK (week >= 1),
+    day         INT NOT NULL CHECK (day BETWEEN 1 AND 7),
+    template_id INT NOT NULL REFERENCES workout_templates (id) ON DELETE RESTRICT,
+    order_index INT NOT NULL
+);
+
+CREATE INDEX idx_program_sessions_program_id ON program_sessions (program_id);
+
+CREATE TABLE IF NOT EXISTS program_enrollments
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    INT  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    program_id INT  NOT NULL REFERENCES programs (id) ON DELETE CASCADE,
+    start_date DATE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_program_enrollments_user_id ON program_enrollments (user_id);
+
+-- A planned session is complete once a workout has been started from it.
+-- Deleting that workout makes the session due again.
+CREATE TABLE IF NOT EXISTS session_completions
+(
+    enrollment_id      INT NOT NULL REFERENCES program_enrollments (id) ON DELETE CASCADE,
+    program_session_id INT NOT NULL REFERENCES program_sessions (id) ON DELETE CASCADE,
+    workout_id         INT NOT NULL REFERENCES workouts (id) ON DELETE CASCADE,
+    completed_at       TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (enrollment_id, program_session_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS session_completions;
+DROP TABLE IF EXISTS program_enrollments;
+DROP TABLE IF EXISTS program_sessions;
+DROP TABLE IF EXISTS programs;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+    ADD COLUMN distance_meters       DECIMAL(10, 2),
+    ADD COLUMN elevation_gain_meters DECIMAL(7, 2),
+    ADD COLUMN avg_heart_rate        INT,
+    ADD COLUMN max_heart_rate        INT,
+    ADD CONSTRAINT valid_cardio_entry CHECK (
+        (distance_meters IS NULL OR distance_meters >= 0) AND
+        (elevation_gain_meters IS NULL OR elevation_gain_meters >= 0) AND
+        (avg_heart_rate IS NULL OR avg_heart_rate BETWEEN 1 AND 300) AND
+        (max_heart_rate IS NULL OR max_heart_rate BETWEEN 1 AND 300) AND
+        (avg_heart_rate IS NULL OR max_heart_rate IS NULL OR avg_heart_rate <= max_heart_rate)
+        );
+
+-- The recorded route of a cardio entry. Position, elevation and heart rate are
+-- each optional because devices do not always record them.
+CREATE TABLE IF NOT EXISTS track_points
+(
+    workout_entry_id INT NOT NULL REFERENCES workout_entries (id) ON DELETE CASCADE,
+    sequence         INT NOT NULL,
+    recorded_at      TIMESTAMP WITH TIME ZONE,
+    latitude         DOUBLE PRECISION,
+    longitude        DOUBLE PRECISION,
+    elevation_meters DOUBLE PRECISION,
+    heart_rate       INT,
+    PRIMARY KEY (workout_entry_id, sequence)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS track_points;
+ALTER TABLE workout_entries
+    DROP CONSTRAINT IF EXISTS valid_cardio_entry,
+    DROP COLUMN IF EXISTS distance_meters,
+    DROP COLUMN IF EXISTS elevation_gain_meters,
+    DROP COLUMN IF EXISTS avg_heart_rate,
+    DROP COLUMN IF EXISTS max_heart_rate;
+-- +goose StatementEnd
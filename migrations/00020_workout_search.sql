@@ -0,0 +1,66 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts ADD COLUMN search_vector TSVECTOR NOT NULL DEFAULT ''::tsvector;
+
+-- Titles weigh the most, then descriptions and exercise names, then entry notes.
+CREATE OR REPLACE FUNCTION workout_search_vector(workout_id INT, title TEXT, description TEXT) RETURNS TSVECTOR AS $$
+    SELECT setweight(to_tsvector('english', COALESCE(workout_search_vector.title, '')), 'A') ||
+           setweight(to_tsvector('english', COALESCE(workout_search_vector.description, '')), 'B') ||
+           setweight(to_tsvector('english', COALESCE(string_agg(e.exercise_name, ' '), '')), 'B') ||
+           setweight(to_tsvector('english', COALESCE(string_agg(e.notes, ' '), '')), 'C')
+    FROM workout_entries e
+    WHERE e.workout_id = workout_search_vector.workout_id
+$$ LANGUAGE SQL STABLE;
+
+CREATE OR REPLACE FUNCTION workouts_search_vector_trigger() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector := workout_search_vector(NEW.id, NEW.title, NEW.description);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workouts_search_vector
+    BEFORE INSERT OR UPDATE OF title, description ON workouts
+    FOR EACH ROW EXECUTE FUNCTION workouts_search_vector_trigger();
+
+-- Entries are written after their workout, so each change recomputes the
+-- vector of the workouts it touches.
+CREATE OR REPLACE FUNCTION workout_entries_search_vector_trigger() RETURNS TRIGGER AS $$
+DECLARE
+    workout_ids INT[];
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        workout_ids := ARRAY [NEW.workout_id];
+    ELSIF TG_OP = 'UPDATE' THEN
+        workout_ids := ARRAY [OLD.workout_id, NEW.workout_id];
+    ELSE
+        workout_ids := ARRAY [OLD.workout_id];
+    END IF;
+
+    UPDATE workouts
+    SET search_vector = workout_search_vector(id, title, description)
+    WHERE id = ANY (workout_ids);
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workout_entries_search_vector
+    AFTER INSERT OR UPDATE OF workout_id, exercise_name, notes OR DELETE ON workout_entries
+    FOR EACH ROW EXECUTE FUNCTION workout_entries_search_vector_trigger();
+
+UPDATE workouts SET search_vector = workout_search_vector(id, title, description);
+
+CREATE INDEX IF NOT EXISTS idx_workouts_search_vector ON workouts USING GIN (search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_search_vector;
+DROP TRIGGER IF EXISTS workout_entries_search_vector ON workout_entries;
+DROP TRIGGER IF EXISTS workouts_search_vector ON workouts;
+DROP FUNCTION IF EXISTS workout_entries_search_vector_trigger();
+DROP FUNCTION IF EXISTS workouts_search_vector_trigger();
+DROP FUNCTION IF EXISTS workout_search_vector(INT, TEXT, TEXT);
+ALTER TABLE workouts DROP COLUMN IF EXISTS search_vector;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS tags
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT tags_user_id_name_key UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS workout_tags
+(
+    workout_id INT NOT NULL REFERENCES workouts (id) ON DELETE CASCADE,
+    tag_id     INT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+
+    PRIMARY KEY (workout_id, tag_id)
+);
+
+CREATE INDEX idx_workout_tags_tag_id ON workout_tags (tag_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS workout_tags;
+DROP TABLE IF EXISTS tags;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Seeded catalog exercises have no creator and cannot be changed through the API.
+ALTER TABLE exercises ADD COLUMN created_by INT REFERENCES users (id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE exercises DROP COLUMN IF EXISTS created_by;
+-- +goose StatementEnd
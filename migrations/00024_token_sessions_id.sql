@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- An auth token and the refresh token issued with it share a session_id, and
+-- rotating the refresh token keeps it. Existing tokens become sessions of their own.
+ALTER TABLE tokens ADD COLUMN session_id TEXT;
+UPDATE tokens SET session_id = md5(random()::TEXT || encode(hash, 'hex'));
+ALTER TABLE tokens ALTER COLUMN session_id SET NOT NULL;
+CREATE INDEX idx_tokens_session_id ON tokens(session_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_tokens_session_id;
+ALTER TABLE tokens DROP COLUMN session_id;
+-- +goose StatementEnd
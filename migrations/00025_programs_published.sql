@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Sessions of a program copy its author's private templates, so only published
+-- programs are visible to, and can be enrolled in by, other users.
+ALTER TABLE programs ADD COLUMN published BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE programs DROP COLUMN IF EXISTS published;
+-- +goose StatementEnd
@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+-- resolve_exercise_id maps a free-text exercise name onto the seeded catalog
+-- and the owner's own exercises, never onto another user's. The owner's
+-- exercises win over the seeded ones, then name matches over alias matches.
+CREATE OR REPLACE FUNCTION resolve_exercise_id(exercise_name VARCHAR, owner_id INT) RETURNS INT AS $$
+    SELECT id
+    FROM exercises
+    WHERE (created_by IS NULL OR created_by = owner_id)
+      AND (LOWER(name) = LOWER(TRIM(exercise_name))
+       OR EXISTS (SELECT 1 FROM unnest(aliases) alias WHERE LOWER(alias) = LOWER(TRIM(exercise_name))))
+    ORDER BY created_by IS NULL, LOWER(name) = LOWER(TRIM(exercise_name)) DESC, id
+    LIMIT 1
+$$ LANGUAGE SQL STABLE;
+
+DROP FUNCTION IF EXISTS resolve_exercise_id(VARCHAR);
+
+-- A deleted user's exercises would otherwise lose their creator and join the
+-- seeded catalog of every user.
+ALTER TABLE exercises DROP CONSTRAINT exercises_created_by_fkey;
+ALTER TABLE exercises ADD CONSTRAINT exercises_created_by_fkey FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE CASCADE;
+
+-- Re-resolve the entries that were linked to another user's exercise. Their
+-- records are dropped and rebuilt the next time the exercise is logged.
+DELETE FROM personal_records pr
+USING exercises e
+WHERE e.id = pr.exercise_id AND e.created_by IS NOT NULL AND e.created_by <> pr.user_id;
+
+UPDATE workout_entries we
+SET exercise_id = resolve_exercise_id(we.exercise_name, w.user_id)
+FROM workouts w, exercises e
+WHERE w.id = we.workout_id AND e.id = we.exercise_id AND e.created_by IS NOT NULL AND e.created_by <> w.user_id;
+
+UPDATE template_entries te
+SET exercise_id = resolve_exercise_id(te.exercise_name, t.user_id)
+FROM workout_templates t, exercises e
+WHERE t.id = te.template_id AND e.id = te.exercise_id AND e.created_by IS NOT NULL AND e.created_by <> t.user_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE exercises DROP CONSTRAINT exercises_created_by_fkey;
+ALTER TABLE exercises ADD CONSTRAINT exercises_created_by_fkey FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE OR REPLACE FUNCTION resolve_exercise_id(exercise_name VARCHAR) RETURNS INT AS $$
+    SELECT id
+    FROM exercises
+    WHERE LOWER(name) = LOWER(TRIM(exercise_name))
+       OR EXISTS (SELECT 1 FROM unnest(aliases) alias WHERE LOWER(alias) = LOWER(TRIM(exercise_name)))
+    ORDER BY LOWER(name) = LOWER(TRIM(exercise_name)) DESC, id
+    LIMIT 1
+$$ LANGUAGE SQL STABLE;
+
+DROP FUNCTION IF EXISTS resolve_exercise_id(VARCHAR, INT);
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Emails are looked up case-insensitively, so they have to be unique that
+-- way too. This fails if differently cased duplicates already exist.
+CREATE UNIQUE INDEX users_email_lower_key ON users (LOWER(email));
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+DROP INDEX IF EXISTS users_email_lower_key;
+-- +goose StatementEnd